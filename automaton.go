@@ -0,0 +1,467 @@
+package heatPlot
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxNeighbourhoodRadius stops a disc or ring with an enormous radius from reading the whole of the previous frame
+// for every pixel.
+const maxNeighbourhoodRadius = 64
+
+// Neighbourhood is disc(r), the mean of the previous frame over the pixels no more than r pixels from the one being
+// worked out, itself included, or ring(inner, outer), the mean over those further than inner and no further than
+// outer. They are the neighbour sums of continuous automata such as SmoothLife, divided by how many pixels were added
+// up, as in "m = disc(4); n = ring(4, 12); 0 = ...". Radii are capped at maxNeighbourhoodRadius.
+type Neighbourhood struct {
+	// Name is disc or ring as it was written.
+	Name string
+	Args []Expression
+}
+
+func (v Neighbourhood) Evaluate(state State) float64 {
+	inner, outer := -1.0, v.Args[len(v.Args)-1].Evaluate(state)
+	if len(v.Args) == 2 {
+		inner = v.Args[0].Evaluate(state)
+	}
+	if math.IsNaN(inner) || math.IsNaN(outer) {
+		return math.NaN()
+	}
+	outer = math.Min(outer, maxNeighbourhoodRadius)
+	reach := int(math.Floor(outer))
+	sum, count := 0.0, 0
+	for dx := -reach; dx <= reach; dx++ {
+		for dy := -reach; dy <= reach; dy++ {
+			if d := math.Hypot(float64(dx), float64(dy)); d > inner && d <= outer {
+				sum += state.Prev(dx, dy)
+				count++
+			}
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+func (v Neighbourhood) String() string {
+	args := make([]string, len(v.Args))
+	for i, arg := range v.Args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s(%s)", v.Name, strings.Join(args, ", "))
+}
+
+func (v Neighbourhood) Simplify() Expression {
+	args := make([]Expression, len(v.Args))
+	for i, arg := range v.Args {
+		args[i] = removeBrackets(arg.Simplify())
+	}
+	v.Args = args
+	return &v
+}
+
+func (v Neighbourhood) Depth() int {
+	return maxDepth(v.Args...)
+}
+
+// neighbourhoodArity returns how many arguments the neighbourhood name takes, or 0 when it isn't one.
+func neighbourhoodArity(name string) int {
+	switch strings.ToUpper(name) {
+	case "DISC":
+		return 1
+	case "RING":
+		return 2
+	}
+	return 0
+}
+
+// Rule is how a cellular automaton works out a generation from the one before. Boundary is what is read beyond the
+// edges of previous and pointSize how many x or y steps a pixel is, for rules which are formulas.
+type Rule interface {
+	Next(previous *Plot, boundary Boundary, pointSize float64) (*Plot, error)
+	String() string
+}
+
+// CountRange is the neighbour counts from Min to Max, both included.
+type CountRange struct {
+	Min, Max int
+}
+
+// LifeRule is a discrete rule such as Conway's Game of Life, B3/S23, or one of the Larger than Life rules. A pixel of
+// at least 0.5 is alive and the rest dead, each generation is 1 for alive and 0 for dead. A dead pixel comes alive
+// when the number of live pixels around it is in one of the Birth ranges and a live one stays alive when the number
+// is in one of the Survive ranges.
+type LifeRule struct {
+	// Range is how far the neighbourhood reaches, 1 for the 8 pixels around.
+	Range int
+	// VonNeumann neighbourhoods are the pixels up to Range steps away without going diagonally, rather than the
+	// square of Moore neighbourhoods.
+	VonNeumann bool
+	// Middle counts the pixel itself amongst its neighbours.
+	Middle  bool
+	Birth   []CountRange
+	Survive []CountRange
+}
+
+var (
+	birthSurviveRe = regexp.MustCompile(`^(?i)(?:b([0-8]*)/s([0-8]*)|s([0-8]*)/b([0-8]*))$`)
+	lifeCountsRe   = regexp.MustCompile(`^(\d+)(?:\.\.(\d+))?$`)
+)
+
+// ParseRule parses a rule written as B3/S23, the counts a dead pixel comes alive with and those a live one stays alive
+// with, or in the Larger than Life notation R5,C0,M1,S34..58,B34..45,NM. Anything with an = or a bracket in it is a
+// formula instead, a FormulaRule, using prev, disc and ring to read the generation before.
+func ParseRule(spec string) (Rule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.ContainsAny(spec, "=(") {
+		f, err := ParseFunctionE(spec)
+		if err != nil {
+			return nil, err
+		}
+		if f.Equals == nil {
+			return nil, errors.New("a rule formula must end with an equation, rgb and rgba have no weight for the next generation to read")
+		}
+		return &FormulaRule{Function: f}, nil
+	}
+	if m := birthSurviveRe.FindStringSubmatch(spec); m != nil {
+		rule := &LifeRule{
+			Range:   1,
+			Birth:   digitCounts(m[1] + m[4]),
+			Survive: digitCounts(m[2] + m[3]),
+		}
+		return rule, nil
+	}
+	if strings.HasPrefix(strings.ToUpper(spec), "R") {
+		return parseLargerThanLife(spec)
+	}
+	return nil, fmt.Errorf("unknown rule %q, write it as B3/S23, R5,C0,M1,S34..58,B34..45,NM or a formula", spec)
+}
+
+// digitCounts is the counts of B/S notation, each digit being a count of its own.
+func digitCounts(digits string) []CountRange {
+	var result []CountRange
+	for _, d := range digits {
+		n := int(d - '0')
+		result = append(result, CountRange{Min: n, Max: n})
+	}
+	return result
+}
+
+// parseLargerThanLife parses the Larger than Life notation, where S and B can be given more than once.
+func parseLargerThanLife(spec string) (*LifeRule, error) {
+	rule := &LifeRule{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("rule %q has an empty part", spec)
+		}
+		key, value := strings.ToUpper(part[:1]), part[1:]
+		switch key {
+		case "R":
+			r, err := strconv.Atoi(value)
+			if err != nil || r < 1 || r > maxNeighbourhoodRadius {
+				return nil, fmt.Errorf("rule %q has range %q, it must be from 1 to %d", spec, value, maxNeighbourhoodRadius)
+			}
+			rule.Range = r
+		case "C":
+			if value != "0" && value != "2" {
+				return nil, fmt.Errorf("rule %q has %s states, only rules with 2 are supported", spec, value)
+			}
+		case "M":
+			if value != "0" && value != "1" {
+				return nil, fmt.Errorf("rule %q has M%s, it must be M0 or M1", spec, value)
+			}
+			rule.Middle = value == "1"
+		case "S", "B":
+			m := lifeCountsRe.FindStringSubmatch(value)
+			if m == nil {
+				return nil, fmt.Errorf("rule %q has %s%s, counts are written as 34..58 or 3", spec, key, value)
+			}
+			counts := CountRange{}
+			counts.Min, _ = strconv.Atoi(m[1])
+			counts.Max = counts.Min
+			if m[2] != "" {
+				counts.Max, _ = strconv.Atoi(m[2])
+			}
+			if key == "S" {
+				rule.Survive = append(rule.Survive, counts)
+			} else {
+				rule.Birth = append(rule.Birth, counts)
+			}
+		case "N":
+			switch strings.ToUpper(value) {
+			case "M":
+				rule.VonNeumann = false
+			case "N":
+				rule.VonNeumann = true
+			default:
+				return nil, fmt.Errorf("rule %q has neighbourhood N%s, it must be NM or NN", spec, value)
+			}
+		default:
+			return nil, fmt.Errorf("rule %q has %q, the parts are R, C, M, S, B and N", spec, part)
+		}
+	}
+	if rule.Range == 0 {
+		return nil, fmt.Errorf("rule %q has no range, such as R5", spec)
+	}
+	return rule, nil
+}
+
+// isBirthSurvive reports whether the rule can be written in B/S notation.
+func (r *LifeRule) isBirthSurvive() bool {
+	if r.Range != 1 || r.VonNeumann || r.Middle {
+		return false
+	}
+	for _, counts := range append(append([]CountRange{}, r.Birth...), r.Survive...) {
+		if counts.Min < 0 || counts.Max > 8 {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *LifeRule) String() string {
+	if r.isBirthSurvive() {
+		return fmt.Sprintf("B%s/S%s", countDigits(r.Birth), countDigits(r.Survive))
+	}
+	parts := []string{fmt.Sprintf("R%d", r.Range), "C0", "M0"}
+	if r.Middle {
+		parts[2] = "M1"
+	}
+	for _, counts := range r.Survive {
+		parts = append(parts, "S"+counts.String())
+	}
+	for _, counts := range r.Birth {
+		parts = append(parts, "B"+counts.String())
+	}
+	if r.VonNeumann {
+		parts = append(parts, "NN")
+	} else {
+		parts = append(parts, "NM")
+	}
+	return strings.Join(parts, ",")
+}
+
+func (c CountRange) String() string {
+	if c.Min == c.Max {
+		return strconv.Itoa(c.Min)
+	}
+	return fmt.Sprintf("%d..%d", c.Min, c.Max)
+}
+
+// countDigits writes counts as the digits of B/S notation.
+func countDigits(counts []CountRange) string {
+	b := &strings.Builder{}
+	for n := 0; n <= 8; n++ {
+		if inCounts(counts, n) {
+			b.WriteString(strconv.Itoa(n))
+		}
+	}
+	return b.String()
+}
+
+func inCounts(counts []CountRange, n int) bool {
+	for _, c := range counts {
+		if n >= c.Min && n <= c.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// isAlive reports whether a pixel of weight w is alive.
+func isAlive(w float64) bool {
+	return w >= 0.5
+}
+
+func (r *LifeRule) Next(previous *Plot, boundary Boundary, pointSize float64) (*Plot, error) {
+	size := previous.Size
+	plot := &Plot{
+		Size:   size,
+		Values: make([]float64, size.Dy()*size.Dx()),
+		T:      previous.T + 1,
+	}
+	for x := size.Min.X; x < size.Max.X; x++ {
+		for y := size.Min.Y; y < size.Max.Y; y++ {
+			alive := isAlive(previous.Get(x, y))
+			counts := r.Birth
+			if alive {
+				counts = r.Survive
+			}
+			plot.Set(x, y, truth(inCounts(counts, r.neighbours(previous, x, y, boundary))))
+		}
+	}
+	return plot, nil
+}
+
+// neighbours counts the live pixels in the neighbourhood of x, y.
+func (r *LifeRule) neighbours(plot *Plot, x, y int, boundary Boundary) int {
+	count := 0
+	for dx := -r.Range; dx <= r.Range; dx++ {
+		for dy := -r.Range; dy <= r.Range; dy++ {
+			if dx == 0 && dy == 0 && !r.Middle {
+				continue
+			}
+			if r.VonNeumann && abs(dx)+abs(dy) > r.Range {
+				continue
+			}
+			if isAlive(plot.At(x+dx, y+dy, boundary)) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// FormulaRule is a continuous rule, each generation is the formula plotted with prev reading the generation before, as
+// in the SmoothLife like "m = disc(3); n = ring(3, 9); 0 = if(m < 0.5, n > 0.27 && n < 0.34, n > 0.24 && n < 0.45)".
+// t is the number of the generation.
+type FormulaRule struct {
+	Function *Function
+}
+
+func (r *FormulaRule) Next(previous *Plot, boundary Boundary, pointSize float64) (*Plot, error) {
+	f := *r.Function
+	f.Boundary = boundary
+	plot, _, err := f.plotForT(previous.Size, previous, previous.T+1, pointSize, timeline{})
+	return plot, err
+}
+
+func (r *FormulaRule) String() string {
+	return r.Function.Heading()
+}
+
+// Generations runs rule from seed for count generations, seed being the first of them. Each generation's T is one
+// more than the one before. Asking for more than maxFrames is an error.
+func Generations(rule Rule, seed *Plot, count int, boundary Boundary, pointSize float64) ([]*Plot, error) {
+	if count > maxFrames {
+		return nil, fmt.Errorf("at most %d generations can be made but %d were asked for", maxFrames, count)
+	}
+	plots := []*Plot{seed}
+	for len(plots) < count {
+		plot, err := rule.Next(plots[len(plots)-1], boundary, pointSize)
+		if err != nil {
+			return nil, err
+		}
+		plots = append(plots, plot)
+	}
+	return plots, nil
+}
+
+// RenderGenerations is RenderPlots for the generations of a cellular automaton, headed by the rule.
+func RenderGenerations(heatColourCount int, plots []*Plot, plotSize image.Rectangle, scale int, rule Rule, footerText string, speed time.Duration, w io.Writer) {
+	last := 0.0
+	if len(plots) > 0 {
+		last = plots[len(plots)-1].T
+	}
+	renderHeatPlots(heatColourCount, plots, plotSize, scale, rule.String(), last, true, footerText, speed, w)
+}
+
+// Pattern is a cellular automaton pattern, such as one read from an RLE file. Alive are the live cells, x going right
+// and y going down from the top left of a Width by Height box.
+type Pattern struct {
+	Width, Height int
+	// Rule is the rule the pattern was written for, empty when it didn't say.
+	Rule  string
+	Alive []image.Point
+}
+
+var rleHeaderRe = regexp.MustCompile(`^(?i)\s*x\s*=\s*(\d+)\s*,\s*y\s*=\s*(\d+)\s*(?:,\s*rule\s*=\s*(\S+))?\s*$`)
+
+// ReadRLE reads a pattern in the run length encoded format of Golly and LifeWiki, as in "x = 3, y = 3, rule = B3/S23"
+// followed by "bob$2bo$3o!". b and . are dead cells, other letters live ones, $ ends a row and ! the pattern. Each
+// can be preceded by how many times it repeats. Lines starting with # are comments.
+func ReadRLE(r io.Reader) (*Pattern, error) {
+	p := &Pattern{}
+	scanner := bufio.NewScanner(r)
+	var x, y, line int
+	headed, done := false, false
+	for scanner.Scan() && !done {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if !headed {
+			headed = true
+			if m := rleHeaderRe.FindStringSubmatch(text); m != nil {
+				p.Width, _ = strconv.Atoi(m[1])
+				p.Height, _ = strconv.Atoi(m[2])
+				p.Rule = m[3]
+				continue
+			}
+		}
+		run := 0
+		for _, c := range text {
+			switch {
+			case c >= '0' && c <= '9':
+				run = run*10 + int(c-'0')
+				if run > 1<<20 {
+					return nil, fmt.Errorf("line %d: run of more than %d in RLE pattern", line, 1<<20)
+				}
+				continue
+			case c == ' ' || c == '\t':
+				continue
+			case c == '!':
+				done = true
+			case c == '$':
+				y += max(run, 1)
+				x = 0
+			case c == 'b' || c == '.':
+				x += max(run, 1)
+			case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+				for i := 0; i < max(run, 1); i++ {
+					p.Alive = append(p.Alive, image.Pt(x, y))
+					x++
+				}
+			default:
+				return nil, fmt.Errorf("line %d: unexpected %q in RLE pattern", line, c)
+			}
+			if done {
+				break
+			}
+			run = 0
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, cell := range p.Alive {
+		p.Width = max(p.Width, cell.X+1)
+		p.Height = max(p.Height, cell.Y+1)
+	}
+	return p, nil
+}
+
+// Plot places the pattern in the middle of a plot of size, its live cells 1 and everything else 0. The top of the
+// pattern is at the top of the plot, as y goes up in a plot. Cells which don't fit are left out.
+func (p *Pattern) Plot(size image.Rectangle) *Plot {
+	plot := &Plot{
+		Size:   size,
+		Values: make([]float64, size.Dy()*size.Dx()),
+	}
+	left := size.Min.X + (size.Dx()-p.Width)/2
+	top := size.Max.Y - 1 - (size.Dy()-p.Height)/2
+	for _, cell := range p.Alive {
+		if at := image.Pt(left+cell.X, top-cell.Y); at.In(size) {
+			plot.Set(at.X, at.Y, 1)
+		}
+	}
+	return plot
+}
@@ -0,0 +1,403 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	for eachI, each := range []struct {
+		Spec     string
+		String   string
+		Expected Rule
+	}{
+		{
+			Spec:   "B3/S23",
+			String: "B3/S23",
+			Expected: &LifeRule{
+				Range:   1,
+				Birth:   []CountRange{{3, 3}},
+				Survive: []CountRange{{2, 2}, {3, 3}},
+			},
+		},
+		{
+			Spec:   "s23/b36",
+			String: "B36/S23",
+			Expected: &LifeRule{
+				Range:   1,
+				Birth:   []CountRange{{3, 3}, {6, 6}},
+				Survive: []CountRange{{2, 2}, {3, 3}},
+			},
+		},
+		{
+			Spec:   "B2/S",
+			String: "B2/S",
+			Expected: &LifeRule{
+				Range: 1,
+				Birth: []CountRange{{2, 2}},
+			},
+		},
+		{
+			Spec:   "R5,C0,M1,S34..58,B34..45,NM",
+			String: "R5,C0,M1,S34..58,B34..45,NM",
+			Expected: &LifeRule{
+				Range:   5,
+				Middle:  true,
+				Birth:   []CountRange{{34, 45}},
+				Survive: []CountRange{{34, 58}},
+			},
+		},
+		{
+			Spec:   "R1,C2,M0,S2..3,B3,NN",
+			String: "R1,C0,M0,S2..3,B3,NN",
+			Expected: &LifeRule{
+				Range:      1,
+				VonNeumann: true,
+				Birth:      []CountRange{{3, 3}},
+				Survive:    []CountRange{{2, 3}},
+			},
+		},
+		{
+			Spec:   "R1,S2..3,B3",
+			String: "B3/S23",
+			Expected: &LifeRule{
+				Range:   1,
+				Birth:   []CountRange{{3, 3}},
+				Survive: []CountRange{{2, 3}},
+			},
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Spec), func(t *testing.T) {
+			rule, err := ParseRule(each.Spec)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if !reflect.DeepEqual(rule, each.Expected) {
+				t.Errorf("Got %#v expected %#v", rule, each.Expected)
+			}
+			if rule.String() != each.String {
+				t.Errorf("Got %#v expected %#v", rule.String(), each.String)
+			}
+			if again, err := ParseRule(rule.String()); err != nil || again.String() != rule.String() {
+				t.Errorf("Reparse gave %v %v", again, err)
+			}
+		})
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	for _, each := range []struct {
+		Spec   string
+		Reason string
+	}{
+		{Spec: "B9/S23", Reason: "unknown rule"},
+		{Spec: "life", Reason: "unknown rule"},
+		{Spec: "R0,S2,B3", Reason: "it must be from 1 to"},
+		{Spec: "R2,C3,S2,B3", Reason: "only rules with 2 are supported"},
+		{Spec: "R2,S2..,B3", Reason: "counts are written as"},
+		{Spec: "R2,S2,B3,NH", Reason: "it must be NM or NN"},
+		{Spec: "S2,B3,NM", Reason: "unknown rule"},
+		{Spec: "R2,,S2", Reason: "has an empty part"},
+		{Spec: "R2,X2", Reason: "the parts are"},
+		{Spec: "rgb(x, 0, 0)", Reason: "must end with an equation"},
+		{Spec: "0 = disc(1, 2)", Reason: "disc takes 1 argument but was given 2"},
+	} {
+		t.Run(each.Spec, func(t *testing.T) {
+			_, err := ParseRule(each.Spec)
+			if err == nil || !strings.Contains(err.Error(), each.Reason) {
+				t.Errorf("Got %v expected %#v", err, each.Reason)
+			}
+		})
+	}
+}
+
+// cells returns a plot of size with the cells alive.
+func cells(size image.Rectangle, alive ...image.Point) *Plot {
+	plot := &Plot{
+		Size:   size,
+		Values: make([]float64, size.Dy()*size.Dx()),
+	}
+	for _, p := range alive {
+		plot.Set(p.X, p.Y, 1)
+	}
+	return plot
+}
+
+func TestLifeRule(t *testing.T) {
+	size := image.Rect(-4, -4, 4, 4)
+	life, err := ParseRule("B3/S23")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	for eachI, each := range []struct {
+		Name       string
+		Boundary   Boundary
+		First      *Plot
+		Generation int
+		Expected   *Plot
+	}{
+		{
+			Name:       "blinker",
+			First:      cells(size, image.Pt(-1, 0), image.Pt(0, 0), image.Pt(1, 0)),
+			Generation: 1,
+			Expected:   cells(size, image.Pt(0, -1), image.Pt(0, 0), image.Pt(0, 1)),
+		},
+		{
+			Name:       "blinker",
+			First:      cells(size, image.Pt(-1, 0), image.Pt(0, 0), image.Pt(1, 0)),
+			Generation: 2,
+			Expected:   cells(size, image.Pt(-1, 0), image.Pt(0, 0), image.Pt(1, 0)),
+		},
+		{
+			Name:       "block",
+			First:      cells(size, image.Pt(0, 0), image.Pt(1, 0), image.Pt(0, 1), image.Pt(1, 1)),
+			Generation: 5,
+			Expected:   cells(size, image.Pt(0, 0), image.Pt(1, 0), image.Pt(0, 1), image.Pt(1, 1)),
+		},
+		{
+			Name:       "glider",
+			Boundary:   BoundaryWrap,
+			First:      cells(size, image.Pt(0, 1), image.Pt(1, 0), image.Pt(-1, -1), image.Pt(0, -1), image.Pt(1, -1)),
+			Generation: 4,
+			Expected:   cells(size, image.Pt(1, 0), image.Pt(2, -1), image.Pt(0, -2), image.Pt(1, -2), image.Pt(2, -2)),
+		},
+		{
+			Name:       "glider wrapping",
+			Boundary:   BoundaryWrap,
+			First:      cells(size, image.Pt(0, 1), image.Pt(1, 0), image.Pt(-1, -1), image.Pt(0, -1), image.Pt(1, -1)),
+			Generation: 32,
+			Expected:   cells(size, image.Pt(0, 1), image.Pt(1, 0), image.Pt(-1, -1), image.Pt(0, -1), image.Pt(1, -1)),
+		},
+		{
+			Name:       "glider into the edge",
+			Boundary:   BoundaryZero,
+			First:      cells(size, image.Pt(0, 1), image.Pt(1, 0), image.Pt(-1, -1), image.Pt(0, -1), image.Pt(1, -1)),
+			Generation: 32,
+			Expected:   cells(size, image.Pt(2, -3), image.Pt(3, -3), image.Pt(2, -4), image.Pt(3, -4)),
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Name), func(t *testing.T) {
+			plots, err := Generations(life, each.First, each.Generation+1, each.Boundary, 1)
+			if err != nil {
+				t.Fatalf("Generations failed: %v", err)
+			}
+			if len(plots) != each.Generation+1 {
+				t.Fatalf("Got %d generations expected %d", len(plots), each.Generation+1)
+			}
+			got := plots[each.Generation]
+			if got.T != float64(each.Generation) {
+				t.Errorf("Got T %v expected %v", got.T, each.Generation)
+			}
+			if !reflect.DeepEqual(got.Values, each.Expected.Values) {
+				t.Errorf("Got %v expected %v", got.Values, each.Expected.Values)
+			}
+		})
+	}
+}
+
+func TestLifeRuleNeighbours(t *testing.T) {
+	size := image.Rect(-3, -3, 4, 4)
+	plot := cells(size, image.Pt(0, 0), image.Pt(1, 0), image.Pt(2, 1), image.Pt(3, 2), image.Pt(1, 3))
+	for _, each := range []struct {
+		Spec     string
+		Expected int
+	}{
+		{Spec: "B3/S23", Expected: 2},
+		{Spec: "R2,C0,M0,S1,B1,NM", Expected: 3},
+		{Spec: "R2,C0,M1,S1,B1,NM", Expected: 4},
+		{Spec: "R2,C0,M1,S1,B1,NN", Expected: 3},
+		{Spec: "R3,C0,M0,S1,B1,NN", Expected: 3},
+	} {
+		t.Run(each.Spec, func(t *testing.T) {
+			rule, err := ParseRule(each.Spec)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if got := rule.(*LifeRule).neighbours(plot, 1, 0, BoundaryZero); got != each.Expected {
+				t.Errorf("Got %d expected %d", got, each.Expected)
+			}
+		})
+	}
+}
+
+func TestReadRLE(t *testing.T) {
+	for eachI, each := range []struct {
+		RLE      string
+		Expected *Pattern
+	}{
+		{
+			RLE: "#N Glider\n#C The smallest spaceship\nx = 3, y = 3, rule = B3/S23\nbob$2bo$3o!\n",
+			Expected: &Pattern{
+				Width:  3,
+				Height: 3,
+				Rule:   "B3/S23",
+				Alive:  []image.Point{{1, 0}, {2, 1}, {0, 2}, {1, 2}, {2, 2}},
+			},
+		},
+		{
+			RLE: "x = 12, y = 4\n2o10b$\n3$11o\nA! ignored after the end\no",
+			Expected: &Pattern{
+				Width:  12,
+				Height: 5,
+				Alive: []image.Point{
+					{0, 0}, {1, 0},
+					{0, 4}, {1, 4}, {2, 4}, {3, 4}, {4, 4}, {5, 4}, {6, 4}, {7, 4}, {8, 4}, {9, 4}, {10, 4}, {11, 4},
+				},
+			},
+		},
+		{
+			RLE: "o.o$.o.!",
+			Expected: &Pattern{
+				Width:  3,
+				Height: 2,
+				Alive:  []image.Point{{0, 0}, {2, 0}, {1, 1}},
+			},
+		},
+	} {
+		t.Run(fmt.Sprint(eachI), func(t *testing.T) {
+			got, err := ReadRLE(strings.NewReader(each.RLE))
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, each.Expected) {
+				t.Errorf("Got %#v expected %#v", got, each.Expected)
+			}
+		})
+	}
+	for _, each := range []string{"x = 3, y = 3\nbo?!", "99999999o!"} {
+		if _, err := ReadRLE(strings.NewReader(each)); err == nil {
+			t.Errorf("Expected %#v to be refused", each)
+		}
+	}
+}
+
+func TestPatternPlot(t *testing.T) {
+	p, err := ReadRLE(strings.NewReader("x = 3, y = 3\nbob$2bo$3o!"))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	size := image.Rect(-2, -2, 3, 3)
+	expected := cells(size, image.Pt(0, 1), image.Pt(1, 0), image.Pt(-1, -1), image.Pt(0, -1), image.Pt(1, -1))
+	if got := p.Plot(size); !reflect.DeepEqual(got.Values, expected.Values) {
+		t.Errorf("Got %v expected %v", got.Values, expected.Values)
+	}
+	small := image.Rect(0, 0, 2, 2)
+	expected = cells(small, image.Pt(1, 1))
+	if got := p.Plot(small); !reflect.DeepEqual(got.Values, expected.Values) {
+		t.Errorf("Got %v expected %v", got.Values, expected.Values)
+	}
+}
+
+func TestNeighbourhood(t *testing.T) {
+	size := image.Rect(-4, -4, 5, 5)
+	first := cells(size, image.Pt(0, 0), image.Pt(2, 0), image.Pt(0, 3))
+	for eachI, each := range []struct {
+		Formula  string
+		String   string
+		At       image.Point
+		Expected float64
+	}{
+		{Formula: "0 = disc(0)", String: "0 = disc(0)", At: image.Pt(0, 0), Expected: 1},
+		{Formula: "0 = disc(1)", String: "0 = disc(1)", At: image.Pt(1, 0), Expected: 2.0 / 5},
+		{Formula: "0 = disc(1.5)", String: "0 = disc(1.5)", At: image.Pt(1, 1), Expected: 2.0 / 9},
+		{Formula: "0 = ring(0, 1)", String: "0 = ring(0, 1)", At: image.Pt(1, 0), Expected: 2.0 / 4},
+		{Formula: "0 = ring(1, 2) * 8", String: "0 = ring(1, 2) * 8", At: image.Pt(0, 1), Expected: 1},
+		{Formula: "r = 3; 0 = ring(r - 1, r)", String: "r = 3; 0 = ring(r - 1, r)", At: image.Pt(0, 0), Expected: 1.0 / 16},
+		{Formula: "0 = ring(2, 1)", String: "0 = ring(2, 1)", At: image.Pt(0, 0), Expected: 0},
+		{Formula: "0 = RING(0, x + 1.5)", String: "0 = RING(0, x + 1.5)", At: image.Pt(1, 0), Expected: 2.0 / 20},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			rule, err := ParseRule(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			f := rule.(*FormulaRule).Function
+			if f.String() != each.String {
+				t.Errorf("Got %#v expected %#v", f.String(), each.String)
+			}
+			if _, err := ParseFunctionE(f.Simplify().String()); err != nil {
+				t.Errorf("Reparse failed: %v", err)
+			}
+			next, err := rule.Next(first, BoundaryZero, 1)
+			if err != nil {
+				t.Fatalf("Next failed: %v", err)
+			}
+			if got := next.Get(each.At.X, each.At.Y); got != each.Expected {
+				t.Errorf("Got %v expected %v", got, each.Expected)
+			}
+			if next.T != 1 {
+				t.Errorf("Got T %v expected 1", next.T)
+			}
+		})
+	}
+}
+
+func TestNeighbourhoodErrors(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula string
+		Complex bool
+		Column  int
+		Reason  string
+	}{
+		{
+			Formula: "0 = ring(3)",
+			Column:  5,
+			Reason:  "ring takes 2 arguments but was given 1",
+		},
+		{
+			Formula: "0 = z + disc(2)",
+			Complex: true,
+			Column:  1,
+			Reason:  "disc(2) isn't defined for complex numbers",
+		},
+		{
+			Formula: "y = d(x * ring(1, 2), x)",
+			Column:  5,
+			Reason:  "ring has no derivative",
+		},
+		{
+			Formula: "rgb(disc(1), 0, 0)",
+			Column:  1,
+			Reason:  "prev can only be used in a formula ending with an equation",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			parse := ParseFunctionE
+			if each.Complex {
+				parse = ParseComplexFunctionE
+			}
+			_, err := parse(each.Formula)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a *ParseError got %#v", err)
+			}
+			if pe.Column != each.Column || pe.Reason != each.Reason {
+				t.Errorf("Got column %d %#v expected column %d %#v", pe.Column, pe.Reason, each.Column, each.Reason)
+			}
+		})
+	}
+}
+
+func TestFormulaRuleGenerations(t *testing.T) {
+	size := image.Rect(-3, -3, 3, 3)
+	rule, err := ParseRule("0 = prev + t")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	plots, err := Generations(rule, cells(size, image.Pt(0, 0)), 4, BoundaryClamp, 1)
+	if err != nil {
+		t.Fatalf("Generations failed: %v", err)
+	}
+	for i, expected := range []float64{1, 2, 4, 7} {
+		if got := plots[i].Get(0, 0); got != expected || plots[i].T != float64(i) {
+			t.Errorf("Generation %d got %v at T %v expected %v", i, got, plots[i].T, expected)
+		}
+	}
+	if _, err := Generations(rule, plots[0], maxFrames+1, BoundaryClamp, 1); err == nil {
+		t.Errorf("Expected an error for %d generations", maxFrames+1)
+	}
+}
@@ -5,39 +5,72 @@ package heatPlot
 
 import __yyfmt__ "fmt"
 
-var yyResult *Function
-
-//line calc.y:14
+//line calc.y:15
 type yySymType struct {
-	yys   int
-	float float64
-	s     string
-	expr  Expression
+	yys        int
+	float      float64
+	s          string
+	expr       Expression
+	exprs      []Expression
+	statement  Expression
+	statements []Expression
 }
 
-const Highest = 57346
-const FLOAT = 57347
-const VAR = 57348
-const FUNCNAME = 57349
+const FLOAT = 57346
+const VAR = 57347
+const FUNCNAME = 57348
+const INFIXNAME = 57349
+const CONSTNAME = 57350
+const COLOUR = 57351
+const STRING = 57352
+const LE = 57353
+const GE = 57354
+const EQ = 57355
+const NE = 57356
+const AND = 57357
+const OR = 57358
+const IF = 57359
+const PIECEWISE = 57360
+const ROOT = 57361
+const IMPLICIT = 57362
+const UNARY = 57363
 
 var yyToknames = [...]string{
 	"$end",
 	"error",
 	"$unk",
-	"Highest",
 	"FLOAT",
 	"VAR",
 	"FUNCNAME",
+	"INFIXNAME",
+	"CONSTNAME",
+	"COLOUR",
+	"STRING",
+	"LE",
+	"GE",
+	"EQ",
+	"NE",
+	"AND",
+	"OR",
+	"IF",
+	"PIECEWISE",
+	"ROOT",
 	"'='",
+	"'<'",
+	"'>'",
 	"'+'",
 	"'-'",
 	"'*'",
 	"'/'",
 	"'%'",
-	"'^'",
-	"','",
+	"IMPLICIT",
 	"'('",
+	"UNARY",
+	"'^'",
+	"';'",
 	"')'",
+	"'!'",
+	"','",
 }
 
 var yyStatenames = [...]string{}
@@ -46,80 +79,202 @@ const yyEofCode = 1
 const yyErrCode = 2
 const yyInitialStackSize = 16
 
-//line calc.y:46
+//line calc.y:109
 
 //line yacctab:1
 var yyExca = [...]int8{
 	-1, 1,
 	1, -1,
 	-2, 0,
+	-1, 58,
+	11, 0,
+	12, 0,
+	13, 0,
+	14, 0,
+	21, 0,
+	22, 0,
+	-2, 17,
+	-1, 59,
+	11, 0,
+	12, 0,
+	13, 0,
+	14, 0,
+	21, 0,
+	22, 0,
+	-2, 18,
+	-1, 60,
+	11, 0,
+	12, 0,
+	13, 0,
+	14, 0,
+	21, 0,
+	22, 0,
+	-2, 19,
+	-1, 61,
+	11, 0,
+	12, 0,
+	13, 0,
+	14, 0,
+	21, 0,
+	22, 0,
+	-2, 20,
+	-1, 62,
+	11, 0,
+	12, 0,
+	13, 0,
+	14, 0,
+	21, 0,
+	22, 0,
+	-2, 21,
+	-1, 63,
+	11, 0,
+	12, 0,
+	13, 0,
+	14, 0,
+	21, 0,
+	22, 0,
+	-2, 22,
 }
 
 const yyPrivate = 57344
 
-const yyLast = 80
+const yyLast = 570
 
 var yyAct = [...]int8{
-	2, 19, 16, 1, 0, 0, 17, 18, 0, 20,
-	21, 22, 23, 24, 25, 26, 27, 28, 0, 16,
-	29, 10, 11, 12, 13, 14, 15, 32, 0, 31,
-	0, 0, 16, 33, 10, 11, 12, 13, 14, 15,
-	0, 16, 34, 10, 11, 12, 13, 14, 15, 0,
-	0, 30, 3, 4, 7, 16, 5, 6, 0, 12,
-	13, 14, 15, 8, 16, 9, 10, 11, 12, 13,
-	14, 15, 16, 0, 10, 11, 12, 13, 14, 15,
+	10, 87, 72, 69, 4, 39, 96, 95, 82, 82,
+	84, 41, 42, 43, 89, 86, 82, 82, 83, 21,
+	82, 46, 81, 68, 82, 4, 51, 52, 53, 54,
+	55, 56, 57, 58, 59, 60, 61, 62, 63, 64,
+	65, 66, 39, 39, 39, 28, 67, 39, 76, 48,
+	47, 78, 39, 39, 39, 39, 39, 39, 39, 39,
+	39, 39, 39, 39, 39, 39, 39, 39, 70, 74,
+	39, 80, 79, 45, 44, 40, 3, 85, 1, 39,
+	2, 39, 6, 38, 0, 0, 90, 0, 0, 92,
+	0, 39, 94, 39, 0, 39, 0, 0, 50, 39,
+	0, 98, 0, 49, 0, 0, 0, 0, 91, 0,
+	0, 93, 12, 13, 16, 37, 14, 0, 15, 30,
+	32, 33, 34, 35, 36, 18, 19, 20, 0, 29,
+	31, 23, 24, 25, 26, 27, 0, 17, 0, 28,
+	0, 0, 0, 97, 12, 13, 16, 37, 14, 0,
+	15, 30, 32, 33, 34, 35, 36, 18, 19, 20,
+	0, 29, 31, 23, 24, 25, 26, 27, 0, 17,
+	0, 28, 0, 0, 0, 88, 12, 13, 16, 37,
+	14, 0, 15, 30, 32, 33, 34, 35, 36, 18,
+	19, 20, 0, 29, 31, 23, 24, 25, 26, 27,
+	0, 17, 0, 28, 0, 99, 12, 13, 16, 37,
+	14, 0, 15, 30, 32, 33, 34, 35, 36, 18,
+	19, 20, 0, 29, 31, 23, 24, 25, 26, 27,
+	0, 17, 0, 28, 0, 77, 12, 13, 16, 37,
+	14, 0, 15, 30, 32, 33, 34, 35, 36, 18,
+	19, 20, 22, 29, 31, 23, 24, 25, 26, 27,
+	0, 17, 0, 28, 12, 13, 16, 37, 14, 0,
+	15, 30, 32, 33, 34, 35, 36, 18, 19, 20,
+	0, 29, 31, 23, 24, 25, 26, 27, 0, 17,
+	0, 28, 12, 13, 16, 37, 14, 0, 15, 30,
+	32, 33, 34, 35, 0, 18, 19, 20, 0, 29,
+	31, 23, 24, 25, 26, 27, 0, 17, 0, 28,
+	12, 13, 16, 37, 14, 0, 15, 30, 32, 33,
+	34, 0, 0, 18, 19, 20, 0, 29, 31, 23,
+	24, 25, 26, 27, 0, 17, 0, 28, 12, 73,
+	16, 11, 14, 0, 15, 0, 0, 0, 0, 0,
+	0, 18, 19, 20, 0, 0, 0, 7, 8, 0,
+	0, 0, 0, 17, 0, 0, 0, 75, 9, 12,
+	73, 16, 11, 14, 0, 15, 0, 0, 0, 0,
+	0, 0, 18, 19, 20, 0, 0, 0, 7, 8,
+	0, 0, 0, 0, 17, 0, 0, 0, 71, 9,
+	12, 13, 16, 11, 14, 5, 15, 0, 0, 0,
+	0, 0, 0, 18, 19, 20, 0, 0, 0, 7,
+	8, 0, 0, 0, 0, 17, 0, 0, 0, 0,
+	9, 12, 13, 16, 11, 14, 0, 15, 0, 0,
+	0, 0, 0, 0, 18, 19, 20, 0, 0, 0,
+	7, 8, 0, 0, 0, 0, 17, 0, 0, 0,
+	0, 9, 12, 13, 16, 37, 14, 0, 15, 0,
+	0, 0, 0, 0, 0, 18, 19, 20, 0, 0,
+	0, 23, 24, 25, 26, 27, 0, 17, 0, 28,
+	12, 13, 16, 37, 14, 0, 15, 0, 0, 0,
+	0, 0, 0, 18, 19, 20, 0, 0, 0, 0,
+	0, 25, 26, 27, 0, 17, 0, 28, 12, 13,
+	16, 0, 14, 0, 15, 0, 0, 0, 0, 0,
+	0, 18, 19, 20, 12, 13, 16, 11, 14, 0,
+	15, 0, 0, 17, 0, 28, 0, 18, 19, 20,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 17,
 }
 
 var yyPact = [...]int16{
-	47, -1000, 57, -1000, -1000, 47, 47, -15, 47, 47,
-	47, 47, 47, 47, 47, 47, 47, -5, -5, 47,
-	34, 65, 48, 48, -5, -5, -5, -5, -5, 12,
-	-1000, -1000, 47, 25, -1000,
+	406, -32768, -13, -32768, 232, 46, -32768, 437, 437, 437,
+	-32768, 45, -32768, -32768, -32768, -32768, 44, 437, 21, 20,
+	540, 406, 437, 437, 437, 437, 437, 437, 437, 437,
+	437, 437, 437, 437, 437, 437, 437, 437, -32768, 15,
+	437, 14, 14, 14, 375, 344, 202, 437, 437, -32768,
+	-32768, 260, 496, 496, 524, 524, 524, 14, 468, 468,
+	468, 468, 468, 468, 316, 288, 524, 437, -11, 260,
+	-15, -32768, -25, 57, -18, -32768, -34, -32768, 140, -19,
+	14, -32768, 437, -32768, 437, 437, -32768, 437, 437, -32768,
+	260, -26, 260, -27, 108, -32768, -32768, 437, 172, -32768,
 }
 
 var yyPgo = [...]int8{
-	0, 0, 3,
+	0, 3, 82, 0, 83, 2, 23, 76, 80, 78,
 }
 
 var yyR1 = [...]int8{
-	0, 2, 1, 1, 1, 1, 1, 1, 1, 1,
-	1, 1, 1, 1, 1, 1,
+	0, 9, 9, 8, 8, 7, 7, 1, 1, 1,
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+	1, 1, 1, 1, 1, 1, 1, 2, 2, 2,
+	2, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 5, 6, 6, 4, 4,
 }
 
 var yyR2 = [...]int8{
-	0, 3, 1, 1, 3, 3, 3, 3, 3, 3,
-	2, 2, 3, 4, 6, 3,
+	0, 1, 2, 1, 3, 3, 4, 1, 3, 3,
+	3, 3, 3, 3, 2, 2, 2, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 2, 1, 4, 3,
+	6, 1, 1, 1, 1, 4, 3, 6, 3, 8,
+	4, 2, 3, 1, 3, 1, 3,
 }
 
 var yyChk = [...]int16{
-	-1000, -2, -1, 5, 6, 9, 10, 7, 16, 8,
-	9, 10, 11, 12, 13, 14, 7, -1, -1, 16,
-	-1, -1, -1, -1, -1, -1, -1, -1, -1, -1,
-	17, 17, 15, -1, 17,
+	-32768, -9, -8, -7, -1, 9, -2, 23, 24, 34,
+	-3, 7, 4, 5, 8, 10, 6, 29, 17, 18,
+	19, 32, 20, 23, 24, 25, 26, 27, 31, 21,
+	11, 22, 12, 13, 14, 15, 16, 7, -4, -3,
+	29, -1, -1, -1, 29, 29, -1, 29, 29, -2,
+	-7, -1, -1, -1, -1, -1, -1, -1, -1, -1,
+	-1, -1, -1, -1, -1, -1, -1, 31, -6, -1,
+	-6, 33, -5, 5, -6, 33, -5, 33, -1, -6,
+	-1, 33, 35, 33, 35, 20, 33, 35, 35, 33,
+	-1, -6, -1, -6, -1, 33, 33, 35, -1, 33,
 }
 
 var yyDef = [...]int8{
-	0, -2, 0, 2, 3, 0, 0, 0, 0, 0,
-	0, 0, 0, 0, 0, 0, 0, 10, 11, 0,
-	0, 1, 4, 5, 6, 7, 8, 9, 12, 0,
-	15, 13, 0, 0, 14,
+	0, -2, 1, 3, 0, 0, 7, 0, 0, 0,
+	27, 0, 31, 32, 33, 34, 0, 0, 0, 0,
+	0, 2, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 26, 45,
+	0, 14, 15, 16, 0, 0, 0, 0, 0, 41,
+	4, 5, 8, 9, 10, 11, 12, 13, -2, -2,
+	-2, -2, -2, -2, 23, 24, 25, 0, 0, 43,
+	0, 29, 0, 32, 0, 36, 0, 38, 0, 0,
+	46, 6, 0, 28, 0, 0, 35, 0, 0, 40,
+	44, 0, 42, 0, 0, 30, 37, 0, 0, 39,
 }
 
 var yyTok1 = [...]int8{
 	1, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 3, 3, 3, 3, 13, 3, 3,
-	16, 17, 11, 9, 15, 10, 3, 12, 3, 3,
-	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 8, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 34, 3, 3, 3, 27, 3, 3,
+	29, 33, 25, 23, 35, 24, 3, 26, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 32,
+	21, 20, 22, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 3, 14,
+	3, 3, 3, 3, 31,
 }
 
 var yyTok2 = [...]int8{
-	2, 3, 4, 5, 6, 7,
+	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
+	12, 13, 14, 15, 16, 17, 18, 19, 28, 30,
 }
 
 var yyTok3 = [...]int8{
@@ -165,7 +320,7 @@ func yyNewParser() yyParser {
 	return &yyParserImpl{}
 }
 
-const yyFlag = -1000
+const yyFlag = -32768
 
 func yyTokname(c int) string {
 	if c >= 1 && c-1 < len(yyToknames) {
@@ -464,95 +619,263 @@ yydefault:
 	switch yynt {
 
 	case 1:
-		yyDollar = yyS[yypt-3 : yypt+1]
-//line calc.y:27
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line calc.y:39
 		{
-			yyResult = &Function{Equals: &Equals{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}}
+			yylex.(*CalcLexer).result = yylex.(*CalcLexer).program(yyDollar[1].statements)
 		}
 	case 2:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line calc.y:30
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line calc.y:40
 		{
-			yyVAL.expr = &Const{Value: yyDollar[1].float}
+			yylex.(*CalcLexer).result = yylex.(*CalcLexer).program(yyDollar[1].statements)
 		}
 	case 3:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line calc.y:31
+//line calc.y:43
 		{
-			yyVAL.expr = &Var{Var: yyDollar[1].s}
+			yyVAL.statements = []Expression{yyDollar[1].statement}
 		}
 	case 4:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line calc.y:32
+//line calc.y:44
 		{
-			yyVAL.expr = &Plus{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}
+			yyVAL.statements = append(yyDollar[1].statements, yyDollar[3].statement)
 		}
 	case 5:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line calc.y:33
+//line calc.y:47
 		{
-			yyVAL.expr = &Subtract{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}
+			yyVAL.statement = &Equals{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}
 		}
 	case 6:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line calc.y:48
+		{
+			yyVAL.statement = &Colour{Name: yyDollar[1].s, Channels: yyDollar[3].exprs}
+		}
+	case 8:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line calc.y:52
+		{
+			yyVAL.expr = &Plus{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}
+		}
+	case 9:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line calc.y:53
+		{
+			yyVAL.expr = &Subtract{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}
+		}
+	case 10:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line calc.y:34
+//line calc.y:54
 		{
 			yyVAL.expr = &Multiply{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}
 		}
-	case 7:
+	case 11:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line calc.y:35
+//line calc.y:55
 		{
 			yyVAL.expr = &Divide{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}
 		}
-	case 8:
+	case 12:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line calc.y:36
+//line calc.y:56
 		{
 			yyVAL.expr = &Modulus{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}
 		}
-	case 9:
+	case 13:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line calc.y:37
+//line calc.y:57
 		{
 			yyVAL.expr = &Power{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}
 		}
-	case 10:
+	case 14:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line calc.y:38
+//line calc.y:58
 		{
 			yyVAL.expr = yyDollar[2].expr
 		}
-	case 11:
+	case 15:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line calc.y:39
+//line calc.y:59
 		{
 			yyVAL.expr = &Negate{Expr: yyDollar[2].expr}
 		}
-	case 12:
+	case 16:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line calc.y:60
+		{
+			yyVAL.expr = &Not{Expr: yyDollar[2].expr}
+		}
+	case 17:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line calc.y:40
+//line calc.y:61
 		{
-			yyVAL.expr = &DoubleFunction{Infix: true, Name: yyDollar[2].s, Expr1: yyDollar[1].expr, Expr2: yyDollar[3].expr}
+			yyVAL.expr = &LessThan{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}
 		}
-	case 13:
+	case 18:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line calc.y:62
+		{
+			yyVAL.expr = &LessOrEqual{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}
+		}
+	case 19:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line calc.y:63
+		{
+			yyVAL.expr = &GreaterThan{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}
+		}
+	case 20:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line calc.y:64
+		{
+			yyVAL.expr = &GreaterOrEqual{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}
+		}
+	case 21:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line calc.y:65
+		{
+			yyVAL.expr = &EqualTo{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}
+		}
+	case 22:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line calc.y:66
+		{
+			yyVAL.expr = &NotEqualTo{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}
+		}
+	case 23:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line calc.y:67
+		{
+			yyVAL.expr = &And{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}
+		}
+	case 24:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line calc.y:68
+		{
+			yyVAL.expr = &Or{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}
+		}
+	case 25:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line calc.y:69
+		{
+			yyVAL.expr = &NFunction{Infix: true, Name: yyDollar[2].s, Args: []Expression{yyDollar[1].expr, yyDollar[3].expr}}
+		}
+	case 26:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line calc.y:70
+		{
+			yyVAL.expr = &Multiply{LHS: yyDollar[1].expr, RHS: yyDollar[2].expr, Implicit: true}
+		}
+	case 28:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line calc.y:41
+//line calc.y:77
 		{
-			yyVAL.expr = &SingleFunction{Name: yyDollar[1].s, Expr: yyDollar[3].expr}
+			yyVAL.expr = newCall(yyDollar[1].s, yyDollar[3].exprs)
 		}
-	case 14:
+	case 29:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line calc.y:78
+		{
+			yyVAL.expr = newCall(yyDollar[1].s, nil)
+		}
+	case 30:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line calc.y:42
+//line calc.y:79
 		{
-			yyVAL.expr = &DoubleFunction{Infix: false, Name: yyDollar[1].s, Expr1: yyDollar[3].expr, Expr2: yyDollar[5].expr}
+			yyVAL.expr = newCall(yyDollar[1].s, append([]Expression{yyDollar[3].expr}, yyDollar[5].exprs...))
 		}
-	case 15:
+	case 31:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line calc.y:82
+		{
+			yyVAL.expr = &Const{Value: yyDollar[1].float}
+		}
+	case 32:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line calc.y:83
+		{
+			yyVAL.expr = &Var{Var: yyDollar[1].s}
+		}
+	case 33:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line calc.y:84
+		{
+			yyVAL.expr = newNamedConstant(yyDollar[1].s)
+		}
+	case 34:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line calc.y:85
+		{
+			yyVAL.expr = newStringLiteral(yyDollar[1].s)
+		}
+	case 35:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line calc.y:86
+		{
+			yyVAL.expr = newCall(yyDollar[1].s, yyDollar[3].exprs)
+		}
+	case 36:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line calc.y:43
+//line calc.y:87
+		{
+			yyVAL.expr = newCall(yyDollar[1].s, nil)
+		}
+	case 37:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line calc.y:88
+		{
+			yyVAL.expr = newCall(yyDollar[1].s, append([]Expression{yyDollar[3].expr}, yyDollar[5].exprs...))
+		}
+	case 38:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line calc.y:89
 		{
 			yyVAL.expr = &Brackets{Expr: yyDollar[2].expr}
 		}
+	case 39:
+		yyDollar = yyS[yypt-8 : yypt+1]
+//line calc.y:90
+		{
+			yyVAL.expr = &If{Condition: yyDollar[3].expr, Then: yyDollar[5].expr, Else: yyDollar[7].expr}
+		}
+	case 40:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line calc.y:91
+		{
+			yyVAL.expr = NewPiecewise(yyDollar[3].exprs)
+		}
+	case 41:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line calc.y:92
+		{
+			yyVAL.expr = newCall("Sqrt", []Expression{removeBrackets(yyDollar[2].expr)})
+		}
+	case 42:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line calc.y:96
+		{
+			yyVAL.expr = &Equals{LHS: &Var{Var: yyDollar[1].s}, RHS: yyDollar[3].expr}
+		}
+	case 43:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line calc.y:99
+		{
+			yyVAL.exprs = []Expression{yyDollar[1].expr}
+		}
+	case 44:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line calc.y:100
+		{
+			yyVAL.exprs = append(yyDollar[1].exprs, yyDollar[3].expr)
+		}
+	case 46:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line calc.y:106
+		{
+			yyVAL.expr = &Power{LHS: yyDollar[1].expr, RHS: yyDollar[3].expr}
+		}
 	}
 	goto yystack /* stack new state and value */
 }
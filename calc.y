@@ -2,45 +2,108 @@
 package heatPlot;
 
 import __yyfmt__ "fmt"
-
-var yyResult *Function
 %}
 
-%token<expr> Highest
 %token<float> FLOAT
-%token<s> VAR FUNCNAME
-%type<expr> expr
+%token<s> VAR FUNCNAME INFIXNAME CONSTNAME COLOUR STRING
+%token LE GE EQ NE AND OR IF PIECEWISE ROOT
+%type<expr> expr operand primary implicit index
+%type<exprs> exprs
+%type<statement> statement
+%type<statements> statements
 
 %union {
     float float64
     s string
     expr Expression
+    exprs []Expression
+    statement Expression
+    statements []Expression
  }
 
+/* Lowest to highest. Named infix functions such as "x max y" bind like '*', a juxtaposition such as "2x" binds tighter
+   than both, then the unary operators and finally '^' so that "-x^2" is "-(x^2)". '^' is right associative so that
+   "2^3^2" is "2^(3^2)". */
 %right '='
+%left OR
+%left AND
+%nonassoc '<' '>' LE GE EQ NE
 %left '+' '-'
-%left '*' '/' '%' '^' ','
-%right Highest FUNCNAME
+%left '*' '/' '%' INFIXNAME
+%left IMPLICIT FLOAT VAR CONSTNAME FUNCNAME IF PIECEWISE ROOT STRING '('
+%right UNARY
+%right '^'
 
 %%
 input
-    : expr '=' expr { yyResult = &Function{ Equals: &Equals { LHS: $1, RHS: $3 } } }
+    : statements        { yylex.(*CalcLexer).result = yylex.(*CalcLexer).program($1) }
+    | statements ';'    { yylex.(*CalcLexer).result = yylex.(*CalcLexer).program($1) }
     ;
 
-expr: FLOAT             { $$ = &Const{Value: $1} }
-    | VAR               { $$ = &Var{ Var: $1 } }
+statements: statement   { $$ = []Expression{ $1 } }
+    | statements ';' statement { $$ = append($1, $3) }
+    ;
+
+statement: expr '=' expr { $$ = &Equals{ LHS: $1, RHS: $3 } }
+    | COLOUR '(' exprs ')'    { $$ = &Colour{ Name: $1, Channels: $3 } }
+    ;
+
+expr: operand
     | expr '+' expr     { $$ = &Plus{ LHS: $1, RHS: $3, } }
     | expr '-' expr     { $$ = &Subtract{ LHS: $1, RHS: $3, } }
     | expr '*' expr     { $$ = &Multiply{ LHS: $1, RHS: $3, } }
     | expr '/' expr     { $$ = &Divide{ LHS: $1, RHS: $3, } }
     | expr '%' expr     { $$ = &Modulus{ LHS: $1, RHS: $3, } }
     | expr '^' expr     { $$ = &Power{ LHS: $1, RHS: $3, } }
-    | '+' expr  %prec Highest    { $$ = $2 }
-    | '-' expr  %prec Highest    { $$ = &Negate{ Expr: $2 } }
-    | expr FUNCNAME expr     { $$ = &DoubleFunction{ Infix: true, Name: $2, Expr1: $1, Expr2: $3, } }
-    | FUNCNAME '(' expr ')'  { $$ = &SingleFunction{ Name: $1, Expr: $3 } }
-    | FUNCNAME '(' expr ',' expr ')' { $$ = &DoubleFunction{ Infix: false, Name: $1, Expr1: $3, Expr2: $5 } }
+    | '+' expr  %prec UNARY    { $$ = $2 }
+    | '-' expr  %prec UNARY    { $$ = &Negate{ Expr: $2 } }
+    | '!' expr  %prec UNARY    { $$ = &Not{ Expr: $2 } }
+    | expr '<' expr     { $$ = &LessThan{ LHS: $1, RHS: $3, } }
+    | expr LE expr      { $$ = &LessOrEqual{ LHS: $1, RHS: $3, } }
+    | expr '>' expr     { $$ = &GreaterThan{ LHS: $1, RHS: $3, } }
+    | expr GE expr      { $$ = &GreaterOrEqual{ LHS: $1, RHS: $3, } }
+    | expr EQ expr      { $$ = &EqualTo{ LHS: $1, RHS: $3, } }
+    | expr NE expr      { $$ = &NotEqualTo{ LHS: $1, RHS: $3, } }
+    | expr AND expr     { $$ = &And{ LHS: $1, RHS: $3, } }
+    | expr OR expr      { $$ = &Or{ LHS: $1, RHS: $3, } }
+    | expr INFIXNAME expr     { $$ = &NFunction{ Infix: true, Name: $2, Args: []Expression{ $1, $3 }, } }
+    | expr implicit  %prec IMPLICIT  { $$ = &Multiply{ LHS: $1, RHS: $2, Implicit: true, } }
+    ;
+
+/* A function which can be written between its 2 arguments, such as max, is INFIXNAME wherever it is. It is called
+   the usual way where an operand starts, as in "max(x, 2)", but after an expression it is infix, so "x max (2)" is
+   max(x, 2) and not "x * max(2)" as a juxtaposition. */
+operand: primary
+    | INFIXNAME '(' exprs ')'  { $$ = newCall($1, $3) }
+    | INFIXNAME '(' ')'        { $$ = newCall($1, nil) }
+    | INFIXNAME '(' index ',' exprs ')'  { $$ = newCall($1, append([]Expression{ $3 }, $5...)) }
+    ;
+
+primary: FLOAT          { $$ = &Const{Value: $1} }
+    | VAR               { $$ = &Var{ Var: $1 } }
+    | CONSTNAME         { $$ = newNamedConstant($1) }
+    | STRING            { $$ = newStringLiteral($1) }
+    | FUNCNAME '(' exprs ')'  { $$ = newCall($1, $3) }
+    | FUNCNAME '(' ')'        { $$ = newCall($1, nil) }
+    | FUNCNAME '(' index ',' exprs ')'  { $$ = newCall($1, append([]Expression{ $3 }, $5...)) }
     | '(' expr ')'            { $$ = &Brackets{ Expr: $2 } }
+    | IF '(' expr ',' expr ',' expr ')' { $$ = &If{ Condition: $3, Then: $5, Else: $7 } }
+    | PIECEWISE '(' exprs ')' { $$ = NewPiecewise($3) }
+    | ROOT operand            { $$ = newCall("Sqrt", []Expression{ removeBrackets($2) }) }
+    ;
+
+/* The index of a sum or prod and its first value, as in "sum(k = 1, 20, sin(k x) / k)", checked by the call. */
+index: VAR '=' expr     { $$ = &Equals{ LHS: &Var{ Var: $1 }, RHS: $3 } }
+    ;
+
+exprs: expr             { $$ = []Expression{ $1 } }
+    | exprs ',' expr    { $$ = append($1, $3) }
+    ;
+
+/* The right hand side of a juxtaposition, it can't start with a sign so that "x - 1" stays a subtraction, but it can
+   be raised to a power so that "2x^2" is "2 * (x ^ 2)". */
+implicit: primary  %prec IMPLICIT
+    | primary '^' expr        { $$ = &Power{ LHS: $1, RHS: $3, } }
     ;
 
 %%
@@ -19,19 +19,219 @@ func TestEndToEndParser(t *testing.T) {
 		"y / 4 = x mod 2 * 2",
 		"y / 4 = mod(x, 3) * 2",
 		"y / 4 = abs(x) + 2 * 2",
+		"y / 4 = 2x + 1",
+		"y / 4 = (x + 1)(x - 1)",
+		"y / 4 = 3 sin(x)",
+		"y = x pow (2)",
+		"y = x atan2 (y)",
+		"y = 2 * x mod (3)",
+		"y = x max (3 max 4)",
+		"y = max(x, 3) mod (2)",
 	} {
 		t.Run(fmt.Sprintf("%d: %s", eachI, each), func(t *testing.T) {
 			parser := yyNewParser()
-			yyResult = nil
-			r := parser.Parse(NewCalcLexer(each))
+			lexer := NewCalcLexer(each).(*CalcLexer)
+			r := parser.Parse(lexer)
 			t.Logf("Result %d for %#v", r, each)
-			if yyResult == nil {
+			if lexer.result == nil {
 				t.Logf("Error; no result returned %#v", parser)
 				t.Fail()
-			} else if yyResult.String() != each {
-				t.Logf("Failed to match %v with %v", yyResult.String(), each)
+			} else if lexer.result.String() != each {
+				t.Logf("Failed to match %v with %v", lexer.result.String(), each)
 				t.Fail()
 			}
 		})
 	}
 }
+
+func TestImplicitMultiplication(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula  string
+		Explicit string
+	}{
+		{Formula: "y = 2x", Explicit: "y = 2 * x"},
+		{Formula: "y = 3 sin(t)", Explicit: "y = 3 * sin(t)"},
+		{Formula: "y = (x + 1)(y - 1)", Explicit: "y = (x + 1) * (y - 1)"},
+		{Formula: "y = 2(x + 1)", Explicit: "y = 2 * (x + 1)"},
+		{Formula: "y = x y", Explicit: "y = x * y"},
+		{Formula: "y = 2 x ^ 2", Explicit: "y = 2 * (x ^ 2)"},
+		{Formula: "y = -2x", Explicit: "y = (-2) * x"},
+		{Formula: "y = 1 - 2x", Explicit: "y = 1 - (2 * x)"},
+		{Formula: "y = x - 2", Explicit: "y = x - 2"},
+		{Formula: "y = x ^ 2y", Explicit: "y = (x ^ 2) * y"},
+		{Formula: "y = 4 / 2x", Explicit: "y = 4 / (2 * x)"},
+		{Formula: "y = 2x mod 3", Explicit: "y = (2 * x) mod 3"},
+		{Formula: "y = 2x sin(t)(y + 1)", Explicit: "y = ((2 * x) * sin(t)) * (y + 1)"},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.String() != each.Formula {
+				t.Errorf("Failed to match %v with %v", f.String(), each.Formula)
+			}
+			explicit, err := ParseFunctionE(each.Explicit)
+			if err != nil {
+				t.Fatalf("Parse of explicit form failed: %v", err)
+			}
+			for _, p := range [][3]float64{{3, 5, 7}, {-1.5, 2, 1}, {0.25, -4, 12}} {
+				got, _, _ := f.Evaluate(p[0], p[1], p[2])
+				expected, _, _ := explicit.Evaluate(p[0], p[1], p[2])
+				if got != expected {
+					t.Errorf("At %v got %v expected %v", p, got, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestInfixBrackets(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula string
+		Prefix  string
+	}{
+		{Formula: "y = x pow (2)", Prefix: "y = pow(x, 2)"},
+		{Formula: "x atan2 (y) = 1", Prefix: "atan2(x, y) = 1"},
+		{Formula: "y = 2 * x mod (3)", Prefix: "y = mod(2 * x, 3)"},
+		{Formula: "y = x max (3 max 4)", Prefix: "y = max(x, max(3, 4))"},
+		{Formula: "y = x max max(3, 4)", Prefix: "y = max(x, max(3, 4))"},
+		{Formula: "y = 2 sin(x) pow (2)", Prefix: "y = pow(2 * sin(x), 2)"},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.String() != each.Formula {
+				t.Errorf("Failed to match %v with %v", f.String(), each.Formula)
+			}
+			reparsed, err := ParseFunctionE(f.String())
+			if err != nil {
+				t.Fatalf("Reparse failed: %v", err)
+			}
+			prefix, err := ParseFunctionE(each.Prefix)
+			if err != nil {
+				t.Fatalf("Parse of prefix form failed: %v", err)
+			}
+			for _, p := range [][3]float64{{3, 4, 0}, {-1.5, 2, 1}, {0.25, -4, 12}} {
+				got, _, _ := f.Evaluate(p[0], p[1], p[2])
+				again, _, _ := reparsed.Evaluate(p[0], p[1], p[2])
+				expected, _, _ := prefix.Evaluate(p[0], p[1], p[2])
+				if got != expected || again != expected {
+					t.Errorf("At %v got %v and %v reparsed expected %v", p, got, again, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestImplicitMultiplicationString(t *testing.T) {
+	for _, each := range []struct {
+		Expr     *Multiply
+		Expected string
+	}{
+		{Expr: &Multiply{LHS: &Const{Value: 2}, RHS: &Var{Var: "x"}, Implicit: true}, Expected: "2x"},
+		{Expr: &Multiply{LHS: &Const{Value: 0}, RHS: &Var{Var: "x"}, Implicit: true}, Expected: "0 x"},
+		{Expr: &Multiply{LHS: &Const{Value: 10}, RHS: &Var{Var: "x"}, Implicit: true}, Expected: "10x"},
+		{Expr: &Multiply{LHS: &Const{Value: 2}, RHS: &Var{Var: "e1"}, Implicit: true}, Expected: "2 e1"},
+		{Expr: &Multiply{LHS: &Const{Value: 1e21}, RHS: &Var{Var: "x"}, Implicit: true}, Expected: "1e+21x"},
+		{Expr: &Multiply{LHS: &Var{Var: "x"}, RHS: &Var{Var: "y"}, Implicit: true}, Expected: "x y"},
+	} {
+		if s := each.Expr.String(); s != each.Expected {
+			t.Errorf("Got %#v expected %#v", s, each.Expected)
+		}
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula  string
+		Expected float64
+	}{
+		// Arithmetic
+		{Formula: "2 + 3 * 4", Expected: 14},
+		{Formula: "(2 + 3) * 4", Expected: 20},
+		{Formula: "2 * 3 + 4", Expected: 10},
+		{Formula: "10 - 4 - 3", Expected: 3},
+		{Formula: "10 - (4 - 3)", Expected: 9},
+		{Formula: "100 / 10 / 5", Expected: 2},
+		{Formula: "100 / (10 / 5)", Expected: 50},
+		{Formula: "12 / 3 * 2", Expected: 8},
+		{Formula: "12 - 3 + 2", Expected: 11},
+		{Formula: "7 % 4 * 2", Expected: 6},
+		{Formula: "2 * 7 % 4", Expected: 2},
+		{Formula: "1 + 7 % 4", Expected: 4},
+		// Powers
+		{Formula: "2 * 3 ^ 2", Expected: 18},
+		{Formula: "3 ^ 2 * 2", Expected: 18},
+		{Formula: "2 ^ 3 ^ 2", Expected: 512},
+		{Formula: "(2 ^ 3) ^ 2", Expected: 64},
+		{Formula: "2 ^ 2 ^ 2 ^ 2", Expected: 65536},
+		{Formula: "18 / 3 ^ 2", Expected: 2},
+		{Formula: "1 + 2 ^ 2", Expected: 5},
+		// Unary operators
+		{Formula: "-2 ^ 2", Expected: -4},
+		{Formula: "(-2) ^ 2", Expected: 4},
+		{Formula: "-x ^ 2", Expected: -9},
+		{Formula: "2 ^ -1", Expected: 0.5},
+		{Formula: "2 ^ -1 ^ 2", Expected: 0.5},
+		{Formula: "3 - -2", Expected: 5},
+		{Formula: "2 * -3", Expected: -6},
+		{Formula: "-2 * 3 + 10", Expected: 4},
+		{Formula: "+2 - 3", Expected: -1},
+		{Formula: "!0 + 1", Expected: 2},
+		{Formula: "!1 * 5 + 1", Expected: 1},
+		// Juxtaposition
+		{Formula: "2x + 1", Expected: 7},
+		{Formula: "2x ^ 2", Expected: 18},
+		{Formula: "-2x", Expected: -6},
+		{Formula: "6 / 2x", Expected: 1},
+		{Formula: "6 / 2(1 + 2)", Expected: 1},
+		{Formula: "2(x + 1)", Expected: 8},
+		{Formula: "(x)(x + 1)", Expected: 12},
+		{Formula: "x ^ 2y", Expected: 18},
+		{Formula: "2 sin(0) + 1", Expected: 1},
+		// Named infix functions
+		{Formula: "2 max 3 + 1", Expected: 4},
+		{Formula: "1 + 2 max 3", Expected: 4},
+		{Formula: "2 * 5 max 3", Expected: 10},
+		{Formula: "5 max 3 * 2", Expected: 10},
+		{Formula: "2 ^ 3 max 10", Expected: 10},
+		{Formula: "-2 max 1", Expected: 1},
+		{Formula: "8 min 4 max 6", Expected: 6},
+		{Formula: "10 pow 2 - 1", Expected: 99},
+		// Comparisons and logic
+		{Formula: "1 + 1 == 2", Expected: 1},
+		{Formula: "2 * 3 > 5", Expected: 1},
+		{Formula: "-3 < -2", Expected: 1},
+		{Formula: "1 || 0 && 0", Expected: 1},
+		{Formula: "(1 || 0) && 0", Expected: 0},
+		{Formula: "x > 2 && y > 2", Expected: 0},
+		{Formula: "x > 2 || y > 2", Expected: 1},
+		{Formula: "!(x > 2)", Expected: 0},
+		{Formula: "(x > 2) * 5 + 1", Expected: 6},
+		// Functions
+		{Formula: "sqrt(16) ^ 2", Expected: 16},
+		{Formula: "abs(-2) ^ 2", Expected: 4},
+		{Formula: "-abs(-2)", Expected: -2},
+		{Formula: "max(1, 2) * min(3, 4)", Expected: 6},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseFunctionE("0 = " + each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if w, _, _ := f.Evaluate(3, 2, 0); w != each.Expected {
+				t.Errorf("Got %v expected %v", w, each.Expected)
+			}
+			reparsed, err := ParseFunctionE(f.String())
+			if err != nil {
+				t.Fatalf("Reparse of %v failed: %v", f.String(), err)
+			}
+			if w, _, _ := reparsed.Evaluate(3, 2, 0); w != each.Expected {
+				t.Errorf("Reparsed as %v got %v expected %v", f.String(), w, each.Expected)
+			}
+		})
+	}
+}
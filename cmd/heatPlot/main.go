@@ -2,9 +2,15 @@ package main
 
 import (
 	"bitbucket.org/arran4/heatplot"
+	"errors"
 	"flag"
+	"fmt"
+	"image"
+	"image/png"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -13,11 +19,22 @@ var (
 	speed           = flag.Duration("speed", 100*time.Millisecond, "The number of microseconds to wait between each frame")
 	pointSize       = flag.Float64("pointSize", .1, "How many x or y steps a pixel is. Ie .1 will mean that every 10 unscaled pixels is 1 normal step")
 	scale           = flag.Int("scale", 4, "Magnification of the picture")
-	timeLowerBound  = flag.Int("tlb", 0, "where to start T")
-	timeUpperBound  = flag.Int("tub", 100, "Where to end t")
+	timeLowerBound  = flag.Float64("tlb", 0, "where to start T")
+	timeUpperBound  = flag.Float64("tub", 100, "Where to end t")
+	timeStep        = flag.Float64("tstep", 1, "How much t goes up by each frame, such as 0.05 for slow motion")
 	size            = flag.Int("size", 100, "The size for each direction in the cartesian plane. Ie 100 would be -100 to 100 on the x and y axis")
 	outputFile      = flag.String("outputFile", "./out.gif", "The output filename")
 	footerText      = flag.String("footerText", "https://github.com/arran4/heatplot", "Text to put at the bottom of the picture")
+	complexMode     = flag.Bool("complex", false, "Evaluate the formula over complex numbers, z = x + iy, and draw it with domain colouring")
+	hues            = flag.Int("hues", 24, "Complex mode only. The number of hues the argument is split into. hues * shades can't exceed 253")
+	shades          = flag.Int("shades", 10, "Complex mode only. The number of brightnesses the modulus is split into. hues * shades can't exceed 253")
+	seed            = flag.Int64("seed", 0, "Seed for rand() and gauss(), the same seed draws the same picture")
+	boundary        = flag.String("boundary", "clamp", "What prev reads beyond the edges of the previous frame: clamp, wrap or zero")
+	ruleSpec        = flag.String("rule", "", "Run a cellular automaton with this rule, such as B3/S23, R5,C0,M1,S34..58,B34..45,NM or a formula using prev, disc and ring. The formula given is then the first generation")
+	rleFile         = flag.String("rle", "", "Run a cellular automaton starting with the pattern in this RLE file. The formula given, if any, is the rule, otherwise -rule or the rule in the file")
+	pretty          = flag.Bool("pretty", false, "Write the formula above each frame with mathematical notation, such as × for * and x² for x ^ 2")
+	generations     = flag.Int("generations", 100, "Cellular automata only. How many generations to draw, the first included")
+	images          = flag.String("images", ".", "The directory img reads image files from, files outside it can't be read")
 )
 
 func init() {
@@ -26,15 +43,150 @@ func init() {
 
 func main() {
 	flag.Parse()
+	if *ruleSpec != "" || *rleFile != "" {
+		runAutomaton()
+		return
+	}
 	if flag.NArg() == 0 {
 		log.Print("Please include the formula after the command you can use x y and t (t for time) in any way you wish")
 		return
 	}
+	parser := heatPlot.NewParser()
+	parser.ImageDir = *images
+	parse := parser.Parse
+	if *complexMode {
+		parse = parser.ParseComplex
+	}
+	function, err := parse(flag.Arg(0))
+	if err != nil {
+		exit(err)
+	}
+	function.Seed = *seed
+	function.PrettyHeading = *pretty
+	if function.Boundary, err = heatPlot.ParseBoundary(*boundary); err != nil {
+		exit(err)
+	}
+	if function.Colour != nil {
+		writeColourFrames(function)
+		return
+	}
 	w, err := os.OpenFile(*outputFile, os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
 		log.Panic(err)
 	}
 	defer w.Close()
-	heatPlot.ParseRunAndDrawFunction(flag.Arg(0), w, *size, *timeLowerBound, *timeUpperBound, *scale, *heatColourCount, *pointSize, *speed, *footerText)
+	if *complexMode {
+		function.PlotAndDrawComplex(w, *size, *timeLowerBound, *timeUpperBound, *timeStep, *scale, *hues, *shades, *pointSize, *speed, *footerText)
+	} else {
+		function.PlotAndDraw(w, *size, *timeLowerBound, *timeUpperBound, *timeStep, *scale, *heatColourCount, *pointSize, *speed, *footerText)
+	}
+	log.Printf("Done see %s", *outputFile)
+}
+
+// exit reports err, with a diagnostic when it is a parse error, and exits.
+func exit(err error) {
+	var pe *heatPlot.ParseError
+	if errors.As(err, &pe) {
+		fmt.Fprint(os.Stderr, pe.Diagnostic())
+	} else {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	os.Exit(1)
+}
+
+// runAutomaton draws the generations of a cellular automaton. The first is the RLE file when there is one, otherwise
+// the formula.
+func runAutomaton() {
+	plotSize := image.Rect(-*size, -*size, *size, *size)
+	spec := *ruleSpec
+	var first *heatPlot.Plot
+	if *rleFile != "" {
+		pattern, err := readPattern(*rleFile)
+		if err != nil {
+			exit(err)
+		}
+		first = pattern.Plot(plotSize)
+		if spec == "" && flag.NArg() > 0 {
+			spec = flag.Arg(0)
+		} else if flag.NArg() > 0 {
+			exit(errors.New("give the rule either with -rule or as the formula, not both"))
+		}
+		if spec == "" {
+			spec = pattern.Rule
+		}
+		if spec == "" {
+			spec = "B3/S23"
+		}
+	} else {
+		if flag.NArg() == 0 {
+			log.Print("Please include a formula for the first generation after the command, such as \"0 = rand() < 0.3\", or use -rle")
+			return
+		}
+		parser := heatPlot.NewParser()
+		parser.ImageDir = *images
+		function, err := parser.Parse(flag.Arg(0))
+		if err != nil {
+			exit(err)
+		}
+		function.Seed = *seed
+		if first, _, err = function.PlotForT(plotSize, 0, *pointSize); err != nil {
+			exit(err)
+		}
+	}
+	rule, err := heatPlot.ParseRule(spec)
+	if err != nil {
+		exit(err)
+	}
+	if fr, ok := rule.(*heatPlot.FormulaRule); ok {
+		fr.Function.Seed = *seed
+		fr.Function.PrettyHeading = *pretty
+	}
+	b, err := heatPlot.ParseBoundary(*boundary)
+	if err != nil {
+		exit(err)
+	}
+	plots, err := heatPlot.Generations(rule, first, *generations, b, *pointSize)
+	if err != nil {
+		exit(err)
+	}
+	w, err := os.Create(*outputFile)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer w.Close()
+	heatPlot.RenderGenerations(*heatColourCount, plots, plotSize, *scale, rule, *footerText, *speed, w)
 	log.Printf("Done see %s", *outputFile)
 }
+
+func readPattern(fn string) (*heatPlot.Pattern, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return heatPlot.ReadRLE(f)
+}
+
+// writeColourFrames writes the true colour frames of an rgb or rgba formula as PNGs named after outputFile, numbered
+// when there is more than one.
+func writeColourFrames(function *heatPlot.Function) {
+	frames := function.PlotAndDrawColour(*size, *timeLowerBound, *timeUpperBound, *timeStep, *scale, *pointSize, *footerText)
+	base := strings.TrimSuffix(*outputFile, filepath.Ext(*outputFile))
+	for i, frame := range frames {
+		fn := base + ".png"
+		if len(frames) > 1 {
+			fn = fmt.Sprintf("%s-%04d.png", base, i)
+		}
+		w, err := os.Create(fn)
+		if err != nil {
+			log.Panic(err)
+		}
+		if err := png.Encode(w, frame); err != nil {
+			log.Panic(err)
+		}
+		if err := w.Close(); err != nil {
+			log.Panic(err)
+		}
+		log.Printf("Done see %s", fn)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"math/rand"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -16,8 +17,9 @@ var (
 	speed           = flag.Duration("speed", 100*time.Millisecond, "The number of microseconds to wait between each frame")
 	pointSize       = flag.Float64("pointSize", .1, "How many x or y steps a pixel is. Ie .1 will mean that every 10 unscaled pixels is 1 normal step")
 	scale           = flag.Int("scale", 2, "Magnification of the picture")
-	timeLowerBound  = flag.Int("tlb", 0, "where to start T")
-	timeUpperBound  = flag.Int("tub", 25, "Where to end t")
+	timeLowerBound  = flag.Float64("tlb", 0, "where to start T")
+	timeUpperBound  = flag.Float64("tub", 25, "Where to end t")
+	timeStep        = flag.Float64("tstep", 1, "How much t goes up by each frame, such as 0.05 for slow motion")
 	size            = flag.Int("size", 100, "The size for each direction in the cartesian plane. Ie 100 would be -100 to 100 on the x and y axis")
 	outputFile      = flag.String("outputFile", "./out.gif", "The output filename")
 	footerText      = flag.String("footerText", "RND", "Text to put at the bottom of the picture")
@@ -61,7 +63,7 @@ func main() {
 			continue
 		}
 		plotSize := image.Rect(-*size, -*size, *size, *size)
-		tUsed, plots := function.Plot(*timeLowerBound, *timeUpperBound, plotSize, *pointSize)
+		tUsed, plots := function.Plot(*timeLowerBound, *timeUpperBound, *timeStep, plotSize, *pointSize)
 		setCount, usedFrames, frameChanges := 0, 0, 0
 		for plotI, plot := range plots {
 			setCount += plot.Sets
@@ -90,7 +92,7 @@ func main() {
 		}
 		log.Printf("looks good making image")
 		heatPlot.RenderPlots(*heatColourCount, plots, plotSize, *scale, function, *timeUpperBound, tUsed, *footerText, *speed, w)
-		function.PlotAndDraw(w, *size, *timeLowerBound, *timeUpperBound, *scale, *heatColourCount, *pointSize, *speed, fmt.Sprintf("%s seed: %d", *footerText, seed))
+		function.PlotAndDraw(w, *size, *timeLowerBound, *timeUpperBound, *timeStep, *scale, *heatColourCount, *pointSize, *speed, fmt.Sprintf("%s seed: %d", *footerText, seed))
 		log.Printf("Done see %s", *outputFile)
 		break
 	}
@@ -99,6 +101,7 @@ func main() {
 func randomFunction(d int) *heatPlot.Function {
 	return &heatPlot.Function{
 		Equals: randomEquals(d),
+		Seed:   rng.Int63(),
 	}
 }
 
@@ -136,7 +139,7 @@ func randomConstNumber(d int) heatPlot.Expression {
 }
 
 func randomVar(d int) heatPlot.Expression {
-	vs := []string{"X", "Y", "T"}
+	vs := []string{"X", "Y", "T", "R", "THETA"}
 	v := vs[rng.Intn(len(vs))]
 	return &heatPlot.Var{
 		Var: v,
@@ -200,25 +203,27 @@ func randomBrackets(d int) heatPlot.Expression {
 }
 
 func randomActualFunction(d int) heatPlot.Expression {
-	functionName := heatPlot.FunctionNames[rng.Intn(len(heatPlot.FunctionNames))]
-	if _, ok := heatPlot.SingleFunctions[functionName]; ok {
-		return randomSingleFunction(functionName, d)
-	}
-	return randomDoubleFunction(functionName, d)
-}
-
-func randomSingleFunction(name string, d int) heatPlot.Expression {
-	return &heatPlot.SingleFunction{
+	name := heatPlot.FunctionNames[rng.Intn(len(heatPlot.FunctionNames))]
+	upper := strings.ToUpper(name)
+	args := 2
+	if _, ok := heatPlot.RandomFunctions[upper]; ok {
+		args = rng.Intn(4)
+	} else if f, ok := heatPlot.NoiseFunctions[upper]; ok {
+		args = f.Args
+	} else if _, ok := heatPlot.VariadicFunctions[upper]; ok {
+		args = rng.Intn(4) + 1
+	} else if _, ok := heatPlot.SingleFunctions[upper]; ok {
+		args = 1
+	} else if _, ok := heatPlot.NullaryFunctions[upper]; ok {
+		args = 0
+	}
+	f := &heatPlot.NFunction{
 		Name: name,
-		Expr: randomExpr(d),
+		Args: make([]heatPlot.Expression, args),
 	}
-}
-
-func randomDoubleFunction(name string, d int) heatPlot.Expression {
-	return &heatPlot.DoubleFunction{
-		Expr1: randomExpr(d),
-		Expr2: randomExpr(d),
-		Infix: rng.Intn(2) == 0,
-		Name:  name,
+	for i := range f.Args {
+		f.Args[i] = randomExpr(d)
 	}
+	f.Infix = args == 2 && rng.Intn(2) == 0
+	return f
 }
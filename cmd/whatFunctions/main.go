@@ -3,6 +3,7 @@ package main
 import (
 	heatPlot "bitbucket.org/arran4/heatplot"
 	"log"
+	"strings"
 )
 
 func main() {
@@ -10,6 +11,10 @@ func main() {
 	for _, fstr := range heatPlot.FunctionNames {
 		log.Printf("%s", fstr)
 	}
+	log.Printf("Nullary Functions: ")
+	for fstr := range heatPlot.NullaryFunctions {
+		log.Printf("%s", fstr)
+	}
 	log.Printf("Single Functions: ")
 	for fstr := range heatPlot.SingleFunctions {
 		log.Printf("%s", fstr)
@@ -18,4 +23,24 @@ func main() {
 	for fstr := range heatPlot.DoubleFunctions {
 		log.Printf("%s", fstr)
 	}
+	log.Printf("Variadic Functions: ")
+	for fstr := range heatPlot.VariadicFunctions {
+		log.Printf("%s", fstr)
+	}
+	log.Printf("Random Functions: ")
+	for fstr := range heatPlot.RandomFunctions {
+		log.Printf("%s", fstr)
+	}
+	log.Printf("Noise Functions: ")
+	for fstr, f := range heatPlot.NoiseFunctions {
+		log.Printf("%s (%d arguments)", fstr, f.Args)
+	}
+	log.Printf("Complex Functions: ")
+	for _, fstr := range heatPlot.ComplexFunctionNames {
+		log.Printf("%s", fstr)
+	}
+	log.Printf("Constants: ")
+	for _, cstr := range heatPlot.ConstantNames {
+		log.Printf("%s = %v", cstr, heatPlot.Constants[strings.ToUpper(cstr)])
+	}
 }
@@ -0,0 +1,229 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"strings"
+)
+
+// Colour is the final statement of a formula which gives every point a true colour rather than a weight, as in
+// "rgb(x / 10, y / 10, sin(t))" or "rgba(1, 0, 0, r / 10)". Each channel runs from 0 to 1, values outside are clamped.
+type Colour struct {
+	Name     string
+	Channels []Expression
+}
+
+// channelCount is how many channels the Colour must be given, 4 for rgba and 3 for rgb.
+func (v Colour) channelCount() int {
+	if strings.EqualFold(v.Name, "rgba") {
+		return 4
+	}
+	return 3
+}
+
+// Evaluate gives the mean of the red, green and blue channels, a Colour has no weight of its own, use
+// Function.EvaluateColour.
+func (v Colour) Evaluate(state State) float64 {
+	sum := 0.0
+	for _, c := range v.Channels[:3] {
+		sum += c.Evaluate(state)
+	}
+	return sum / 3
+}
+
+// EvaluateColour evaluates each channel at the state, alpha is opaque unless it was given.
+func (v Colour) EvaluateColour(state State) color.NRGBA {
+	c := color.NRGBA{
+		R: channel(v.Channels[0].Evaluate(state)),
+		G: channel(v.Channels[1].Evaluate(state)),
+		B: channel(v.Channels[2].Evaluate(state)),
+		A: 0xFF,
+	}
+	if len(v.Channels) > 3 {
+		c.A = channel(v.Channels[3].Evaluate(state))
+	}
+	return c
+}
+
+func (v Colour) String() string {
+	channels := make([]string, len(v.Channels))
+	for i, c := range v.Channels {
+		channels[i] = c.String()
+	}
+	return fmt.Sprintf("%s(%s)", v.Name, strings.Join(channels, ", "))
+}
+
+func (v Colour) Simplify() Expression {
+	channels := make([]Expression, len(v.Channels))
+	for i, c := range v.Channels {
+		channels[i] = removeBrackets(c.Simplify())
+	}
+	v.Channels = channels
+	return &v
+}
+
+func (v Colour) Depth() int {
+	return maxDepth(v.Channels...)
+}
+
+// channel converts a value from 0 to 1 into a colour channel, NaN is 0.
+func channel(f float64) uint8 {
+	switch {
+	case math.IsNaN(f) || f <= 0:
+		return 0
+	case f >= 1:
+		return 0xFF
+	}
+	return uint8(math.Round(f * 0xFF))
+}
+
+// EvaluateColour evaluates a formula ending with rgb or rgba at X, Y.
+func (v Function) EvaluateColour(X, Y, T float64) (c color.NRGBA, TUsed bool, err error) {
+	state := &RealState{
+		X:    X,
+		Y:    Y,
+		T:    T,
+		Seed: v.Seed,
+	}
+	c, err = v.evaluateColour(state)
+	return c, state.AccessedT, err
+}
+
+// evaluateColour works out the colour at the point state is for.
+func (v Function) evaluateColour(state *RealState) (c color.NRGBA, err error) {
+	if v.Colour == nil {
+		return color.NRGBA{}, errors.New("not a colour formula")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("Recovered in f", r)
+		}
+	}()
+	for _, b := range v.Bindings {
+		b.Evaluate(state)
+	}
+	c = v.Colour.EvaluateColour(state)
+	return
+}
+
+// ColourPlot is a Plot of a colour formula, one colour per point.
+type ColourPlot struct {
+	Size   image.Rectangle
+	Values []color.NRGBA
+	T      float64
+	// totals are the running totals of its accumulates, which the next frame carries on from.
+	totals *frameTotals
+}
+
+func (plot *ColourPlot) Set(x int, y int, c color.NRGBA) {
+	pos := plot.GetPos(x, y)
+	if pos < 0 || pos >= len(plot.Values) {
+		return
+	}
+	plot.Values[pos] = c
+}
+
+func (plot *ColourPlot) Get(x int, y int) color.NRGBA {
+	pos := plot.GetPos(x, y)
+	if pos < 0 || pos >= len(plot.Values) {
+		return color.NRGBA{}
+	}
+	return plot.Values[pos]
+}
+
+func (plot *ColourPlot) GetPos(x int, y int) int {
+	absX := x - plot.Size.Min.X
+	absY := y - plot.Size.Min.Y
+	return absY*plot.Size.Dx() + absX
+}
+
+// Image draws the plot with y increasing upwards and each point scale pixels square.
+func (plot *ColourPlot) Image(scale int) *image.RGBA {
+	result := image.NewRGBA(image.Rect(0, 0, plot.Size.Dx()*scale, plot.Size.Dy()*scale))
+	for x := plot.Size.Min.X; x < plot.Size.Max.X; x++ {
+		for y := plot.Size.Min.Y; y < plot.Size.Max.Y; y++ {
+			c := plot.Get(x, y)
+			px, py := (x-plot.Size.Min.X)*scale, (plot.Size.Max.Y-y-1)*scale
+			for xs := 0; xs < scale; xs++ {
+				for ys := 0; ys < scale; ys++ {
+					result.Set(px+xs, py+ys, c)
+				}
+			}
+		}
+	}
+	return result
+}
+
+func (function *Function) PlotColourForT(size image.Rectangle, t float64, pointSize float64) (plot *ColourPlot, TUsed bool, err error) {
+	return function.plotColourForT(size, nil, t, pointSize, timeline{})
+}
+
+// plotColourForT is PlotColourForT for the frame at t of frames which follows previous, if any.
+func (function *Function) plotColourForT(size image.Rectangle, previous *ColourPlot, t float64, pointSize float64, frames timeline) (plot *ColourPlot, TUsed bool, err error) {
+	plot = &ColourPlot{
+		Size:   size,
+		Values: make([]color.NRGBA, size.Dy()*size.Dx()),
+		T:      t,
+	}
+	fields := newFieldPlotter(function, size, nil, t, pointSize, frames)
+	if previous != nil {
+		fields.carried = previous.totals
+	}
+	plot.totals = fields.totals
+	fields.plotStatements()
+	for x := size.Min.X; x < size.Max.X; x++ {
+		for y := size.Min.Y; y < size.Max.Y; y++ {
+			state := fields.state(x, y)
+			var c color.NRGBA
+			if c, err = function.evaluateColour(state); err != nil {
+				return nil, false, err
+			}
+			TUsed = TUsed || state.AccessedT || fields.tUsed
+			plot.Set(x, y, c)
+		}
+	}
+	return
+}
+
+func (function *Function) PlotColour(timeLowerBound, timeUpperBound, timeStep float64, plotSize image.Rectangle, pointSize float64) (tUsed bool, plots []*ColourPlot) {
+	frames := newTimeline(timeLowerBound, timeStep)
+	var previous *ColourPlot
+	for _, t := range FrameTimes(timeLowerBound, timeUpperBound, timeStep) {
+		var err error
+		var plot *ColourPlot
+		if plot, tUsed, err = function.plotColourForT(plotSize, previous, t, pointSize, frames); err != nil {
+			log.Panic(err)
+		}
+		plots = append(plots, plot)
+		previous = plot
+		if !tUsed {
+			break
+		}
+	}
+	return
+}
+
+// PlotAndDrawColour is PlotAndDraw for formulas ending with rgb or rgba. The frames are true colour, with any alpha
+// kept, so rather than a GIF they are returned for the caller to encode, for example as PNGs.
+func (function *Function) PlotAndDrawColour(size int, timeLowerBound, timeUpperBound, timeStep float64, scale int, pointSize float64, footerText string) []*image.RGBA {
+	plotSize := image.Rect(-size, -size, size, size)
+	tUsed, plots := function.PlotColour(timeLowerBound, timeUpperBound, timeStep, plotSize, pointSize)
+	return RenderColourPlots(plots, scale, function, timeUpperBound, tUsed, footerText)
+}
+
+func RenderColourPlots(plots []*ColourPlot, scale int, function *Function, timeUpperBound float64, tUsed bool, footerText string) []*image.RGBA {
+	imgs := []*image.RGBA{}
+	for _, plot := range plots {
+		img := plot.Image(scale)
+		result := image.NewRGBA(headerAndFooterBounds(img.Rect, scale))
+		if err := drawHeaderAndFooter(result, img, function.Heading(), plot.T, timeUpperBound, scale, tUsed, footerText); err != nil {
+			log.Panic(err)
+		}
+		imgs = append(imgs, result)
+	}
+	return imgs
+}
@@ -0,0 +1,107 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestColour(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula  string
+		X, Y     float64
+		T        float64
+		Expected color.NRGBA
+	}{
+		{Formula: "rgb(x, y, 0.5)", X: 0.2, Y: 1, Expected: color.NRGBA{R: 51, G: 255, B: 128, A: 255}},
+		{Formula: "rgb(x, y, 0.5)", X: -3, Y: 7, Expected: color.NRGBA{R: 0, G: 255, B: 128, A: 255}},
+		{Formula: "rgba(1, 0, 0, r * 0.1)", X: 3, Y: 4, Expected: color.NRGBA{R: 255, G: 0, B: 0, A: 128}},
+		{Formula: "level = t * 0.25; RGB(level, level, level)", T: 2, Expected: color.NRGBA{R: 128, G: 128, B: 128, A: 255}},
+		{Formula: "g(a) = a * a; rgb(g(x), 0, sqrt(-1))", X: 0.5, Expected: color.NRGBA{R: 64, G: 0, B: 0, A: 255}},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.String() != each.Formula {
+				t.Errorf("Failed to match %v with %v", f.String(), each.Formula)
+			}
+			c, _, err := f.EvaluateColour(each.X, each.Y, each.T)
+			if err != nil {
+				t.Fatalf("Evaluate failed: %v", err)
+			}
+			if c != each.Expected {
+				t.Errorf("Got %v expected %v", c, each.Expected)
+			}
+			if _, _, err := f.Evaluate(each.X, each.Y, each.T); err == nil {
+				t.Errorf("Expected a colour formula to have no weight")
+			}
+		})
+	}
+}
+
+func TestColourErrors(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula string
+		Column  int
+		Reason  string
+	}{
+		{
+			Formula: "rgb(x, y)",
+			Column:  1,
+			Reason:  "rgb takes 3 arguments but was given 2",
+		},
+		{
+			Formula: "a = 1; rgba(x, y, a)",
+			Column:  8,
+			Reason:  "rgba takes 4 arguments but was given 3",
+		},
+		{
+			Formula: "rgb(x, y, t); y = x",
+			Column:  1,
+			Reason:  "rgb can only be the final statement",
+		},
+		{
+			Formula: "rgb(x, k, t)",
+			Column:  8,
+			Reason:  "variable k is used before it is defined",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			_, err := ParseFunctionE(each.Formula)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a *ParseError got %#v", err)
+			}
+			if pe.Column != each.Column || pe.Reason != each.Reason {
+				t.Errorf("Got column %d %#v expected column %d %#v", pe.Column, pe.Reason, each.Column, each.Reason)
+			}
+		})
+	}
+}
+
+func TestColourPlotImage(t *testing.T) {
+	f := ParseFunction("rgb(x > 0, y > 0, t)")
+	plots := f.PlotAndDrawColour(2, 0, 3, 1, 2, 1, "")
+	if len(plots) != 3 {
+		t.Fatalf("Expected a frame per T got %d", len(plots))
+	}
+	_, plot := f.PlotColour(1, 2, 1, image.Rect(-2, -2, 2, 2), 1)
+	img := plot[0].Image(2)
+	for _, each := range []struct {
+		X, Y     int
+		Expected color.RGBA
+	}{
+		{X: 7, Y: 0, Expected: color.RGBA{R: 255, G: 255, B: 255, A: 255}},
+		{X: 0, Y: 0, Expected: color.RGBA{R: 0, G: 255, B: 255, A: 255}},
+		{X: 7, Y: 7, Expected: color.RGBA{R: 255, G: 0, B: 255, A: 255}},
+		{X: 0, Y: 7, Expected: color.RGBA{R: 0, G: 0, B: 255, A: 255}},
+	} {
+		if got := img.At(each.X, each.Y); got != each.Expected {
+			t.Errorf("At %d, %d got %v expected %v", each.X, each.Y, got, each.Expected)
+		}
+	}
+}
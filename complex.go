@@ -0,0 +1,468 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/cmplx"
+	"strings"
+)
+
+var (
+	ComplexSingleFunctions   map[string]ComplexSingleFunctionDef
+	ComplexDoubleFunctions   map[string]ComplexDoubleFunctionDef
+	ComplexVariadicFunctions map[string]ComplexVariadicFunctionDef
+	ComplexFunctionNames     []string
+)
+
+type ComplexSingleFunctionDef func(complex128) complex128
+type ComplexDoubleFunctionDef func(complex128, complex128) complex128
+type ComplexVariadicFunctionDef func(...complex128) complex128
+
+// ComplexExpression is implemented by the Expressions which can be evaluated over complex numbers, Parser.ParseComplex
+// rejects formulas containing any which can't.
+type ComplexExpression interface {
+	EvaluateComplex(state *ComplexState) complex128
+}
+
+// ComplexState is the State of a complex evaluation, z is x + iy. Scopes share the root's Z and T.
+type ComplexState struct {
+	Z         complex128
+	T         float64
+	AccessedT bool
+	Vars      map[string]complex128
+	parent    *ComplexState
+	// isolated is set on the scope of a function's parameters, whose body can't see the variables of its parent.
+	isolated bool
+	// outer is set when a formula which isn't complex evaluates part of itself over complex numbers, such as an
+	// Iterate. Z, T and the variables it has bound then come from it.
+	outer State
+}
+
+func (cs *ComplexState) CurZ() complex128 {
+	if cs.parent != nil {
+		return cs.parent.CurZ()
+	}
+	if cs.outer != nil {
+		return complex(cs.outer.CurX(), cs.outer.CurY())
+	}
+	return cs.Z
+}
+
+func (cs *ComplexState) CurT() float64 {
+	if cs.parent != nil {
+		return cs.parent.CurT()
+	}
+	if cs.outer != nil {
+		return cs.outer.CurT()
+	}
+	cs.AccessedT = true
+	return cs.T
+}
+
+func (cs *ComplexState) Lookup(name string) (complex128, bool) {
+	if v, ok := cs.Vars[strings.ToUpper(name)]; ok {
+		return v, true
+	}
+	if cs.isolated {
+		return 0, false
+	}
+	if cs.parent != nil {
+		return cs.parent.Lookup(name)
+	}
+	if cs.outer != nil {
+		v, ok := cs.outer.Lookup(name)
+		return complex(v, 0), ok
+	}
+	return 0, false
+}
+
+func (cs *ComplexState) Bind(name string, value complex128) {
+	if cs.Vars == nil {
+		cs.Vars = map[string]complex128{}
+	}
+	cs.Vars[strings.ToUpper(name)] = value
+}
+
+// Scope returns a ComplexState whose Binds are only visible through it, for the parameters of a function call.
+func (cs *ComplexState) Scope() *ComplexState {
+	return &ComplexState{
+		parent: cs,
+	}
+}
+
+// call returns the ComplexState of a function's parameters while its body is evaluated, which sees z and t but none
+// of the variables bound so far.
+func (cs *ComplexState) call() *ComplexState {
+	return &ComplexState{
+		parent:   cs,
+		isolated: true,
+	}
+}
+
+// isComplexVar reports whether name is one of the variables only complex formulas have, z and the imaginary unit i.
+func isComplexVar(name string) bool {
+	switch strings.ToUpper(name) {
+	case "Z", "I":
+		return true
+	}
+	return false
+}
+
+func isComplexFunctionName(name string) bool {
+	name = strings.ToUpper(name)
+	if _, ok := ComplexSingleFunctions[name]; ok {
+		return true
+	}
+	if _, ok := ComplexDoubleFunctions[name]; ok {
+		return true
+	}
+	if _, ok := ComplexVariadicFunctions[name]; ok {
+		return true
+	}
+	return false
+}
+
+// complexFunctionArity is functionArity for the complex versions of the functions.
+func complexFunctionArity(name string) arity {
+	name = strings.ToUpper(name)
+	a := arity{}
+	if _, ok := ComplexSingleFunctions[name]; ok {
+		a.counts = append(a.counts, 1)
+	}
+	if _, ok := ComplexDoubleFunctions[name]; ok {
+		a.counts = append(a.counts, 2)
+	}
+	if _, ok := ComplexVariadicFunctions[name]; ok {
+		a.variadic, a.minimum = true, 1
+	}
+	return a
+}
+
+// EvaluateComplex evaluates a formula parsed with Parser.ParseComplex at z.
+func (v Function) EvaluateComplex(z complex128, T float64) (value complex128, TUsed bool, err error) {
+	state := &ComplexState{
+		Z: z,
+		T: T,
+	}
+	if v.Equals == nil {
+		return 0, false, errors.New("no such formula")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("Recovered in f", r)
+		}
+	}()
+	for _, b := range v.Bindings {
+		b.EvaluateComplex(state)
+	}
+	value = v.Equals.EvaluateComplex(state)
+	TUsed = state.AccessedT
+	return
+}
+
+// checkComplex reports an error against the tokens when a complex formula uses something with no complex meaning,
+// formulas which aren't complex always pass.
+func (lex *CalcLexer) checkComplex(e Expression, tokens []lexedToken) bool {
+	if !lex.complex {
+		return true
+	}
+	if v, ok := e.(*Var); ok && isPrevVar(v.Var) {
+		lex.fail(findVarToken(tokens, v.Var), "prev isn't defined for complex numbers", "prev reads the previous frame of a heat plot")
+		return false
+	}
+	if _, ok := e.(ComplexExpression); !ok {
+		at, what := tokens[0], e.String()
+		if _, ok := e.(*Modulus); ok {
+			at, what = findToken(tokens, "%"), "%"
+		}
+		lex.fail(at, fmt.Sprintf("%s isn't defined for complex numbers", what), "use abs(z), arg(z), re(z) or im(z) to work with a real part of it")
+		return false
+	}
+	if call, ok := e.(*UserFunctionCall); ok {
+		// The function may have been declared outside an iterate, where it wasn't checked.
+		if !lex.checkComplex(call.Function.Body, tokens) {
+			return false
+		}
+	} else if name, _, ok := callParts(e); ok && !isComplexFunctionName(name) {
+		lex.fail(findToken(tokens, name), fmt.Sprintf("%s has no complex version", name), "see whatFunctions for the functions complex formulas can use")
+		return false
+	}
+	for _, child := range children(e) {
+		if !lex.checkComplex(child, tokens) {
+			return false
+		}
+	}
+	return true
+}
+
+// complexTruth is truth for complex formulas.
+func complexTruth(b bool) complex128 {
+	return complex(truth(b), 0)
+}
+
+// isComplexTrue treats every value other than zero and NaN as true.
+func isComplexTrue(c complex128) bool {
+	return c != 0 && !cmplx.IsNaN(c)
+}
+
+func (v Equals) EvaluateComplex(state *ComplexState) complex128 {
+	return evaluateComplex(v.RHS, state) - evaluateComplex(v.LHS, state)
+}
+
+func (v Binding) EvaluateComplex(state *ComplexState) complex128 {
+	value := evaluateComplex(v.Expr, state)
+	state.Bind(v.Name, value)
+	return value
+}
+
+func (v Var) EvaluateComplex(state *ComplexState) complex128 {
+	if value, ok := state.Lookup(v.Var); ok {
+		return value
+	}
+	switch strings.ToUpper(v.Var) {
+	case "Z":
+		return state.CurZ()
+	case "I":
+		return 1i
+	case "X":
+		return complex(real(state.CurZ()), 0)
+	case "Y":
+		return complex(imag(state.CurZ()), 0)
+	case "T":
+		return complex(state.CurT(), 0)
+	case "R":
+		return complex(cmplx.Abs(state.CurZ()), 0)
+	case "THETA", "Θ":
+		return complex(cmplx.Phase(state.CurZ()), 0)
+	default:
+		return 0
+	}
+}
+
+func (c Const) EvaluateComplex(state *ComplexState) complex128 {
+	return complex(c.Value, 0)
+}
+
+func (v NamedConstant) EvaluateComplex(state *ComplexState) complex128 {
+	return complex(v.Value, 0)
+}
+
+func (v Plus) EvaluateComplex(state *ComplexState) complex128 {
+	return evaluateComplex(v.LHS, state) + evaluateComplex(v.RHS, state)
+}
+
+func (v Subtract) EvaluateComplex(state *ComplexState) complex128 {
+	return evaluateComplex(v.LHS, state) - evaluateComplex(v.RHS, state)
+}
+
+func (v Multiply) EvaluateComplex(state *ComplexState) complex128 {
+	return evaluateComplex(v.LHS, state) * evaluateComplex(v.RHS, state)
+}
+
+func (v Divide) EvaluateComplex(state *ComplexState) complex128 {
+	return evaluateComplex(v.LHS, state) / evaluateComplex(v.RHS, state)
+}
+
+func (v Power) EvaluateComplex(state *ComplexState) complex128 {
+	return cmplx.Pow(evaluateComplex(v.LHS, state), evaluateComplex(v.RHS, state))
+}
+
+func (v Negate) EvaluateComplex(state *ComplexState) complex128 {
+	return -evaluateComplex(v.Expr, state)
+}
+
+func (v Brackets) EvaluateComplex(state *ComplexState) complex128 {
+	return evaluateComplex(v.Expr, state)
+}
+
+func (v NFunction) EvaluateComplex(state *ComplexState) complex128 {
+	args := make([]complex128, len(v.Args))
+	for i, arg := range v.Args {
+		args[i] = evaluateComplex(arg, state)
+	}
+	name := strings.ToUpper(v.Name)
+	switch len(args) {
+	case 0:
+		return 0
+	case 1:
+		if f, ok := ComplexSingleFunctions[name]; ok {
+			return f(args[0])
+		}
+	case 2:
+		if f, ok := ComplexDoubleFunctions[name]; ok {
+			return f(args[0], args[1])
+		}
+	}
+	if f, ok := ComplexVariadicFunctions[name]; ok {
+		return f(args...)
+	}
+	return args[0]
+}
+
+func (v UserFunctionCall) EvaluateComplex(state *ComplexState) complex128 {
+	scope := state.call()
+	for i, arg := range v.Args {
+		scope.Bind(v.Function.Params[i], evaluateComplex(arg, state))
+	}
+	return evaluateComplex(v.Function.Body, scope)
+}
+
+// The orderings compare the real parts, == and != compare the whole number.
+
+func (v LessThan) EvaluateComplex(state *ComplexState) complex128 {
+	return complexTruth(real(evaluateComplex(v.LHS, state)) < real(evaluateComplex(v.RHS, state)))
+}
+
+func (v LessOrEqual) EvaluateComplex(state *ComplexState) complex128 {
+	return complexTruth(real(evaluateComplex(v.LHS, state)) <= real(evaluateComplex(v.RHS, state)))
+}
+
+func (v GreaterThan) EvaluateComplex(state *ComplexState) complex128 {
+	return complexTruth(real(evaluateComplex(v.LHS, state)) > real(evaluateComplex(v.RHS, state)))
+}
+
+func (v GreaterOrEqual) EvaluateComplex(state *ComplexState) complex128 {
+	return complexTruth(real(evaluateComplex(v.LHS, state)) >= real(evaluateComplex(v.RHS, state)))
+}
+
+func (v EqualTo) EvaluateComplex(state *ComplexState) complex128 {
+	return complexTruth(evaluateComplex(v.LHS, state) == evaluateComplex(v.RHS, state))
+}
+
+func (v NotEqualTo) EvaluateComplex(state *ComplexState) complex128 {
+	return complexTruth(evaluateComplex(v.LHS, state) != evaluateComplex(v.RHS, state))
+}
+
+func (v And) EvaluateComplex(state *ComplexState) complex128 {
+	return complexTruth(isComplexTrue(evaluateComplex(v.LHS, state)) && isComplexTrue(evaluateComplex(v.RHS, state)))
+}
+
+func (v Or) EvaluateComplex(state *ComplexState) complex128 {
+	return complexTruth(isComplexTrue(evaluateComplex(v.LHS, state)) || isComplexTrue(evaluateComplex(v.RHS, state)))
+}
+
+func (v Not) EvaluateComplex(state *ComplexState) complex128 {
+	return complexTruth(!isComplexTrue(evaluateComplex(v.Expr, state)))
+}
+
+func (v If) EvaluateComplex(state *ComplexState) complex128 {
+	if isComplexTrue(evaluateComplex(v.Condition, state)) {
+		return evaluateComplex(v.Then, state)
+	}
+	return evaluateComplex(v.Else, state)
+}
+
+func (v Piecewise) EvaluateComplex(state *ComplexState) complex128 {
+	for i, condition := range v.Conditions {
+		if isComplexTrue(evaluateComplex(condition, state)) {
+			return evaluateComplex(v.Values[i], state)
+		}
+	}
+	if v.Otherwise == nil {
+		return 0
+	}
+	return evaluateComplex(v.Otherwise, state)
+}
+
+// EvaluateComplex takes the index from the real part of From up to the real part of To.
+func (v Summation) EvaluateComplex(state *ComplexState) complex128 {
+	from, to := real(evaluateComplex(v.From, state)), real(evaluateComplex(v.To, state))
+	if !summationBounded(from, to) {
+		return cmplx.NaN()
+	}
+	var result complex128
+	if v.isProduct() {
+		result = 1
+	}
+	scope := state.Scope()
+	for k := from; k <= to; k++ {
+		scope.Bind(v.Index, complex(k, 0))
+		if v.isProduct() {
+			result *= evaluateComplex(v.Body, scope)
+		} else {
+			result += evaluateComplex(v.Body, scope)
+		}
+	}
+	return result
+}
+
+// evaluateComplex evaluates e, which checkComplex has already found to be a ComplexExpression.
+func evaluateComplex(e Expression, state *ComplexState) complex128 {
+	return e.(ComplexExpression).EvaluateComplex(state)
+}
+
+func init() {
+	ComplexSingleFunctions = map[string]ComplexSingleFunctionDef{}
+	ComplexDoubleFunctions = map[string]ComplexDoubleFunctionDef{}
+	ComplexVariadicFunctions = map[string]ComplexVariadicFunctionDef{}
+	ComplexFunctionNames = []string{}
+	for name, f := range map[string]interface{}{
+		"Abs":   cmplx.Abs,
+		"Acos":  cmplx.Acos,
+		"Acosh": cmplx.Acosh,
+		"Arg":   cmplx.Phase,
+		"Asin":  cmplx.Asin,
+		"Asinh": cmplx.Asinh,
+		"Atan":  cmplx.Atan,
+		"Atanh": cmplx.Atanh,
+		"Conj":  cmplx.Conj,
+		"Cos":   cmplx.Cos,
+		"Cosh":  cmplx.Cosh,
+		"Cot":   cmplx.Cot,
+		"Exp":   cmplx.Exp,
+		"Im":    func(c complex128) float64 { return imag(c) },
+		"Log":   cmplx.Log,
+		"Log10": cmplx.Log10,
+		"Phase": cmplx.Phase,
+		"Pow":   cmplx.Pow,
+		"Re":    func(c complex128) float64 { return real(c) },
+		"Sin":   cmplx.Sin,
+		"Sinh":  cmplx.Sinh,
+		"Sqrt":  cmplx.Sqrt,
+		"Tan":   cmplx.Tan,
+		"Tanh":  cmplx.Tanh,
+	} {
+		switch f := f.(type) {
+		case func(complex128) complex128:
+			ComplexSingleFunctions[strings.ToUpper(name)] = f
+		case func(complex128, complex128) complex128:
+			ComplexDoubleFunctions[strings.ToUpper(name)] = f
+		case func(complex128) float64:
+			ComplexSingleFunctions[strings.ToUpper(name)] = func(c complex128) complex128 {
+				return complex(f(c), 0)
+			}
+		default:
+			continue
+		}
+		ComplexFunctionNames = append(ComplexFunctionNames, name)
+	}
+	for name, f := range map[string]ComplexVariadicFunctionDef{
+		"Sum":     complexSum,
+		"Mean":    complexMean,
+		"Product": complexProduct,
+	} {
+		ComplexVariadicFunctions[strings.ToUpper(name)] = f
+		ComplexFunctionNames = append(ComplexFunctionNames, name)
+	}
+}
+
+func complexSum(args ...complex128) complex128 {
+	var r complex128
+	for _, a := range args {
+		r += a
+	}
+	return r
+}
+
+func complexMean(args ...complex128) complex128 {
+	return complexSum(args...) / complex(float64(len(args)), 0)
+}
+
+func complexProduct(args ...complex128) complex128 {
+	var r complex128 = 1
+	for _, a := range args {
+		r *= a
+	}
+	return r
+}
@@ -0,0 +1,134 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"math/cmplx"
+	"testing"
+)
+
+func TestComplex(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula  string
+		Expected string
+		Explicit func(z complex128, t int) complex128
+	}{
+		{
+			Formula:  "f(z) = (z^2 - 1)/(z^2 + 1)",
+			Expected: "f(z) = (z ^ 2 - 1) / (z ^ 2 + 1)",
+			Explicit: func(z complex128, t int) complex128 { return (z*z - 1) / (z*z + 1) },
+		},
+		{
+			Formula:  "0 = exp(i theta) * r",
+			Expected: "0 = exp(i theta) * r",
+			Explicit: func(z complex128, t int) complex128 { return z },
+		},
+		{
+			Formula:  "w = z - 2i; g(a) = conj(a) * a; 0 = g(w) + t",
+			Expected: "w = z - 2i; g(a) = conj(a) * a; 0 = g(w) + t",
+			Explicit: func(z complex128, t int) complex128 {
+				w := z - 2i
+				return cmplx.Conj(w)*w + complex(float64(t), 0)
+			},
+		},
+		{
+			Formula:  "0 = sum(z, 1, i) * product(z, z, 2) / mean(z, 1)",
+			Expected: "0 = sum(z, 1, i) * product(z, z, 2) / mean(z, 1)",
+			Explicit: func(z complex128, t int) complex128 { return (z + 1 + 1i) * (z * z * 2) / ((z + 1) / 2) },
+		},
+		{
+			Formula:  "0 = sum(k = 0, 3, z ^ k)",
+			Expected: "0 = sum(k = 0, 3, z ^ k)",
+			Explicit: func(z complex128, t int) complex128 { return 1 + z + z*z + z*z*z },
+		},
+		{
+			Formula:  "p(q) = sin(q) / q; 0 = p(z) - re(z) + im(z) i",
+			Expected: "p(q) = sin(q) / q; 0 = p(z) - re(z) + im(z) i",
+			Explicit: func(z complex128, t int) complex128 {
+				return cmplx.Sin(z)/z - complex(real(z), 0) + complex(0, imag(z))
+			},
+		},
+		{
+			Formula:  "f(z) = if(abs(z) < 1, x, y)",
+			Expected: "f(z) = if(abs(z) < 1, x, y)",
+			Explicit: func(z complex128, t int) complex128 {
+				if cmplx.Abs(z) < 1 {
+					return complex(real(z), 0)
+				}
+				return complex(imag(z), 0)
+			},
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseComplexFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.String() != each.Expected {
+				t.Errorf("Failed to match %v with %v", f.String(), each.Expected)
+			}
+			if _, err := ParseComplexFunctionE(f.Simplify().String()); err != nil {
+				t.Errorf("Reparse failed: %v", err)
+			}
+			for _, z := range []complex128{3 + 5i, -1.5 + 2i, 0.25 - 4i} {
+				got, _, _ := f.EvaluateComplex(z, 7)
+				if expected := each.Explicit(z, 7); cmplx.Abs(got-expected) > 1e-12 {
+					t.Errorf("At %v got %v expected %v", z, got, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestComplexErrors(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula string
+		Column  int
+		Reason  string
+	}{
+		{
+			Formula: "0 = z % 2",
+			Column:  7,
+			Reason:  "% isn't defined for complex numbers",
+		},
+		{
+			Formula: "f(z) = floor(z)",
+			Column:  8,
+			Reason:  "floor has no complex version",
+		},
+		{
+			Formula: "z = 1; 0 = z",
+			Column:  1,
+			Reason:  "z can't be assigned",
+		},
+		{
+			Formula: "f(a) = a * k; 0 = f(z)",
+			Column:  12,
+			Reason:  "variable k isn't a parameter of f",
+		},
+		{
+			Formula: "0 = pow(z)",
+			Column:  5,
+			Reason:  "pow takes 2 arguments but was given 1",
+		},
+		{
+			Formula: "0 = max(z, 1, 2)",
+			Column:  5,
+			Reason:  "max has no complex version",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			_, err := ParseComplexFunctionE(each.Formula)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a *ParseError got %#v", err)
+			}
+			if pe.Column != each.Column || pe.Reason != each.Reason {
+				t.Errorf("Got column %d %#v expected column %d %#v", pe.Column, pe.Reason, each.Column, each.Reason)
+			}
+		})
+	}
+	if _, err := ParseFunctionE("f(z) = z ^ 2"); err == nil {
+		t.Errorf("Expected f(z) = ... to need complex mode")
+	}
+}
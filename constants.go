@@ -0,0 +1,93 @@
+package heatPlot
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Constants are the named numbers a formula can use, keyed by their upper cased name. Use RegisterConstant to add
+	// to them.
+	Constants     map[string]float64
+	ConstantNames []string
+	identifierRe  = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+)
+
+func init() {
+	Constants = map[string]float64{}
+	ConstantNames = []string{}
+	for _, c := range []struct {
+		Name  string
+		Value float64
+	}{
+		{"pi", math.Pi},
+		{"e", math.E},
+		{"tau", 2 * math.Pi},
+		{"phi", math.Phi},
+		{"sqrt2", math.Sqrt2},
+		{"ln2", math.Ln2},
+	} {
+		// Not RegisterConstant, the functions it checks against may not be registered yet.
+		Constants[strings.ToUpper(c.Name)] = c.Value
+		ConstantNames = append(ConstantNames, c.Name)
+	}
+}
+
+// RegisterConstant makes name usable as value in formulas parsed after it. Names are case insensitive and can't
+// clash with the keywords, the built in variables, complex ones included, or the functions, whether registered, only
+// for complex numbers or given their own meaning by the parser such as sum and img. Like SingleFunctions it isn't
+// safe to call while formulas are being parsed.
+func RegisterConstant(name string, value float64) error {
+	_, keyword := calcLexerKeywords[strings.ToUpper(name)]
+	switch {
+	case !identifierRe.MatchString(name):
+		return fmt.Errorf("constant %q isn't a valid name, it must start with a letter and contain only letters, digits and _", name)
+	case keyword:
+		return fmt.Errorf("constant %q would hide the keyword of the same name", name)
+	case isBuiltinVar(name) || isComplexVar(name):
+		return fmt.Errorf("constant %q would hide the variable of the same name", name)
+	case isFunctionName(name) || isComplexFunctionName(name) || isSpecialName(name):
+		return fmt.Errorf("constant %q would hide the function of the same name", name)
+	}
+	if _, ok := Constants[strings.ToUpper(name)]; !ok {
+		ConstantNames = append(ConstantNames, name)
+	}
+	Constants[strings.ToUpper(name)] = value
+	return nil
+}
+
+func isConstantName(name string) bool {
+	_, ok := Constants[strings.ToUpper(name)]
+	return ok
+}
+
+// NamedConstant is a constant written by name such as pi, the value is captured when the formula is parsed.
+type NamedConstant struct {
+	Name  string
+	Value float64
+}
+
+func newNamedConstant(name string) *NamedConstant {
+	return &NamedConstant{
+		Name:  name,
+		Value: Constants[strings.ToUpper(name)],
+	}
+}
+
+func (v NamedConstant) Evaluate(state State) float64 {
+	return v.Value
+}
+
+func (v NamedConstant) String() string {
+	return v.Name
+}
+
+func (v NamedConstant) Simplify() Expression {
+	return &v
+}
+
+func (v NamedConstant) Depth() int {
+	return 1
+}
@@ -0,0 +1,72 @@
+package heatPlot
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestConstants(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula  string
+		Expected float64
+	}{
+		{Formula: "0 = pi", Expected: math.Pi},
+		{Formula: "0 = PI", Expected: math.Pi},
+		{Formula: "0 = e", Expected: math.E},
+		{Formula: "0 = tau", Expected: 2 * math.Pi},
+		{Formula: "0 = phi", Expected: math.Phi},
+		{Formula: "0 = sqrt2", Expected: math.Sqrt2},
+		{Formula: "0 = ln2", Expected: math.Ln2},
+		{Formula: "0 = 2pi", Expected: 2 * math.Pi},
+		{Formula: "0 = sin(pi * 0.5)", Expected: 1},
+		{Formula: "0 = e ^ x", Expected: math.Pow(math.E, 2)},
+		{Formula: "0 = 2pi x", Expected: 4 * math.Pi},
+		{Formula: "0 = exp(x)", Expected: math.Exp(2)},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.String() != each.Formula {
+				t.Errorf("Failed to match %v with %v", f.String(), each.Formula)
+			}
+			if w, _, _ := f.Evaluate(2, 3, 0); w != each.Expected {
+				t.Errorf("Got %v expected %v", w, each.Expected)
+			}
+		})
+	}
+}
+
+func TestRegisterConstant(t *testing.T) {
+	if err := RegisterConstant("answer", 42); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	defer func() {
+		delete(Constants, "ANSWER")
+		ConstantNames = ConstantNames[:len(ConstantNames)-1]
+	}()
+	f, err := ParseFunctionE("y = answer x")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if w, _, _ := f.Evaluate(2, 0, 0); w != 84 {
+		t.Errorf("Got %v expected 84", w)
+	}
+	for _, name := range []string{
+		"x", "T", "r", "theta", "prev", "z", "i",
+		"if", "Piecewise", "rgb", "rgba",
+		"sin", "Atan2", "rand", "conj",
+		"sum", "prod", "integrate", "iterate", "escape", "accumulate", "d", "img", "disc", "ring", "laplace", "blur", "at",
+		"2pi", "a-b", "",
+	} {
+		if err := RegisterConstant(name, 1); err == nil {
+			t.Errorf("Registering %#v should have failed", name)
+		}
+		if _, ok := Constants[strings.ToUpper(name)]; ok {
+			t.Errorf("%#v was registered", name)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package heatPlot
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+)
+
+// Convolution is laplace(expr), blur(expr, radius) or at(expr, dx, dy), which read the field expr makes around the
+// pixel being worked out. Before a frame is plotted Expr is plotted over the whole of it on a Plot of its own, see
+// fieldPlotter, which these then read from, beyond its edges as the Function's Boundary says.
+//
+// laplace is the sum of the 4 pixels beside the current one less 4 times it, the discrete Laplacian, which picks out
+// edges. blur is the Gaussian blur of expr with a standard deviation of radius pixels. at is expr dx pixels to the
+// right and dy pixels above, the offsets being rounded as with prev.
+type Convolution struct {
+	// Name is laplace, blur or at as it was written.
+	Name string
+	Expr Expression
+	// Args are the radius of a blur or the offsets of an at.
+	Args []Expression
+}
+
+func (v Convolution) Evaluate(state State) float64 {
+	switch strings.ToUpper(v.Name) {
+	case "LAPLACE":
+		return state.Field(v.Expr, 1, 0) + state.Field(v.Expr, -1, 0) + state.Field(v.Expr, 0, 1) + state.Field(v.Expr, 0, -1) -
+			4*state.Field(v.Expr, 0, 0)
+	case "BLUR":
+		return v.blur(state)
+	}
+	dx, dy := math.Round(v.Args[0].Evaluate(state)), math.Round(v.Args[1].Evaluate(state))
+	if math.IsNaN(dx) || math.IsNaN(dy) || math.Abs(dx) > math.MaxInt32 || math.Abs(dy) > math.MaxInt32 {
+		return math.NaN()
+	}
+	return state.Field(v.Expr, int(dx), int(dy))
+}
+
+// blur is the mean of the field around the current pixel weighted by a Gaussian, which is cut off at 3 standard
+// deviations or maxNeighbourhoodRadius pixels.
+func (v Convolution) blur(state State) float64 {
+	sigma := v.Args[0].Evaluate(state)
+	if math.IsNaN(sigma) {
+		return math.NaN()
+	}
+	if sigma <= 0 {
+		return state.Field(v.Expr, 0, 0)
+	}
+	reach := int(math.Min(math.Ceil(3*sigma), maxNeighbourhoodRadius))
+	sum, total := 0.0, 0.0
+	for dx := -reach; dx <= reach; dx++ {
+		for dy := -reach; dy <= reach; dy++ {
+			w := math.Exp(-float64(dx*dx+dy*dy) / (2 * sigma * sigma))
+			sum += w * state.Field(v.Expr, dx, dy)
+			total += w
+		}
+	}
+	return sum / total
+}
+
+func (v Convolution) String() string {
+	args := []string{v.Expr.String()}
+	for _, arg := range v.Args {
+		args = append(args, arg.String())
+	}
+	return fmt.Sprintf("%s(%s)", v.Name, strings.Join(args, ", "))
+}
+
+func (v Convolution) Simplify() Expression {
+	v.Expr = removeBrackets(v.Expr.Simplify())
+	args := make([]Expression, len(v.Args))
+	for i, arg := range v.Args {
+		args[i] = removeBrackets(arg.Simplify())
+	}
+	v.Args = args
+	return &v
+}
+
+func (v Convolution) Depth() int {
+	return maxDepth(append([]Expression{v.Expr}, v.Args...)...)
+}
+
+// argumentNames describes the arguments after the expression for errors.
+func (v Convolution) argumentNames() string {
+	if strings.EqualFold(v.Name, "blur") {
+		return "radius"
+	}
+	return "offset"
+}
+
+// convolutionArity returns how many arguments the convolution name takes, the expression included, or 0 when it isn't
+// one.
+func convolutionArity(name string) int {
+	switch strings.ToUpper(name) {
+	case "LAPLACE":
+		return 1
+	case "BLUR":
+		return 2
+	case "AT":
+		return 3
+	}
+	return 0
+}
+
+// usesConvolution reports whether e reads a field, directly or through a function it calls.
+func usesConvolution(e Expression) bool {
+	switch e := e.(type) {
+	case *Convolution:
+		return true
+	case *UserFunctionCall:
+		if usesConvolution(e.Function.Body) {
+			return true
+		}
+	}
+	for _, child := range children(e) {
+		if usesConvolution(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConvolutions reports an error against the tokens when the expression of a laplace, blur or at can't be plotted
+// over the whole frame before the rest of the formula: when it uses one of varying, variables such as the index of a
+// sum or the parameters of a function whose value changes as the formula is worked out, or is inside an accumulate,
+// which works out other frames. For the same reason an accumulate can't read prev, disc or ring, which the Accumulate's
+// Bindings must already be set to check. Accumulates which use none of varying are marked to be carried from one frame
+// to the next.
+func (lex *CalcLexer) checkConvolutions(e Expression, varying []string, tokens []lexedToken) bool {
+	switch e := e.(type) {
+	case *Accumulate:
+		e.carried = firstUsed(e.Expr, varying) == ""
+		if usesConvolution(e.Expr) {
+			lex.fail(findToken(tokens, "accumulate"), "laplace, blur and at can't be used inside accumulate", "they read the current frame only, accumulate the expression inside them instead")
+			return false
+		}
+		if e.readsPrev() {
+			lex.fail(findToken(tokens, "accumulate"), "prev, disc and ring can't be used inside accumulate", "they read the frame before the current one only, use prev itself for a running total, as in 0 = prev + sin(x + t)")
+			return false
+		}
+	case *Convolution:
+		if changing := firstUsed(e.Expr, varying); changing != "" {
+			lex.fail(findToken(tokens, e.Name), fmt.Sprintf("%s can't use %s, its expression is plotted over the whole frame at once", e.Name, changing), "use x, y, t and the variables bound before it in the expression")
+			return false
+		}
+	}
+	for _, child := range children(e) {
+		inner := varying
+		if index, ok := boundIn(e, child); ok {
+			inner = append(varying[:len(varying):len(varying)], index)
+		}
+		if !lex.checkConvolutions(child, inner, tokens) {
+			return false
+		}
+	}
+	return true
+}
+
+// firstUsed is the first variable in e which is one of names, or "" when there isn't one.
+func firstUsed(e Expression, names []string) string {
+	used := ""
+	visitVars(e, func(v *Var) {
+		for _, name := range names {
+			if used == "" && strings.EqualFold(v.Var, name) {
+				used = v.Var
+			}
+		}
+	})
+	return used
+}
+
+// fieldPlotter plots a frame's fields, the expressions laplace, blur and at read around each pixel, keeping them in
+// fields by expression. It also makes the RealState for each pixel of the frame itself, which reads them.
+type fieldPlotter struct {
+	function  *Function
+	size      image.Rectangle
+	previous  *Plot
+	t         float64
+	pointSize float64
+	frames    timeline
+	fields    map[Expression]*Plot
+	// carried are the running totals of the accumulates in the frame before, totals those in this one.
+	carried, totals *frameTotals
+	// tUsed is set when plotting a field reads t or prev.
+	tUsed bool
+}
+
+func newFieldPlotter(function *Function, size image.Rectangle, previous *Plot, t, pointSize float64, frames timeline) *fieldPlotter {
+	return &fieldPlotter{
+		function:  function,
+		size:      size,
+		previous:  previous,
+		t:         t,
+		pointSize: pointSize,
+		frames:    frames,
+		fields:    map[Expression]*Plot{},
+		totals:    newFrameTotals(frames, t),
+	}
+}
+
+// state is the RealState of the pixel x, y.
+func (p *fieldPlotter) state(x, y int) *RealState {
+	return &RealState{
+		X:        float64(x) * p.pointSize,
+		Y:        float64(y) * p.pointSize,
+		T:        p.t,
+		Seed:     p.function.Seed,
+		Previous: p.previous,
+		Pixel:    image.Pt(x, y),
+		Boundary: p.function.Boundary,
+		Fields:   p.fields,
+		frames:   p.frames,
+		carried:  p.carried,
+		totals:   p.totals,
+	}
+}
+
+// plotStatements plots the fields of the formula, those in each binding with the bindings before it, those in the
+// final statement with all of them, the fields inside each field first.
+func (p *fieldPlotter) plotStatements() {
+	for i, b := range p.function.Bindings {
+		p.plotFields(b.Expr, p.function.Bindings[:i])
+	}
+	if p.function.Colour != nil {
+		p.plotFields(p.function.Colour, p.function.Bindings)
+	} else if p.function.Equals != nil {
+		p.plotFields(p.function.Equals, p.function.Bindings)
+	}
+}
+
+// plotFields plots the fields in e, bindings being evaluated at each pixel before them. The body of a function called
+// is plotted without, as it can't see them.
+func (p *fieldPlotter) plotFields(e Expression, bindings []*Binding) {
+	switch e := e.(type) {
+	case *Derivative:
+		p.plotFields(e.Result, bindings)
+		return
+	case *UserFunctionCall:
+		p.plotFields(e.Function.Body, nil)
+	}
+	for _, child := range children(e) {
+		p.plotFields(child, bindings)
+	}
+	c, ok := e.(*Convolution)
+	if !ok {
+		return
+	}
+	if _, done := p.fields[c.Expr]; done {
+		return
+	}
+	field := &Plot{
+		Size:   p.size,
+		Values: make([]float64, p.size.Dy()*p.size.Dx()),
+		T:      p.t,
+	}
+	for x := p.size.Min.X; x < p.size.Max.X; x++ {
+		for y := p.size.Min.Y; y < p.size.Max.Y; y++ {
+			state := p.state(x, y)
+			for _, b := range bindings {
+				b.Evaluate(state)
+			}
+			field.Set(x, y, c.Expr.Evaluate(state))
+			p.tUsed = p.tUsed || state.AccessedT || state.AccessedPrev
+		}
+	}
+	p.fields[c.Expr] = field
+}
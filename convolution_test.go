@@ -0,0 +1,241 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"testing"
+)
+
+func TestConvolution(t *testing.T) {
+	size := image.Rect(-6, -6, 7, 7)
+	for eachI, each := range []struct {
+		Formula  string
+		String   string
+		Boundary Boundary
+		// Expected is NaN where the value isn't checked.
+		Expected func(x, y int) float64
+	}{
+		{
+			Formula:  "0 = at(x, 1, 0)",
+			String:   "0 = at(x, 1, 0)",
+			Expected: func(x, y int) float64 { return math.Min(float64(x+1), 6) },
+		},
+		{
+			Formula:  "0 = at(x, 1, 0)",
+			String:   "0 = at(x, 1, 0)",
+			Boundary: BoundaryWrap,
+			Expected: func(x, y int) float64 { return float64((x+1+6)%13 - 6) },
+		},
+		{
+			Formula:  "0 = at(y + 10, 0, -0.6)",
+			String:   "0 = at(y + 10, 0, -0.6)",
+			Boundary: BoundaryZero,
+			Expected: func(x, y int) float64 {
+				if y == -6 {
+					return 0
+				}
+				return float64(y - 1 + 10)
+			},
+		},
+		{
+			Formula: "0 = laplace(x^2 + y^2)",
+			String:  "0 = laplace(x ^ 2 + y ^ 2)",
+			Expected: func(x, y int) float64 {
+				if x == -6 || x == 6 || y == -6 || y == 6 {
+					return math.NaN()
+				}
+				return 4
+			},
+		},
+		{
+			Formula:  "0 = blur(5, 2)",
+			String:   "0 = blur(5, 2)",
+			Expected: func(x, y int) float64 { return 5 },
+		},
+		{
+			Formula: "0 = blur(x - y, 1)",
+			String:  "0 = blur(x - y, 1)",
+			Expected: func(x, y int) float64 {
+				if x < -3 || x > 3 || y < -3 || y > 3 {
+					return math.NaN()
+				}
+				return float64(x - y)
+			},
+		},
+		{
+			Formula:  "0 = blur(x, -1) + blur(x, 0)",
+			String:   "0 = blur(x, -1) + blur(x, 0)",
+			Expected: func(x, y int) float64 { return float64(2 * x) },
+		},
+		{
+			Formula:  "0 = at(at(x, 1, 0), 1, 0)",
+			String:   "0 = at(at(x, 1, 0), 1, 0)",
+			Expected: func(x, y int) float64 { return math.Min(float64(x+2), 6) },
+		},
+		{
+			Formula:  "a = x * 2; b = at(a, -1, 0); 0 = b + at(b, -1, 0)",
+			String:   "a = x * 2; b = at(a, -1, 0); 0 = b + at(b, -1, 0)",
+			Expected: func(x, y int) float64 { return 2*math.Max(float64(x-1), -6) + 2*math.Max(float64(x-2), -6) },
+		},
+		{
+			Formula:  "f(a) = a + at(y, 0, 1); 0 = f(x)",
+			String:   "f(a) = a + at(y, 0, 1); 0 = f(x)",
+			Expected: func(x, y int) float64 { return float64(x) + math.Min(float64(y+1), 6) },
+		},
+		{
+			Formula:  "0 = d(at(x^2, 1, 0), x)",
+			String:   "0 = d(at(x ^ 2, 1, 0), x)",
+			Expected: func(x, y int) float64 { return 2 * math.Min(float64(x+1), 6) },
+		},
+		{
+			Formula:  "0 = AT(x, 1, 0) - at(x, 1, 0)",
+			String:   "0 = AT(x, 1, 0) - at(x, 1, 0)",
+			Expected: func(x, y int) float64 { return 0 },
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.String() != each.String {
+				t.Errorf("Got %#v expected %#v", f.String(), each.String)
+			}
+			if _, err := ParseFunctionE(f.Simplify().String()); err != nil {
+				t.Errorf("Reparse failed: %v", err)
+			}
+			f.Boundary = each.Boundary
+			plot, tUsed, err := f.PlotForT(size, 0, 1)
+			if err != nil {
+				t.Fatalf("Plot failed: %v", err)
+			}
+			if tUsed {
+				t.Errorf("T used")
+			}
+			for x := size.Min.X; x < size.Max.X; x++ {
+				for y := size.Min.Y; y < size.Max.Y; y++ {
+					expected := each.Expected(x, y)
+					if got := plot.Get(x, y); !math.IsNaN(expected) && math.Abs(got-expected) > 1e-9 {
+						t.Errorf("At %d, %d got %v expected %v", x, y, got, expected)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestConvolutionFrames(t *testing.T) {
+	size := image.Rect(-2, -2, 2, 2)
+	f, err := ParseFunctionE("prev = x; 0 = at(prev, 1, 0) + 0 * blur(t, 1)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	tUsed, plots := f.Plot(0, 3, 1, size, 1)
+	if !tUsed || len(plots) != 3 {
+		t.Fatalf("Got %d plots T used %v", len(plots), tUsed)
+	}
+	for frame, plot := range plots {
+		for x := size.Min.X; x < size.Max.X; x++ {
+			if got, expected := plot.Get(x, 0), math.Min(float64(x+frame+1), 1); got != expected {
+				t.Errorf("Frame %d at %d got %v expected %v", frame, x, got, expected)
+			}
+		}
+	}
+	f, err = ParseFunctionE("0 = blur(sin(t), 1)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if tUsed, plots := f.Plot(0, 3, 1, size, 1); !tUsed || len(plots) != 3 {
+		t.Errorf("Got %d plots T used %v", len(plots), tUsed)
+	}
+}
+
+func TestConvolutionColour(t *testing.T) {
+	f, err := ParseFunctionE("rgb(at(x, 1, 0) / 4 + 0.5, 0, 0)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	size := image.Rect(-2, -2, 2, 2)
+	plot, _, err := f.PlotColourForT(size, 0, 1)
+	if err != nil {
+		t.Fatalf("Plot failed: %v", err)
+	}
+	for x := size.Min.X; x < size.Max.X; x++ {
+		if got, expected := plot.Get(x, 0).R, channel(math.Min(float64(x+1), 1)/4+0.5); got != expected {
+			t.Errorf("At %d got %v expected %v", x, got, expected)
+		}
+	}
+}
+
+func TestConvolutionAtAPoint(t *testing.T) {
+	f, err := ParseFunctionE("0 = laplace(x)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got, _, err := f.Evaluate(1, 2, 0); err != nil || !math.IsNaN(got) {
+		t.Errorf("Got %v %v expected NaN", got, err)
+	}
+}
+
+func TestConvolutionErrors(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula string
+		Complex bool
+		Column  int
+		Reason  string
+	}{
+		{
+			Formula: "0 = blur(x)",
+			Column:  5,
+			Reason:  "blur takes 2 arguments but was given 1",
+		},
+		{
+			Formula: "0 = sum(k = 1, 3, at(x * k, 1, 0))",
+			Column:  19,
+			Reason:  "at can't use k, its expression is plotted over the whole frame at once",
+		},
+		{
+			Formula: "f(a) = laplace(a * x); 0 = f(1)",
+			Column:  8,
+			Reason:  "laplace can't use a, its expression is plotted over the whole frame at once",
+		},
+		{
+			Formula: "0 = accumulate(blur(x, 1))",
+			Column:  5,
+			Reason:  "laplace, blur and at can't be used inside accumulate",
+		},
+		{
+			Formula: "0 = z + laplace(z)",
+			Complex: true,
+			Column:  1,
+			Reason:  "laplace(z) isn't defined for complex numbers",
+		},
+		{
+			Formula: "y = d(blur(x, x), x)",
+			Column:  5,
+			Reason:  "blur has no derivative with respect to x when its radius depends on it",
+		},
+		{
+			Formula: "y = d(laplace(x), r)",
+			Column:  5,
+			Reason:  "laplace has no derivative with respect to r",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			parse := ParseFunctionE
+			if each.Complex {
+				parse = ParseComplexFunctionE
+			}
+			_, err := parse(each.Formula)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a *ParseError got %#v", err)
+			}
+			if pe.Column != each.Column || pe.Reason != each.Reason {
+				t.Errorf("Got column %d %#v expected column %d %#v", pe.Column, pe.Reason, each.Column, each.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,782 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+var (
+	// SingleFunctionDerivatives give the derivative of a SingleFunctions entry at u, the chain rule then multiplies it
+	// by the derivative of u.
+	SingleFunctionDerivatives map[string]func(u Expression) Expression
+	// DoubleFunctionDerivatives give the partial derivatives of a DoubleFunctions entry with respect to each argument.
+	DoubleFunctionDerivatives map[string]func(a, b Expression) (da, db Expression)
+	// VariadicFunctionDerivatives give the partial derivatives of a VariadicFunctions entry with respect to each
+	// argument.
+	VariadicFunctionDerivatives map[string]func(args []Expression) []Expression
+)
+
+// Derivative is d(expr, variable), Expr differentiated with respect to one of the built in variables, as in
+// "y = d(sin(x * y), x)". It prints as it was written, Result is the derivative worked out when the formula was parsed
+// and is what is evaluated.
+type Derivative struct {
+	Expr     Expression
+	Variable string
+	Result   Expression
+}
+
+func (v Derivative) Evaluate(state State) float64 {
+	return v.Result.Evaluate(state)
+}
+
+func (v Derivative) String() string {
+	return fmt.Sprintf("d(%s, %s)", v.Expr.String(), v.Variable)
+}
+
+func (v Derivative) Simplify() Expression {
+	v.Expr = removeBrackets(v.Expr.Simplify())
+	v.Result = v.Result.Simplify()
+	return &v
+}
+
+func (v Derivative) Depth() int {
+	return maxDepth(v.Expr)
+}
+
+// Differentiate returns the derivative of expr with respect to variable, simplified. Every other variable is held
+// constant except that r and theta change with x and y and the other way around. It panics if expr uses a function
+// with no derivative, see DifferentiateE.
+func Differentiate(expr Expression, variable string) Expression {
+	result, err := DifferentiateE(expr, variable)
+	if err != nil {
+		log.Panic(err)
+	}
+	return result
+}
+
+// DifferentiateE is Differentiate returning an error when expr uses a function with no derivative, such as rand.
+func DifferentiateE(expr Expression, variable string) (Expression, error) {
+	result, err := derivative(expr, variable, nil)
+	if err != nil {
+		return nil, err
+	}
+	return result.Simplify(), nil
+}
+
+// derivativeScope is a variable bound around the expression being differentiated. Expr is what a binding gives it, or
+// nil for a function parameter or the index of a sum, which are independent of every other variable. IsVariable is set
+// on the parameter a function's partial derivative is being taken with respect to.
+type derivativeScope struct {
+	Name       string
+	Expr       Expression
+	IsVariable bool
+	parent     *derivativeScope
+}
+
+func (s *derivativeScope) lookup(name string) (*derivativeScope, bool) {
+	for ; s != nil; s = s.parent {
+		if strings.EqualFold(s.Name, name) {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+func (s *derivativeScope) bind(name string, expr Expression) *derivativeScope {
+	return &derivativeScope{
+		Name:   name,
+		Expr:   expr,
+		parent: s,
+	}
+}
+
+// independent binds name as a variable which isn't given by an expression.
+func (s *derivativeScope) independent(name string, isVariable bool) *derivativeScope {
+	return &derivativeScope{
+		Name:       name,
+		IsVariable: isVariable,
+		parent:     s,
+	}
+}
+
+// derivative differentiates e with respect to variable, without simplifying.
+func derivative(e Expression, variable string, scope *derivativeScope) (Expression, error) {
+	d := func(e Expression) (Expression, error) {
+		return derivative(e, variable, scope)
+	}
+	switch e := e.(type) {
+	case *Const, *NamedConstant:
+		return num(0), nil
+	case *Var:
+		return varDerivative(e.Var, variable, scope)
+	case *Brackets:
+		return d(e.Expr)
+	case *Negate:
+		de, err := d(e.Expr)
+		return neg(de), err
+	case *Plus, *Subtract, *Multiply, *Divide, *Power, *Modulus, *Equals:
+		lhs, rhs := children(e)[0], children(e)[1]
+		dl, err := d(lhs)
+		if err != nil {
+			return nil, err
+		}
+		dr, err := d(rhs)
+		if err != nil {
+			return nil, err
+		}
+		switch e.(type) {
+		case *Plus:
+			return add(dl, dr), nil
+		case *Subtract:
+			return sub(dl, dr), nil
+		case *Multiply:
+			return add(mul(dl, rhs), mul(lhs, dr)), nil
+		case *Divide:
+			if isConst(dr, 0) {
+				return div(dl, rhs), nil
+			}
+			return div(sub(mul(dl, rhs), mul(lhs, dr)), pow(rhs, num(2))), nil
+		case *Power:
+			if isConst(dr, 0) {
+				return mul(mul(rhs, pow(lhs, sub(rhs, num(1)))), dl), nil
+			}
+			return mul(pow(lhs, rhs), add(mul(dr, call("log", lhs)), div(mul(rhs, dl), lhs))), nil
+		case *Modulus:
+			return sub(dl, mul(dr, call("trunc", div(lhs, rhs)))), nil
+		}
+		return &Equals{LHS: dl, RHS: dr}, nil
+	case *LessThan, *LessOrEqual, *GreaterThan, *GreaterOrEqual, *EqualTo, *NotEqualTo, *And, *Or, *Not:
+		// Comparisons and logic only step between 0 and 1.
+		return num(0), nil
+	case *If:
+		then, err := d(e.Then)
+		if err != nil {
+			return nil, err
+		}
+		otherwise, err := d(e.Else)
+		if err != nil {
+			return nil, err
+		}
+		return &If{Condition: e.Condition, Then: then, Else: otherwise}, nil
+	case *Piecewise:
+		result := &Piecewise{Conditions: e.Conditions, Values: make([]Expression, len(e.Values))}
+		for i, value := range e.Values {
+			dv, err := d(value)
+			if err != nil {
+				return nil, err
+			}
+			result.Values[i] = dv
+		}
+		if e.Otherwise != nil {
+			dv, err := d(e.Otherwise)
+			if err != nil {
+				return nil, err
+			}
+			result.Otherwise = dv
+		}
+		return result, nil
+	case *NFunction:
+		return functionDerivative(e, variable, scope)
+	case *UserFunctionCall:
+		return userFunctionDerivative(e, variable, scope)
+	case *Summation:
+		return summationDerivative(e, variable, scope)
+	case *Integral:
+		return integralDerivative(e, variable, scope)
+	case *Iterate:
+		return nil, fmt.Errorf("%s has no derivative", strings.ToLower(e.Name))
+	case *Prev:
+		return nil, errors.New("prev has no derivative")
+	case *Convolution:
+		return convolutionDerivative(e, variable, scope)
+	case *Neighbourhood:
+		return nil, fmt.Errorf("%s has no derivative", strings.ToLower(e.Name))
+	case *ImageSample:
+		return nil, fmt.Errorf("%s has no derivative", strings.ToLower(e.Name))
+	case *Accumulate:
+		if polarName(variable) == "T" {
+			return nil, errors.New("accumulate has no derivative with respect to t")
+		}
+		body, err := d(e.Expr)
+		if err != nil || isConst(body, 0) {
+			return body, err
+		}
+		return &Accumulate{Expr: body, Bindings: e.Bindings, carried: e.carried}, nil
+	case *Derivative:
+		return d(e.Result)
+	}
+	return nil, fmt.Errorf("%s has no derivative", e.String())
+}
+
+// varDerivative differentiates the variable name. Bound variables are differentiated through what they are bound to,
+// the built in variables follow x = r cos(theta) and y = r sin(theta).
+func varDerivative(name, variable string, scope *derivativeScope) (Expression, error) {
+	if bound, ok := scope.lookup(name); ok {
+		if bound.Expr == nil {
+			return num(truth(bound.IsVariable)), nil
+		}
+		return derivative(bound.Expr, variable, bound.parent)
+	}
+	if isPrevVar(name) {
+		return nil, errors.New("prev has no derivative")
+	}
+	name, variable = polarName(name), polarName(variable)
+	if name == variable {
+		return num(1), nil
+	}
+	x, y := &Var{Var: "x"}, &Var{Var: "y"}
+	switch name + " " + variable {
+	case "R X":
+		return div(x, call("hypot", x, y)), nil
+	case "R Y":
+		return div(y, call("hypot", x, y)), nil
+	case "THETA X":
+		return div(neg(y), add(pow(x, num(2)), pow(y, num(2)))), nil
+	case "THETA Y":
+		return div(x, add(pow(x, num(2)), pow(y, num(2)))), nil
+	case "X R":
+		return call("cos", call("atan2", y, x)), nil
+	case "Y R":
+		return call("sin", call("atan2", y, x)), nil
+	case "X THETA":
+		return neg(y), nil
+	case "Y THETA":
+		return x, nil
+	}
+	return num(0), nil
+}
+
+// polarName upper cases name, with θ as THETA.
+func polarName(name string) string {
+	name = strings.ToUpper(name)
+	if name == "Θ" {
+		return "THETA"
+	}
+	return name
+}
+
+// functionDerivative applies the chain rule to a built in function using the derivatives in the registry.
+func functionDerivative(e *NFunction, variable string, scope *derivativeScope) (Expression, error) {
+	name := strings.ToUpper(e.Name)
+	partials, err := functionPartials(name, e.Args)
+	if err != nil {
+		return nil, err
+	}
+	result := Expression(num(0))
+	for i, arg := range e.Args {
+		da, err := derivative(arg, variable, scope)
+		if err != nil {
+			return nil, err
+		}
+		result = add(result, mul(partials[i], da))
+	}
+	return result, nil
+}
+
+// functionPartials picks the derivatives of the built in function name the same way NFunction.Evaluate picks its
+// definition.
+func functionPartials(name string, args []Expression) ([]Expression, error) {
+	_, random := RandomFunctions[name]
+	_, noise := NoiseFunctions[name]
+	switch {
+	case random || noise:
+	case len(args) == 0:
+		return nil, nil
+	case len(args) == 1 && SingleFunctions[name] != nil:
+		if f, ok := SingleFunctionDerivatives[name]; ok {
+			return []Expression{f(args[0])}, nil
+		}
+	case len(args) == 2 && DoubleFunctions[name] != nil:
+		if f, ok := DoubleFunctionDerivatives[name]; ok {
+			da, db := f(args[0], args[1])
+			return []Expression{da, db}, nil
+		}
+	default:
+		if f, ok := VariadicFunctionDerivatives[name]; ok {
+			return f(args), nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no derivative", strings.ToLower(name))
+}
+
+// userFunctionDerivative applies the chain rule to a call of a function declared in the formula. The partial
+// derivatives of its body are functions in their own right, named after the parameter as in ring_dr, with the
+// derivative with respect to the built in variable its body uses directly as ring_dx.
+func userFunctionDerivative(e *UserFunctionCall, variable string, scope *derivativeScope) (Expression, error) {
+	uf := e.Function
+	params := func(variable string) *derivativeScope {
+		var scope *derivativeScope
+		for _, p := range uf.Params {
+			scope = scope.independent(p, strings.EqualFold(p, variable))
+		}
+		return scope
+	}
+	partial := func(name string) (Expression, error) {
+		body, err := derivative(uf.Body, name, params(name))
+		if err != nil || isConst(body, 0) {
+			return body, err
+		}
+		return &UserFunctionCall{
+			Name: fmt.Sprintf("%s_d%s", uf.Name, name),
+			Function: &UserFunction{
+				Name:   fmt.Sprintf("%s_d%s", uf.Name, name),
+				Params: uf.Params,
+				Body:   body,
+			},
+			Args: e.Args,
+		}, nil
+	}
+	result := Expression(num(0))
+	if _, shadowed := params("").lookup(variable); !shadowed {
+		direct, err := partial(variable)
+		if err != nil {
+			return nil, err
+		}
+		result = direct
+	}
+	for i, arg := range e.Args {
+		da, err := derivative(arg, variable, scope)
+		if err != nil {
+			return nil, err
+		}
+		if isConst(da, 0) {
+			continue
+		}
+		dp, err := partial(uf.Params[i])
+		if err != nil {
+			return nil, err
+		}
+		result = add(result, mul(dp, da))
+	}
+	return result, nil
+}
+
+// summationDerivative differentiates a sum term by term. A prod uses the product rule, the sum over j of the
+// derivative of the j-th term times the other terms, with the index of the outer sum named after the prod's plus _.
+func summationDerivative(e *Summation, variable string, scope *derivativeScope) (Expression, error) {
+	body, err := derivative(e.Body, variable, scope.independent(e.Index, false))
+	if err != nil {
+		return nil, err
+	}
+	if isConst(body, 0) {
+		return num(0), nil
+	}
+	if !e.isProduct() {
+		return &Summation{Name: "sum", Index: e.Index, From: e.From, To: e.To, Body: body}, nil
+	}
+	j := e.Index + "_"
+	term := body
+	if usesVar(body, e.Index) {
+		term = &Summation{Name: "sum", Index: e.Index, From: &Var{Var: j}, To: &Var{Var: j}, Body: body}
+	}
+	others := &Summation{
+		Name:  e.Name,
+		Index: e.Index,
+		From:  e.From,
+		To:    e.To,
+		Body:  &If{Condition: &EqualTo{LHS: &Var{Var: e.Index}, RHS: &Var{Var: j}}, Then: num(1), Else: e.Body},
+	}
+	return &Summation{Name: "sum", Index: j, From: e.From, To: e.To, Body: mul(term, others)}, nil
+}
+
+// integralDerivative is the Leibniz rule, the integral of the derivative of the integrand plus the integrand at each
+// bound times how fast that bound moves. The integrand at a bound is written as a sum with one term.
+func integralDerivative(e *Integral, variable string, scope *derivativeScope) (Expression, error) {
+	body, err := derivative(e.Body, variable, scope.independent(e.Index, false))
+	if err != nil {
+		return nil, err
+	}
+	dFrom, err := derivative(e.From, variable, scope)
+	if err != nil {
+		return nil, err
+	}
+	dTo, err := derivative(e.To, variable, scope)
+	if err != nil {
+		return nil, err
+	}
+	at := func(bound Expression) Expression {
+		if !usesVar(e.Body, e.Index) {
+			return e.Body
+		}
+		return &Summation{Name: "sum", Index: e.Index, From: bound, To: bound, Body: e.Body}
+	}
+	var result Expression = num(0)
+	if !isConst(body, 0) {
+		result = &Integral{Index: e.Index, From: e.From, To: e.To, Body: body}
+	}
+	if !isConst(dTo, 0) {
+		result = add(result, mul(at(e.To), dTo))
+	}
+	if !isConst(dFrom, 0) {
+		result = sub(result, mul(at(e.From), dFrom))
+	}
+	return result, nil
+}
+
+// differentiate works out the Result of every Derivative in e, innermost first. scope holds the variables bound
+// before e.
+func (lex *CalcLexer) differentiate(e Expression, scope *derivativeScope, tokens []lexedToken) bool {
+	for _, child := range children(e) {
+		childScope := scope
+		if index, ok := boundIn(e, child); ok {
+			childScope = scope.independent(index, false)
+		}
+		if !lex.differentiate(child, childScope, tokens) {
+			return false
+		}
+	}
+	d, ok := e.(*Derivative)
+	if !ok {
+		return true
+	}
+	result, err := derivative(d.Expr, d.Variable, scope)
+	if err != nil {
+		lex.fail(findToken(tokens, "d"), err.Error(), "only the built in functions with a derivative, the arithmetic and functions declared with them can be differentiated")
+		return false
+	}
+	d.Result = result.Simplify()
+	return true
+}
+
+// derivativeCall recognises d(expr, variable) and returns nil for every other call. Only the built in variables can
+// be differentiated with respect to.
+func (lex *CalcLexer) derivativeCall(name string, args []Expression) (*Derivative, error) {
+	if !strings.EqualFold(name, "d") {
+		return nil, nil
+	}
+	if len(args) == 2 {
+		if v, ok := args[1].(*Var); ok && isBuiltinVar(v.Var) {
+			return &Derivative{Expr: args[0], Variable: v.Var}, nil
+		}
+	}
+	return nil, errors.New("d takes an expression and one of x, y, t, r or theta")
+}
+
+// precedence is how tightly e binds when printed, so the expressions derivatives are built from can be bracketed
+// where they need to be.
+func precedence(e Expression) int {
+	switch e := e.(type) {
+	case *Equals, *Binding:
+		return 0
+	case *Or:
+		return 1
+	case *And:
+		return 2
+	case *LessThan, *LessOrEqual, *GreaterThan, *GreaterOrEqual, *EqualTo, *NotEqualTo:
+		return 3
+	case *Plus, *Subtract:
+		return 4
+	case *Multiply, *Divide, *Modulus:
+		return 5
+	case *NFunction:
+		if e.Infix {
+			return 5
+		}
+	case *Negate, *Not:
+		return 6
+	case *Const:
+		if e.Value < 0 {
+			return 6
+		}
+	case *Power:
+		return 7
+	}
+	return 8
+}
+
+// bracket wraps e in brackets when it binds less tightly than min.
+func bracket(e Expression, min int) Expression {
+	if precedence(e) < min {
+		return &Brackets{Expr: e}
+	}
+	return e
+}
+
+func num(f float64) *Const {
+	return &Const{Value: f}
+}
+
+func call(name string, args ...Expression) *NFunction {
+	return &NFunction{Name: name, Args: args}
+}
+
+// isConst reports whether e is the constant value, ignoring brackets.
+func isConst(e Expression, value float64) bool {
+	c, ok := removeBrackets(e).(*Const)
+	return ok && c.Value == value
+}
+
+// constValue returns the value of e when it is a constant.
+func constValue(e Expression) (float64, bool) {
+	c, ok := removeBrackets(e).(*Const)
+	if !ok {
+		return 0, false
+	}
+	return c.Value, true
+}
+
+// usesVar reports whether the variable name appears in e.
+func usesVar(e Expression, name string) bool {
+	used := false
+	visitVars(e, func(v *Var) {
+		used = used || strings.EqualFold(v.Var, name)
+	})
+	return used
+}
+
+// same reports whether a and b are written the same, and so have the same value.
+func same(a, b Expression) bool {
+	return removeBrackets(a).String() == removeBrackets(b).String()
+}
+
+// The constructors below drop the terms of the derivative which are 0 and the factors which are 1, work out the
+// arithmetic of constants and move minus signs outwards, so the derivative is readable.
+
+func add(a, b Expression) Expression {
+	av, aok := constValue(a)
+	bv, bok := constValue(b)
+	switch {
+	case aok && bok:
+		return num(av + bv)
+	case aok && av == 0:
+		return b
+	case bok && bv == 0:
+		return a
+	}
+	if n, ok := b.(*Negate); ok {
+		return sub(a, removeBrackets(n.Expr))
+	}
+	return &Plus{LHS: bracket(a, 4), RHS: bracket(b, 5)}
+}
+
+func sub(a, b Expression) Expression {
+	av, aok := constValue(a)
+	bv, bok := constValue(b)
+	switch {
+	case aok && bok:
+		return num(av - bv)
+	case aok && av == 0:
+		return neg(b)
+	case bok && bv == 0:
+		return a
+	case same(a, b):
+		return num(0)
+	}
+	return &Subtract{LHS: bracket(a, 4), RHS: bracket(b, 5)}
+}
+
+func mul(a, b Expression) Expression {
+	av, aok := constValue(a)
+	bv, bok := constValue(b)
+	switch {
+	case aok && bok:
+		return num(av * bv)
+	case aok && av == 0, bok && bv == 0:
+		return num(0)
+	case aok && av == 1:
+		return b
+	case bok && bv == 1:
+		return a
+	case aok && av == -1:
+		return neg(b)
+	case bok && bv == -1:
+		return neg(a)
+	case bok:
+		// Constants go first, as in 2 * x.
+		return mul(b, a)
+	}
+	if n, ok := removeBrackets(a).(*Negate); ok {
+		return neg(mul(n.Expr, b))
+	}
+	if n, ok := removeBrackets(b).(*Negate); ok {
+		return neg(mul(a, n.Expr))
+	}
+	if d, ok := removeBrackets(a).(*Divide); ok && isConst(d.LHS, 1) {
+		return div(b, d.RHS)
+	}
+	if d, ok := removeBrackets(b).(*Divide); ok && isConst(d.LHS, 1) {
+		return div(a, d.RHS)
+	}
+	if m, ok := removeBrackets(b).(*Multiply); ok && aok {
+		if mv, ok := constValue(m.LHS); ok {
+			return mul(num(av*mv), m.RHS)
+		}
+	}
+	switch removeBrackets(b).(type) {
+	case *Multiply, *Divide:
+		// a * (b * c) is a * b * c.
+		return &Multiply{LHS: bracket(a, 5), RHS: removeBrackets(b)}
+	}
+	return &Multiply{LHS: bracket(a, 5), RHS: bracket(b, 6)}
+}
+
+func div(a, b Expression) Expression {
+	av, aok := constValue(a)
+	bv, bok := constValue(b)
+	switch {
+	case aok && bok && bv != 0:
+		return num(av / bv)
+	case aok && av == 0:
+		return num(0)
+	case bok && bv == 1:
+		return a
+	case same(a, b):
+		return num(1)
+	}
+	return &Divide{LHS: bracket(a, 5), RHS: bracket(b, 6)}
+}
+
+func pow(a, b Expression) Expression {
+	switch {
+	case isConst(b, 0):
+		return num(1)
+	case isConst(b, 1):
+		return a
+	}
+	return &Power{LHS: bracket(a, 8), RHS: bracket(b, 7)}
+}
+
+func neg(a Expression) Expression {
+	switch e := removeBrackets(a).(type) {
+	case *Const:
+		return num(-e.Value)
+	case *Negate:
+		return e.Expr
+	}
+	return &Negate{Expr: bracket(a, 6)}
+}
+
+func init() {
+	two := num(2)
+	one := num(1)
+	SingleFunctionDerivatives = map[string]func(u Expression) Expression{
+		"SIN":   func(u Expression) Expression { return call("cos", u) },
+		"COS":   func(u Expression) Expression { return neg(call("sin", u)) },
+		"TAN":   func(u Expression) Expression { return div(one, pow(call("cos", u), two)) },
+		"ASIN":  func(u Expression) Expression { return div(one, call("sqrt", sub(one, pow(u, two)))) },
+		"ACOS":  func(u Expression) Expression { return neg(div(one, call("sqrt", sub(one, pow(u, two))))) },
+		"ATAN":  func(u Expression) Expression { return div(one, add(one, pow(u, two))) },
+		"SINH":  func(u Expression) Expression { return call("cosh", u) },
+		"COSH":  func(u Expression) Expression { return call("sinh", u) },
+		"TANH":  func(u Expression) Expression { return sub(one, pow(call("tanh", u), two)) },
+		"ASINH": func(u Expression) Expression { return div(one, call("sqrt", add(pow(u, two), one))) },
+		"ACOSH": func(u Expression) Expression { return div(one, call("sqrt", sub(pow(u, two), one))) },
+		"ATANH": func(u Expression) Expression { return div(one, sub(one, pow(u, two))) },
+		"EXP":   func(u Expression) Expression { return call("exp", u) },
+		"EXPM1": func(u Expression) Expression { return call("exp", u) },
+		"EXP2":  func(u Expression) Expression { return mul(call("exp2", u), call("log", two)) },
+		"LOG":   func(u Expression) Expression { return div(one, u) },
+		"LOG10": func(u Expression) Expression { return div(one, mul(u, call("log", num(10)))) },
+		"LOG2":  func(u Expression) Expression { return div(one, mul(u, call("log", two))) },
+		"LOG1P": func(u Expression) Expression { return div(one, add(one, u)) },
+		"SQRT":  func(u Expression) Expression { return div(one, mul(two, call("sqrt", u))) },
+		"CBRT":  func(u Expression) Expression { return div(one, mul(num(3), pow(call("cbrt", u), two))) },
+		"ABS":   func(u Expression) Expression { return call("copysign", one, u) },
+		"ERF": func(u Expression) Expression {
+			return mul(div(two, call("sqrt", newNamedConstant("pi"))), call("exp", neg(pow(u, two))))
+		},
+		"ERFC": func(u Expression) Expression {
+			return neg(mul(div(two, call("sqrt", newNamedConstant("pi"))), call("exp", neg(pow(u, two)))))
+		},
+		"J0": func(u Expression) Expression { return neg(call("j1", u)) },
+		"Y0": func(u Expression) Expression { return neg(call("y1", u)) },
+	}
+	// The functions which step from one whole number to the next are flat in between.
+	for _, name := range []string{"FLOOR", "CEIL", "TRUNC", "ROUND", "ROUNDTOEVEN", "INF", "ILOGB", "LOGB"} {
+		SingleFunctionDerivatives[name] = func(u Expression) Expression { return num(0) }
+	}
+	DoubleFunctionDerivatives = map[string]func(a, b Expression) (Expression, Expression){
+		"POW": func(a, b Expression) (Expression, Expression) {
+			return mul(b, pow(a, sub(b, one))), mul(pow(a, b), call("log", a))
+		},
+		"ATAN2": func(a, b Expression) (Expression, Expression) {
+			r2 := add(pow(a, two), pow(b, two))
+			return div(b, r2), div(neg(a), r2)
+		},
+		"HYPOT": func(a, b Expression) (Expression, Expression) {
+			return div(a, call("hypot", a, b)), div(b, call("hypot", a, b))
+		},
+		"MIN": func(a, b Expression) (Expression, Expression) {
+			first := &LessOrEqual{LHS: a, RHS: b}
+			return &If{Condition: first, Then: one, Else: num(0)}, &If{Condition: first, Then: num(0), Else: one}
+		},
+		"MAX": func(a, b Expression) (Expression, Expression) {
+			first := &GreaterOrEqual{LHS: a, RHS: b}
+			return &If{Condition: first, Then: one, Else: num(0)}, &If{Condition: first, Then: num(0), Else: one}
+		},
+		"DIM": func(a, b Expression) (Expression, Expression) {
+			above := &GreaterThan{LHS: a, RHS: b}
+			return &If{Condition: above, Then: one, Else: num(0)}, &If{Condition: above, Then: num(-1), Else: num(0)}
+		},
+		"MOD": func(a, b Expression) (Expression, Expression) {
+			return one, neg(call("trunc", div(a, b)))
+		},
+		"REMAINDER": func(a, b Expression) (Expression, Expression) {
+			return one, neg(call("roundtoeven", div(a, b)))
+		},
+		"COPYSIGN": func(a, b Expression) (Expression, Expression) {
+			return mul(call("copysign", one, a), call("copysign", one, b)), num(0)
+		},
+	}
+	VariadicFunctionDerivatives = map[string]func(args []Expression) []Expression{
+		"SUM": func(args []Expression) []Expression {
+			return each(args, func(i int) Expression { return one })
+		},
+		"MEAN": func(args []Expression) []Expression {
+			return each(args, func(i int) Expression { return num(1 / float64(len(args))) })
+		},
+		"PRODUCT": func(args []Expression) []Expression {
+			return each(args, func(i int) Expression {
+				others := append(append([]Expression{}, args[:i]...), args[i+1:]...)
+				if len(others) == 1 {
+					return others[0]
+				}
+				return call("product", others...)
+			})
+		},
+		"HYPOT": func(args []Expression) []Expression {
+			return each(args, func(i int) Expression { return div(args[i], call("hypot", args...)) })
+		},
+		"MIN": func(args []Expression) []Expression {
+			return each(args, func(i int) Expression {
+				return &If{Condition: &EqualTo{LHS: args[i], RHS: call("min", args...)}, Then: one, Else: num(0)}
+			})
+		},
+		"MAX": func(args []Expression) []Expression {
+			return each(args, func(i int) Expression {
+				return &If{Condition: &EqualTo{LHS: args[i], RHS: call("max", args...)}, Then: one, Else: num(0)}
+			})
+		},
+	}
+}
+
+// each builds a partial derivative for each argument.
+func each(args []Expression, partial func(i int) Expression) []Expression {
+	result := make([]Expression, len(args))
+	for i := range args {
+		result[i] = partial(i)
+	}
+	return result
+}
+
+// convolutionDerivative differentiates a laplace, blur or at. They add up shifted copies of their expression, so with
+// respect to x, y or t they are the same of its derivative, as long as the radius or offsets don't change with it.
+func convolutionDerivative(e *Convolution, variable string, scope *derivativeScope) (Expression, error) {
+	switch polarName(variable) {
+	case "X", "Y", "T":
+	default:
+		return nil, fmt.Errorf("%s has no derivative with respect to %s", strings.ToLower(e.Name), variable)
+	}
+	for _, arg := range e.Args {
+		if da, err := derivative(arg, variable, scope); err != nil || !isConst(da, 0) {
+			return nil, fmt.Errorf("%s has no derivative with respect to %s when its %s depends on it", strings.ToLower(e.Name), variable, e.argumentNames())
+		}
+	}
+	body, err := derivative(e.Expr, variable, scope)
+	if err != nil || isConst(body, 0) {
+		return body, err
+	}
+	return &Convolution{Name: e.Name, Expr: body, Args: e.Args}, nil
+}
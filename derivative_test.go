@@ -0,0 +1,181 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"testing"
+)
+
+func TestDifferentiate(t *testing.T) {
+	for eachI, each := range []struct {
+		Expr     string
+		Variable string
+		Expected string
+	}{
+		{Expr: "x^2", Variable: "x", Expected: "2 * x"},
+		{Expr: "3x^2 + 2x + 1", Variable: "x", Expected: "6 * x + 2"},
+		{Expr: "sin(x*y)", Variable: "x", Expected: "cos(x * y) * y"},
+		{Expr: "sin(x*y)", Variable: "y", Expected: "cos(x * y) * x"},
+		{Expr: "x / y", Variable: "x", Expected: "1 / y"},
+		{Expr: "x^x", Variable: "x", Expected: "x ^ x * (log(x) + 1)"},
+		{Expr: "log(x) * cos(x)", Variable: "x", Expected: "cos(x) / x - log(x) * sin(x)"},
+		{Expr: "exp(-x^2)", Variable: "x", Expected: "-(exp(-x ^ 2) * 2 * x)"},
+		{Expr: "r", Variable: "x", Expected: "x / hypot(x, y)"},
+		{Expr: "theta", Variable: "y", Expected: "x / (x ^ 2 + y ^ 2)"},
+		{Expr: "x", Variable: "theta", Expected: "-y"},
+		{Expr: "t^2 + x", Variable: "t", Expected: "2 * t"},
+		{Expr: "sum(k = 1, 3, x^k)", Variable: "x", Expected: "sum(k = 1, 3, k * x ^ (k - 1))"},
+		{Expr: "if(x > 0, x^2, -x)", Variable: "x", Expected: "if(x > 0, 2 * x, -1)"},
+		{Expr: "floor(x) + y", Variable: "x", Expected: "0"},
+	} {
+		t.Run(fmt.Sprintf("%d: d(%s, %s)", eachI, each.Expr, each.Variable), func(t *testing.T) {
+			f, err := ParseFunctionE("0 = " + each.Expr)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			result := Differentiate(f.Equals.RHS, each.Variable)
+			if result.String() != each.Expected {
+				t.Errorf("Got %#v expected %#v", result.String(), each.Expected)
+			}
+			if _, err := ParseFunctionE("0 = " + result.String()); err != nil {
+				t.Errorf("Reparse failed: %v", err)
+			}
+		})
+	}
+}
+
+// TestDerivativeNumeric compares d(...) with the central difference of what it differentiates.
+func TestDerivativeNumeric(t *testing.T) {
+	formulas := []string{
+		"x^3 - 2x*y + y^2",
+		"(x + 1) / (y - x)",
+		"x ^ y",
+		"2 ^ (x * y)",
+		"x % 0.7 + y % x",
+		"sin(x) ^ 2 + cos(x y)",
+		"r * theta",
+		"hypot(x, y, 2) + max(x, y, 0.5) - min(x, 2y) + product(x, y, x) + mean(x, 2, y) + sum(x, x, y)",
+		"pow(x, y) + atan2(y, x) + hypot(x, y) + dim(x, y) + mod(y, x) + copysign(x, y) + remainder(y, x)",
+		"piecewise(x < 1, x^2, x < 2, sqrt(x), -x)",
+		"sum(k = 1, 5, sin(k x) / k) + prod(k = 1, 3, x + k y)",
+		"a = x * y; b = a ^ 2; 0 = b + a",
+		"sq(a) = a * a; lin(a, b) = a * x + b; 0 = sq(lin(y, x)) + lin(x, y)",
+		"r = x * 2; 0 = r + theta",
+	}
+	names := []string{}
+	for name := range SingleFunctionDerivatives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		formulas = append(formulas, fmt.Sprintf("%s(x * 0.8 + y * 0.1)", name))
+	}
+	for eachI, each := range formulas {
+		for _, variable := range []string{"x", "y"} {
+			t.Run(fmt.Sprintf("%d: %s by %s", eachI, each, variable), func(t *testing.T) {
+				function, derived := "0 = "+each, "0 = d("+each+", "+variable+")"
+				if i := lastStatement(each); i >= 0 {
+					function, derived = each, each[:i]+"0 = d("+each[i+len("0 = "):]+", "+variable+")"
+				}
+				f, err := ParseFunctionE(function)
+				if err != nil {
+					t.Fatalf("Parse failed: %v", err)
+				}
+				d, err := ParseFunctionE(derived)
+				if err != nil {
+					t.Fatalf("Parse failed: %v", err)
+				}
+				const h = 1e-6
+				for _, p := range [][2]float64{{0.35, 0.45}, {0.6, 1.3}, {1.7, 0.2}, {2.5, -0.9}} {
+					var lo, hi float64
+					if variable == "x" {
+						lo, _, _ = f.Evaluate(p[0]-h, p[1], 0)
+						hi, _, _ = f.Evaluate(p[0]+h, p[1], 0)
+					} else {
+						lo, _, _ = f.Evaluate(p[0], p[1]-h, 0)
+						hi, _, _ = f.Evaluate(p[0], p[1]+h, 0)
+					}
+					expected := (hi - lo) / (2 * h)
+					got, _, _ := d.Evaluate(p[0], p[1], 0)
+					if math.IsNaN(expected) || math.IsInf(expected, 0) || math.Abs(expected) > 1e6 {
+						continue
+					}
+					if math.Abs(got-expected) > 1e-4*math.Max(1, math.Abs(expected)) {
+						t.Errorf("At %v got %v expected %v", p, got, expected)
+					}
+				}
+			})
+		}
+	}
+}
+
+// lastStatement returns where the final "0 = " statement of a formula with several statements starts, or -1.
+func lastStatement(formula string) int {
+	for i := len(formula) - len("; 0 = "); i >= 0; i-- {
+		if formula[i:i+len("; 0 = ")] == "; 0 = " {
+			return i + len("; ")
+		}
+	}
+	return -1
+}
+
+func TestDerivative(t *testing.T) {
+	f, err := ParseFunctionE("a = x^2; y = d(a * t, x) + d(d(x^3, x), x)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if expected := "a = x ^ 2; y = d(a * t, x) + d(d(x ^ 3, x), x)"; f.String() != expected {
+		t.Errorf("Got %#v expected %#v", f.String(), expected)
+	}
+	if v, tUsed, _ := f.Evaluate(3, 5, 2); v != 2*3*2+6*3-5 || !tUsed {
+		t.Errorf("Got %v T used %v", v, tUsed)
+	}
+	if _, err := ParseFunctionE(f.Simplify().String()); err != nil {
+		t.Errorf("Reparse failed: %v", err)
+	}
+}
+
+func TestDerivativeErrors(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula string
+		Column  int
+		Reason  string
+	}{
+		{
+			Formula: "y = d(rand(), x)",
+			Column:  5,
+			Reason:  "rand has no derivative",
+		},
+		{
+			Formula: "y = d(x ^ 2, 2)",
+			Column:  5,
+			Reason:  "d takes an expression and one of x, y, t, r or theta",
+		},
+		{
+			Formula: "a = 1; y = d(x * a, a)",
+			Column:  12,
+			Reason:  "d takes an expression and one of x, y, t, r or theta",
+		},
+		{
+			Formula: "y = d(x)",
+			Column:  5,
+			Reason:  "d takes an expression and one of x, y, t, r or theta",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			_, err := ParseFunctionE(each.Formula)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a *ParseError got %#v", err)
+			}
+			if pe.Column != each.Column || pe.Reason != each.Reason {
+				t.Errorf("Got column %d %#v expected column %d %#v", pe.Column, pe.Reason, each.Column, each.Reason)
+			}
+		})
+	}
+	if _, err := DifferentiateE(&NFunction{Name: "perlin", Args: []Expression{&Var{Var: "x"}, &Var{Var: "y"}}}, "x"); err == nil {
+		t.Errorf("Expected perlin to have no derivative")
+	}
+}
@@ -0,0 +1,162 @@
+package heatPlot
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"log"
+	"math"
+	"math/cmplx"
+	"time"
+)
+
+// ComplexPlot is a Plot of a complex formula, one value per pixel.
+type ComplexPlot struct {
+	Size   image.Rectangle
+	Values []complex128
+	T      float64
+}
+
+func (plot *ComplexPlot) Set(x int, y int, z complex128) {
+	pos := plot.GetPos(x, y)
+	if pos < 0 || pos >= len(plot.Values) {
+		return
+	}
+	plot.Values[pos] = z
+}
+
+func (plot *ComplexPlot) Get(x int, y int) complex128 {
+	pos := plot.GetPos(x, y)
+	if pos < 0 || pos >= len(plot.Values) {
+		return 0
+	}
+	return plot.Values[pos]
+}
+
+func (plot *ComplexPlot) GetPos(x int, y int) int {
+	absX := x - plot.Size.Min.X
+	absY := y - plot.Size.Min.Y
+	return absY*plot.Size.Dx() + absX
+}
+
+func (plot *ComplexPlot) Draw(img *image.Paletted, hues, shades int) (err error) {
+	for x := plot.Size.Min.X; x < plot.Size.Max.X; x++ {
+		for y := plot.Size.Min.Y; y < plot.Size.Max.Y; y++ {
+			c := MakeDomainColour(hues, shades, plot.Get(x, y))
+			if c != nil {
+				img.Set(x, y, c)
+			}
+		}
+	}
+	return
+}
+
+func (function *Function) PlotComplexForT(size image.Rectangle, t float64, pointSize float64) (plot *ComplexPlot, TUsed bool, err error) {
+	plot = &ComplexPlot{
+		Size:   size,
+		Values: make([]complex128, size.Dy()*size.Dx()),
+		T:      t,
+	}
+	for x := size.Min.X; x < size.Max.X; x++ {
+		for y := size.Min.Y; y < size.Max.Y; y++ {
+			z, used, err := function.EvaluateComplex(complex(float64(x)*(pointSize), float64(y)*(pointSize)), t)
+			if err != nil {
+				return nil, false, err
+			}
+			TUsed = TUsed || used
+			plot.Set(x, y, z)
+		}
+	}
+	return
+}
+
+func (function *Function) PlotComplex(timeLowerBound, timeUpperBound, timeStep float64, plotSize image.Rectangle, pointSize float64) (tUsed bool, plots []*ComplexPlot) {
+	for _, t := range FrameTimes(timeLowerBound, timeUpperBound, timeStep) {
+		var err error
+		var plot *ComplexPlot
+		if plot, tUsed, err = function.PlotComplexForT(plotSize, t, pointSize); err != nil {
+			log.Panic(err)
+		}
+		plots = append(plots, plot)
+		if !tUsed {
+			break
+		}
+	}
+	return
+}
+
+// PlotAndDrawComplex is PlotAndDraw for formulas parsed with Parser.ParseComplex, the plots are domain coloured with
+// hues steps of argument and shades steps of modulus, see MakeDomainColour.
+func (function *Function) PlotAndDrawComplex(w io.Writer, size int, timeLowerBound, timeUpperBound, timeStep float64, scale, hues, shades int, pointSize float64, speed time.Duration, footerText string) {
+	plotSize := image.Rect(-size, -size, size, size)
+	tUsed, plots := function.PlotComplex(timeLowerBound, timeUpperBound, timeStep, plotSize, pointSize)
+	RenderComplexPlots(hues, shades, plots, plotSize, scale, function, timeUpperBound, tUsed, footerText, speed, w)
+}
+
+func RenderComplexPlots(hues, shades int, plots []*ComplexPlot, plotSize image.Rectangle, scale int, function *Function, timeUpperBound float64, tUsed bool, footerText string, speed time.Duration, w io.Writer) {
+	renderPlots(DomainColours(hues, shades), len(plots), func(i int, img *image.Paletted) (float64, error) {
+		return plots[i].T, plots[i].Draw(img, hues, shades)
+	}, plotSize, scale, function.Heading(), timeUpperBound, tUsed, footerText, speed, w)
+}
+
+// DomainColours is every colour MakeDomainColour can return, hues * shades of them which with the 3 fixed colours
+// must fit in a GIF's 256.
+func DomainColours(hues, shades int) []color.Color {
+	result := make([]color.Color, 0, hues*shades)
+	for shade := 0; shade < shades; shade++ {
+		for hue := 0; hue < hues; hue++ {
+			result = append(result, domainColour(hues, shades, hue, shade))
+		}
+	}
+	return result
+}
+
+// MakeDomainColour colours z for domain colouring. The hue is its argument, red along the positive real axis turning
+// through yellow, green, cyan, blue and magenta anticlockwise, and the brightness its modulus, black at zero rising
+// to white towards infinity with |z| = 1 half way. NaN has no colour.
+func MakeDomainColour(hues, shades int, z complex128) color.Color {
+	if cmplx.IsNaN(z) {
+		return nil
+	}
+	turn := cmplx.Phase(z) / (2 * math.Pi)
+	if turn < 0 {
+		turn++
+	}
+	hue := int(math.Round(turn*float64(hues))) % hues
+	shade := int(2 / math.Pi * math.Atan(cmplx.Abs(z)) * float64(shades))
+	if shade >= shades {
+		shade = shades - 1
+	}
+	return domainColour(hues, shades, hue, shade)
+}
+
+// domainColour is the fully saturated colour with the hue-th of hues hues at the lightness of the middle of the
+// shade-th of shades bands.
+func domainColour(hues, shades, hue, shade int) color.Color {
+	h := float64(hue) / float64(hues) * 6
+	l := (float64(shade) + 0.5) / float64(shades)
+	chroma := 1 - math.Abs(2*l-1)
+	x := chroma * (1 - math.Abs(math.Mod(h, 2)-1))
+	var r, g, b float64
+	switch int(h) {
+	case 0:
+		r, g = chroma, x
+	case 1:
+		r, g = x, chroma
+	case 2:
+		g, b = chroma, x
+	case 3:
+		g, b = x, chroma
+	case 4:
+		r, b = x, chroma
+	default:
+		r, b = chroma, x
+	}
+	m := l - chroma/2
+	return &color.RGBA{
+		R: uint8(math.Round((r + m) * 255)),
+		G: uint8(math.Round((g + m) * 255)),
+		B: uint8(math.Round((b + m) * 255)),
+		A: 0xFF,
+	}
+}
@@ -0,0 +1,49 @@
+package heatPlot
+
+import (
+	"image/color"
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+func TestMakeDomainColour(t *testing.T) {
+	for _, each := range []struct {
+		Z        complex128
+		Expected color.RGBA
+	}{
+		{Z: 0, Expected: color.RGBA{R: 25, G: 0, B: 0, A: 0xFF}},
+		{Z: 1, Expected: color.RGBA{R: 255, G: 26, B: 26, A: 0xFF}},
+		{Z: 1i, Expected: color.RGBA{R: 140, G: 255, B: 26, A: 0xFF}},
+		{Z: -1, Expected: color.RGBA{R: 26, G: 255, B: 255, A: 0xFF}},
+		{Z: -1i, Expected: color.RGBA{R: 140, G: 26, B: 255, A: 0xFF}},
+		{Z: cmplx.Inf(), Expected: color.RGBA{R: 255, G: 249, B: 229, A: 0xFF}},
+	} {
+		c := MakeDomainColour(24, 10, each.Z)
+		if c == nil {
+			t.Errorf("No colour for %v", each.Z)
+			continue
+		}
+		if got := color.RGBAModel.Convert(c).(color.RGBA); got != each.Expected {
+			t.Errorf("Colour of %v was %v expected %v", each.Z, got, each.Expected)
+		}
+	}
+	if c := MakeDomainColour(24, 10, cmplx.NaN()); c != nil {
+		t.Errorf("Expected no colour for NaN got %v", c)
+	}
+}
+
+func TestDomainColoursCoverMakeDomainColour(t *testing.T) {
+	palette := map[color.RGBA]bool{}
+	for _, c := range DomainColours(24, 10) {
+		palette[color.RGBAModel.Convert(c).(color.RGBA)] = true
+	}
+	for r := 0.0; r < 50; r = r*1.5 + 0.01 {
+		for a := -math.Pi; a < math.Pi; a += 0.1 {
+			c := color.RGBAModel.Convert(MakeDomainColour(24, 10, cmplx.Rect(r, a))).(color.RGBA)
+			if !palette[c] {
+				t.Errorf("Colour %v of %v isn't in the palette", c, cmplx.Rect(r, a))
+			}
+		}
+	}
+}
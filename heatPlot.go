@@ -13,6 +13,8 @@ import (
 	"io"
 	"log"
 	"math"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -24,25 +26,69 @@ var (
 		B: 0x0F,
 		A: 0xFF,
 	}
-	goregularfnt    *truetype.Font
-	SingleFunctions map[string]SingleFunctionDef
-	DoubleFunctions map[string]DoubleFunctionDef
-	FunctionNames   []string
+	goregularfnt *truetype.Font
+	loneZeroRe   = regexp.MustCompile(`(?:^|[^\w.])0$`)
+	// NullaryFunctions take no arguments, as in "nan()".
+	NullaryFunctions map[string]NullaryFunctionDef
+	SingleFunctions  map[string]SingleFunctionDef
+	DoubleFunctions  map[string]DoubleFunctionDef
+	// VariadicFunctions take any number of arguments from 1 up, they are used when neither SingleFunctions nor
+	// DoubleFunctions has a definition for the number given.
+	VariadicFunctions map[string]VariadicFunctionDef
+	FunctionNames     []string
 )
 
+type NullaryFunctionDef func() float64
 type SingleFunctionDef func(float64) float64
 type DoubleFunctionDef func(float64, float64) float64
+type VariadicFunctionDef func(...float64) float64
 
 type State interface {
 	CurX() float64
 	CurY() float64
-	CurT() int
+	CurT() float64
+	// CurR and CurTheta are the polar coordinates of the current X and Y.
+	CurR() float64
+	CurTheta() float64
+	// CurSeed seeds RandomFunctions, the same seed gives the same value at the same point.
+	CurSeed() int64
+	// Prev is the weight of the previous frame dx pixels to the right and dy pixels above the current one, see Prev.
+	Prev(dx, dy int) float64
+	// Frames are the times of the animation's frames, the first at start and each step after the one before, which
+	// accumulate adds up.
+	Frames() (start, step float64)
+	// Total is the running total of the accumulate of e at the current pixel in the frame at t, when that frame kept
+	// it, and KeepTotal keeps the one in the current frame for the next, see Accumulate.
+	Total(e Expression, t float64) (float64, bool)
+	KeepTotal(e Expression, total float64)
+	// Field is the value of e dx pixels to the right and dy pixels above the current one, e having been plotted over
+	// the whole frame beforehand for a laplace, blur or at, see Convolution. It is NaN when e wasn't plotted.
+	Field(e Expression, dx, dy int) float64
+	// Lookup returns the value of a variable bound by the formula, such as r in "r = sqrt(x^2 + y^2); y = r".
+	Lookup(name string) (float64, bool)
+	Bind(name string, value float64)
+	// Scope returns a State whose Binds are only visible through it, for the parameters of a function call.
+	Scope() State
 }
 
 type RealState struct {
-	X, Y                            float64
-	T                               int
+	X, Y, T                         float64
 	AccessedX, AccessedY, AccessedT bool
+	AccessedR, AccessedTheta        bool
+	AccessedPrev                    bool
+	Seed                            int64
+	Vars                            map[string]float64
+	// Previous is the plot of the frame before, Pixel is where X and Y are on it and Boundary says what is read
+	// beyond its edges. prev reads 0 when there is no Previous.
+	Previous *Plot
+	Pixel    image.Point
+	Boundary Boundary
+	// Fields are the expressions of the frame's Convolutions plotted over it, read the same way as Previous.
+	Fields map[Expression]*Plot
+	// frames is the animation T is in, see Frames.
+	frames timeline
+	// carried are the running totals kept in the frame before, totals those kept in this one, see Total.
+	carried, totals *frameTotals
 }
 
 func (rs *RealState) CurX() float64 {
@@ -55,11 +101,70 @@ func (rs *RealState) CurY() float64 {
 	return rs.Y
 }
 
-func (rs *RealState) CurT() int {
+func (rs *RealState) CurT() float64 {
 	rs.AccessedT = true
 	return rs.T
 }
 
+func (rs *RealState) CurR() float64 {
+	rs.AccessedR = true
+	return math.Hypot(rs.X, rs.Y)
+}
+
+func (rs *RealState) CurTheta() float64 {
+	rs.AccessedTheta = true
+	return math.Atan2(rs.Y, rs.X)
+}
+
+func (rs *RealState) CurSeed() int64 {
+	return rs.Seed
+}
+
+func (rs *RealState) Prev(dx, dy int) float64 {
+	rs.AccessedPrev = true
+	if rs.Previous == nil {
+		return 0
+	}
+	return rs.Previous.At(rs.Pixel.X+dx, rs.Pixel.Y+dy, rs.Boundary)
+}
+
+// Frames are those of the animation being plotted, or every 1 from 0 when the point is evaluated on its own.
+func (rs *RealState) Frames() (start, step float64) {
+	return rs.frames.orDefault()
+}
+
+func (rs *RealState) Total(e Expression, t float64) (float64, bool) {
+	return rs.carried.total(e, rs.Pixel, rs.frames, t)
+}
+
+func (rs *RealState) KeepTotal(e Expression, total float64) {
+	rs.totals.keep(e, rs.Pixel, total)
+}
+
+func (rs *RealState) Field(e Expression, dx, dy int) float64 {
+	field, ok := rs.Fields[e]
+	if !ok {
+		return math.NaN()
+	}
+	return field.At(rs.Pixel.X+dx, rs.Pixel.Y+dy, rs.Boundary)
+}
+
+func (rs *RealState) Lookup(name string) (float64, bool) {
+	v, ok := rs.Vars[strings.ToUpper(name)]
+	return v, ok
+}
+
+func (rs *RealState) Bind(name string, value float64) {
+	if rs.Vars == nil {
+		rs.Vars = map[string]float64{}
+	}
+	rs.Vars[strings.ToUpper(name)] = value
+}
+
+func (rs *RealState) Scope() State {
+	return newScopedState(rs)
+}
+
 type Expression interface {
 	Evaluate(state State) float64
 	String() string
@@ -67,11 +172,45 @@ type Expression interface {
 	Simplify() Expression
 }
 
+// Function is a whole formula. Definitions are the functions declared in it, the Bindings are evaluated in order and
+// can be used by any statement after them, then the Equals gives the weight.
 type Function struct {
-	Equals *Equals
+	Definitions []*UserFunction
+	Bindings    []*Binding
+	Equals      *Equals
+	// Plotted is set when a complex formula ends by declaring the function to plot, Equals then calls it with z.
+	Plotted *UserFunction
+	// Colour replaces Equals when the formula ends with rgb or rgba, see EvaluateColour.
+	Colour *Colour
+	// Seed is given to RandomFunctions such as rand() through State.CurSeed, so a plot can be reproduced exactly.
+	Seed int64
+	// Initial is the initial condition "prev = ...", what prev reads in the first frame. It can use the first
+	// initialAfter Bindings.
+	Initial      *Binding
+	initialAfter int
+	// definitionsAfter is how many of the Bindings and Initial were written before each of the Definitions, so String
+	// keeps the statements in order.
+	definitionsAfter []int
+	// Boundary is what prev reads beyond the edges of the previous frame.
+	Boundary Boundary
+	// PrettyHeading draws the formula above each frame with mathematical notation, see Heading.
+	PrettyHeading bool
+}
+
+// plot makes uf the function the formula plots.
+func (v *Function) plot(uf *UserFunction) {
+	v.Plotted = uf
+	v.Equals = &Equals{
+		LHS: &Const{Value: 0},
+		RHS: &UserFunctionCall{
+			Name:     uf.Name,
+			Function: uf,
+			Args:     []Expression{&Var{Var: "z"}},
+		},
+	}
 }
 
-func (v Function) Evaluate(X, Y float64, T int) (weight float64, TUsed bool, err error) {
+func (v Function) Evaluate(X, Y, T float64) (weight float64, TUsed bool, err error) {
 	state := &RealState{
 		X:         X,
 		Y:         Y,
@@ -79,25 +218,89 @@ func (v Function) Evaluate(X, Y float64, T int) (weight float64, TUsed bool, err
 		AccessedX: false,
 		AccessedY: false,
 		AccessedT: false,
+		Seed:      v.Seed,
+	}
+	weight, err = v.evaluate(state)
+	return weight, state.AccessedT, err
+}
+
+// evaluate works out the weight at the point state is for.
+func (v Function) evaluate(state *RealState) (weight float64, err error) {
+	if v.Colour != nil {
+		return 0, errors.New("a colour formula has no weight, use EvaluateColour")
 	}
 	if v.Equals == nil {
-		return 0, false, errors.New("no such formula")
+		return 0, errors.New("no such formula")
 	}
 	defer func() {
 		if r := recover(); r != nil {
 			log.Println("Recovered in f", r)
 		}
 	}()
+	for _, b := range v.Bindings {
+		b.Evaluate(state)
+	}
 	weight = v.Equals.Evaluate(state)
-	TUsed = state.AccessedT
 	return
 }
 
 func (v Function) String() string {
-	return v.Equals.String()
+	assignments := make([]string, 0, len(v.Bindings)+1)
+	for i, b := range v.Bindings {
+		if v.Initial != nil && i == v.initialAfter {
+			assignments = append(assignments, v.Initial.String())
+		}
+		assignments = append(assignments, b.String())
+	}
+	if v.Initial != nil && v.initialAfter == len(v.Bindings) {
+		assignments = append(assignments, v.Initial.String())
+	}
+	statements := make([]string, 0, len(v.Definitions)+len(assignments)+1)
+	d := 0
+	for i := 0; i <= len(assignments); i++ {
+		for ; d < len(v.Definitions) && (d >= len(v.definitionsAfter) || v.definitionsAfter[d] <= i); d++ {
+			statements = append(statements, v.Definitions[d].String())
+		}
+		if i < len(assignments) {
+			statements = append(statements, assignments[i])
+		}
+	}
+	if v.Plotted != nil {
+		statements = append(statements, v.Plotted.String())
+	} else if v.Colour != nil {
+		statements = append(statements, v.Colour.String())
+	} else {
+		statements = append(statements, v.Equals.String())
+	}
+	return strings.Join(statements, "; ")
 }
 
 func (v Function) Simplify() *Function {
+	bindings := make([]*Binding, len(v.Bindings))
+	for i, b := range v.Bindings {
+		bindings[i] = b.Simplify().(*Binding)
+	}
+	v.Bindings = bindings
+	if v.Initial != nil {
+		v.Initial = v.Initial.Simplify().(*Binding)
+	}
+	definitions := make([]*UserFunction, len(v.Definitions))
+	for i, d := range v.Definitions {
+		simplified := *d
+		simplified.Body = removeBrackets(d.Body.Simplify())
+		definitions[i] = &simplified
+	}
+	v.Definitions = definitions
+	if v.Plotted != nil {
+		plotted := *v.Plotted
+		plotted.Body = removeBrackets(plotted.Body.Simplify())
+		v.plot(&plotted)
+		return &v
+	}
+	if v.Colour != nil {
+		v.Colour = v.Colour.Simplify().(*Colour)
+		return &v
+	}
 	e := v.Equals.Simplify().(*Equals)
 	v.Equals = e
 	return &v
@@ -143,13 +346,23 @@ type Var struct {
 }
 
 func (v Var) Evaluate(state State) float64 {
+	// Function parameters can shadow the built in variables so they are looked up first.
+	if value, ok := state.Lookup(v.Var); ok {
+		return value
+	}
 	switch strings.ToUpper(v.Var) {
 	case "X":
 		return float64(state.CurX())
 	case "Y":
 		return float64(state.CurY())
 	case "T":
-		return float64(state.CurT())
+		return state.CurT()
+	case "R":
+		return state.CurR()
+	case "THETA", "Θ":
+		return state.CurTheta()
+	case "PREV":
+		return state.Prev(0, 0)
 	default:
 		return 0
 	}
@@ -175,8 +388,16 @@ func (c Const) Evaluate(state State) float64 {
 	return c.Value
 }
 
+// String prints the shortest form which parses back to the same float64. Infinity is written with Inf, which the
+// parser has as a function.
 func (v Const) String() string {
-	return fmt.Sprintf("%g", v.Value)
+	switch {
+	case math.IsInf(v.Value, 1):
+		return "Inf(1)"
+	case math.IsInf(v.Value, -1):
+		return "Inf(-1)"
+	}
+	return strconv.FormatFloat(v.Value, 'g', -1, 64)
 }
 
 func (v Const) Simplify() Expression {
@@ -193,7 +414,7 @@ type Plus struct {
 }
 
 func (v Plus) Evaluate(state State) float64 {
-	return v.RHS.Evaluate(state) + v.LHS.Evaluate(state)
+	return v.LHS.Evaluate(state) + v.RHS.Evaluate(state)
 }
 
 func (v Plus) String() string {
@@ -220,7 +441,7 @@ type Subtract struct {
 }
 
 func (v Subtract) Evaluate(state State) float64 {
-	return v.RHS.Evaluate(state) - v.LHS.Evaluate(state)
+	return v.LHS.Evaluate(state) - v.RHS.Evaluate(state)
 }
 
 func (v Subtract) String() string {
@@ -241,16 +462,31 @@ func (v Subtract) Depth() int {
 	return r + 1
 }
 
+// Multiply is LHS * RHS, when Implicit is set it was written as a juxtaposition such as "2x" or "(x+1)(y-1)" and
+// prints back the same way.
 type Multiply struct {
-	LHS Expression
-	RHS Expression
+	LHS      Expression
+	RHS      Expression
+	Implicit bool
 }
 
 func (v Multiply) Evaluate(state State) float64 {
-	return v.RHS.Evaluate(state) * v.LHS.Evaluate(state)
+	return v.LHS.Evaluate(state) * v.RHS.Evaluate(state)
 }
 
 func (v Multiply) String() string {
+	if v.Implicit {
+		lhs, rhs := v.LHS.String(), v.RHS.String()
+		switch v.RHS.(type) {
+		case *Brackets:
+			return lhs + rhs
+		case *Var, *NamedConstant:
+			if joinsAsImplicit(lhs, rhs) {
+				return lhs + rhs
+			}
+		}
+		return fmt.Sprintf("%s %s", lhs, rhs)
+	}
 	return fmt.Sprintf("%s * %s", v.LHS.String(), v.RHS.String())
 }
 
@@ -268,13 +504,28 @@ func (v Multiply) Depth() int {
 	return r + 1
 }
 
+// joinsAsImplicit reports whether a number and a name can be written together, as in "2x", without the lexer reading
+// them as a single number like "2e5" or "0x1F".
+func joinsAsImplicit(lhs, rhs string) bool {
+	if lhs == "" || rhs == "" || !strings.ContainsRune("0123456789", rune(lhs[len(lhs)-1])) {
+		return false
+	}
+	switch rhs[0] {
+	case 'e', 'E', '_':
+		return false
+	case 'x', 'X', 'b', 'B':
+		return !loneZeroRe.MatchString(lhs)
+	}
+	return true
+}
+
 type Divide struct {
 	LHS Expression
 	RHS Expression
 }
 
 func (v Divide) Evaluate(state State) float64 {
-	return v.RHS.Evaluate(state) / v.LHS.Evaluate(state)
+	return v.LHS.Evaluate(state) / v.RHS.Evaluate(state)
 }
 
 func (v Divide) String() string {
@@ -410,68 +661,142 @@ func (v Brackets) Depth() int {
 	return v.Expr.Depth() + 1
 }
 
-type SingleFunction struct {
-	Name string
-	Expr Expression
+// NFunction calls the built in function Name with Args. RandomFunctions and NoiseFunctions are given every argument
+// along with the State's seed. Otherwise the number of arguments picks the definition, NullaryFunctions for none, SingleFunctions for
+// one and DoubleFunctions for two when they have the name, otherwise VariadicFunctions. Infix is set when it was
+// written between its two arguments as in "x max y".
+type NFunction struct {
+	Name  string
+	Args  []Expression
+	Infix bool
 }
 
-func (v SingleFunction) Evaluate(state State) float64 {
-	var r = v.Expr.Evaluate(state)
-	if f, ok := SingleFunctions[strings.ToUpper(v.Name)]; ok {
-		r = f(r)
+func (v NFunction) Evaluate(state State) float64 {
+	args := make([]float64, len(v.Args))
+	for i, arg := range v.Args {
+		args[i] = arg.Evaluate(state)
 	}
-	return r
+	name := strings.ToUpper(v.Name)
+	if f, ok := RandomFunctions[name]; ok {
+		if len(args) == 0 {
+			args = []float64{state.CurX(), state.CurY()}
+		}
+		return f(state.CurSeed(), args...)
+	}
+	if f, ok := NoiseFunctions[name]; ok && len(args) == f.Args {
+		return f.Noise(state.CurSeed(), args...)
+	}
+	switch len(args) {
+	case 0:
+		if f, ok := NullaryFunctions[name]; ok {
+			return f()
+		}
+	case 1:
+		if f, ok := SingleFunctions[name]; ok {
+			return f(args[0])
+		}
+	case 2:
+		if f, ok := DoubleFunctions[name]; ok {
+			return f(args[0], args[1])
+		}
+	}
+	if f, ok := VariadicFunctions[name]; ok && len(args) > 0 {
+		return f(args...)
+	}
+	if len(args) > 0 {
+		return args[0]
+	}
+	return 0
 }
 
-func (v SingleFunction) String() string {
-	return fmt.Sprintf("%s(%s)", v.Name, v.Expr.String())
+func (v NFunction) String() string {
+	if v.Infix && len(v.Args) == 2 {
+		return fmt.Sprintf("%s %s %s", v.Args[0].String(), v.Name, v.Args[1].String())
+	}
+	args := make([]string, len(v.Args))
+	for i, arg := range v.Args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s(%s)", v.Name, strings.Join(args, ", "))
 }
 
-func (v SingleFunction) Simplify() Expression {
-	v.Expr = v.Expr.Simplify()
+func (v NFunction) Simplify() Expression {
+	args := make([]Expression, len(v.Args))
+	for i, arg := range v.Args {
+		args[i] = arg.Simplify()
+	}
+	v.Args = args
 	return &v
 }
 
-func (v SingleFunction) Depth() int {
-	return v.Expr.Depth() + 1
-}
-
-type DoubleFunction struct {
-	Name  string
-	Expr1 Expression
-	Expr2 Expression
-	Infix bool
+func (v NFunction) Depth() int {
+	return maxDepth(v.Args...)
 }
 
-func (v DoubleFunction) Evaluate(state State) float64 {
-	var r1 = v.Expr1.Evaluate(state)
-	var r2 = v.Expr2.Evaluate(state)
-	if f, ok := DoubleFunctions[strings.ToUpper(v.Name)]; ok {
-		r1 = f(r1, r2)
+// functionArity returns how many arguments the built in function name takes.
+func functionArity(name string) arity {
+	name = strings.ToUpper(name)
+	a := arity{}
+	if _, ok := NullaryFunctions[name]; ok {
+		a.counts = append(a.counts, 0)
 	}
-	return r1
-}
-
-func (v DoubleFunction) String() string {
-	if v.Infix {
-		return fmt.Sprintf("%s %s %s", v.Expr1.String(), v.Name, v.Expr2.String())
-	} else {
-		return fmt.Sprintf("%s(%s, %s)", v.Name, v.Expr1.String(), v.Expr2.String())
+	if _, ok := SingleFunctions[name]; ok {
+		a.counts = append(a.counts, 1)
+	}
+	if _, ok := DoubleFunctions[name]; ok {
+		a.counts = append(a.counts, 2)
+	}
+	if f, ok := NoiseFunctions[name]; ok {
+		a.counts = append(a.counts, f.Args)
+	}
+	if _, ok := VariadicFunctions[name]; ok {
+		a.variadic, a.minimum = true, 1
 	}
+	if _, ok := RandomFunctions[name]; ok {
+		a.variadic, a.minimum = true, 0
+	}
+	return a
 }
 
-func (v DoubleFunction) Simplify() Expression {
-	v.Expr1 = v.Expr1.Simplify()
-	v.Expr2 = v.Expr2.Simplify()
-	return &v
+// arity records the numbers of arguments a function has a definition for.
+type arity struct {
+	// counts are the exact numbers of arguments with a definition, smallest first.
+	counts []int
+	// variadic is set when every number of arguments from minimum up has one too.
+	variadic bool
+	minimum  int
 }
 
-func (v DoubleFunction) Depth() int {
-	l, r := v.Expr1.Depth(), v.Expr2.Depth()
-	if l > r {
-		return l + 1
+// accepts reports whether the function can be called with n arguments.
+func (a arity) accepts(n int) bool {
+	if a.variadic && n >= a.minimum {
+		return true
 	}
-	return r + 1
+	for _, c := range a.counts {
+		if c == n {
+			return true
+		}
+	}
+	return false
+}
+
+// String describes the arguments the function takes for errors, such as "1 or 2 arguments".
+func (a arity) String() string {
+	switch {
+	case a.variadic && a.minimum == 0:
+		return "any number of arguments"
+	case a.variadic:
+		return fmt.Sprintf("%d or more arguments", a.minimum)
+	case len(a.counts) == 1 && a.counts[0] == 0:
+		return "no arguments"
+	case len(a.counts) == 1 && a.counts[0] == 1:
+		return "1 argument"
+	}
+	counts := make([]string, len(a.counts))
+	for i, c := range a.counts {
+		counts[i] = fmt.Sprint(c)
+	}
+	return strings.Join(counts, " or ") + " arguments"
 }
 
 func init() {
@@ -480,8 +805,10 @@ func init() {
 	} else {
 		goregularfnt = fnt
 	}
+	NullaryFunctions = map[string]NullaryFunctionDef{}
 	SingleFunctions = map[string]SingleFunctionDef{}
 	DoubleFunctions = map[string]DoubleFunctionDef{}
+	VariadicFunctions = map[string]VariadicFunctionDef{}
 	FunctionNames = []string{}
 	for name, f := range map[string]interface{}{
 		"Abs":             math.Abs,
@@ -552,6 +879,8 @@ func init() {
 		"Yn":              math.Yn,
 	} {
 		switch f := f.(type) {
+		case func() float64:
+			NullaryFunctions[strings.ToUpper(name)] = f
 		case func(float64) float64:
 			SingleFunctions[strings.ToUpper(name)] = f
 		case func(float64, float64) float64:
@@ -577,34 +906,130 @@ func init() {
 		}
 		FunctionNames = append(FunctionNames, name)
 	}
+	for name, f := range map[string]VariadicFunctionDef{
+		"Min":     variadicMin,
+		"Max":     variadicMax,
+		"Sum":     variadicSum,
+		"Mean":    variadicMean,
+		"Hypot":   variadicHypot,
+		"Product": variadicProduct,
+	} {
+		if !isFunctionName(name) {
+			FunctionNames = append(FunctionNames, name)
+		}
+		VariadicFunctions[strings.ToUpper(name)] = f
+	}
+	// inf() is positive infinity, inf(sign) is still math.Inf.
+	NullaryFunctions["INF"] = func() float64 {
+		return math.Inf(1)
+	}
+	RandomFunctions = map[string]RandomFunctionDef{}
+	for name, f := range map[string]RandomFunctionDef{
+		"Rand":  hashRand,
+		"Gauss": hashGauss,
+	} {
+		RandomFunctions[strings.ToUpper(name)] = f
+		FunctionNames = append(FunctionNames, name)
+	}
+	NoiseFunctions = map[string]NoiseFunction{}
+	for name, f := range map[string]NoiseFunction{
+		"Perlin":     {Args: 2, Noise: perlin},
+		"Perlin3":    {Args: 3, Noise: perlin3},
+		"Simplex":    {Args: 2, Noise: simplex},
+		"ValueNoise": {Args: 2, Noise: valueNoise},
+		"Worley":     {Args: 2, Noise: worley},
+		"Fbm":        {Args: 3, Noise: fbm},
+	} {
+		NoiseFunctions[strings.ToUpper(name)] = f
+		FunctionNames = append(FunctionNames, name)
+	}
+}
+
+func variadicMin(args ...float64) float64 {
+	r := args[0]
+	for _, a := range args[1:] {
+		r = math.Min(r, a)
+	}
+	return r
+}
+
+func variadicMax(args ...float64) float64 {
+	r := args[0]
+	for _, a := range args[1:] {
+		r = math.Max(r, a)
+	}
+	return r
+}
+
+func variadicSum(args ...float64) float64 {
+	r := 0.0
+	for _, a := range args {
+		r += a
+	}
+	return r
+}
+
+func variadicMean(args ...float64) float64 {
+	return variadicSum(args...) / float64(len(args))
 }
 
-func ParseRunAndDrawFunction(functionString string, w io.Writer, size, timeLowerBound, timeUpperBound, scale, heatColourCount int, pointSize float64, speed time.Duration, footerText string) {
+func variadicHypot(args ...float64) float64 {
+	r := 0.0
+	for _, a := range args {
+		r = math.Hypot(r, a)
+	}
+	return r
+}
+
+func variadicProduct(args ...float64) float64 {
+	r := 1.0
+	for _, a := range args {
+		r *= a
+	}
+	return r
+}
+
+func ParseRunAndDrawFunction(functionString string, w io.Writer, size int, timeLowerBound, timeUpperBound, timeStep float64, scale, heatColourCount int, pointSize float64, speed time.Duration, footerText string) {
 	function := ParseFunction(functionString)
-	function.PlotAndDraw(w, size, timeLowerBound, timeUpperBound, scale, heatColourCount, pointSize, speed, footerText)
+	function.PlotAndDraw(w, size, timeLowerBound, timeUpperBound, timeStep, scale, heatColourCount, pointSize, speed, footerText)
 }
 
-func (function *Function) PlotAndDraw(w io.Writer, size, timeLowerBound, timeUpperBound, scale, heatColourCount int, pointSize float64, speed time.Duration, footerText string) {
+func (function *Function) PlotAndDraw(w io.Writer, size int, timeLowerBound, timeUpperBound, timeStep float64, scale, heatColourCount int, pointSize float64, speed time.Duration, footerText string) {
 	plotSize := image.Rect(-size, -size, size, size)
-	tUsed, plots := function.Plot(timeLowerBound, timeUpperBound, plotSize, pointSize)
+	tUsed, plots := function.Plot(timeLowerBound, timeUpperBound, timeStep, plotSize, pointSize)
 	RenderPlots(heatColourCount, plots, plotSize, scale, function, timeUpperBound, tUsed, footerText, speed, w)
 }
 
-func RenderPlots(heatColourCount int, plots []*Plot, plotSize image.Rectangle, scale int, function *Function, timeUpperBound int, tUsed bool, footerText string, speed time.Duration, w io.Writer) {
+func RenderPlots(heatColourCount int, plots []*Plot, plotSize image.Rectangle, scale int, function *Function, timeUpperBound float64, tUsed bool, footerText string, speed time.Duration, w io.Writer) {
+	renderHeatPlots(heatColourCount, plots, plotSize, scale, function.Heading(), timeUpperBound, tUsed, footerText, speed, w)
+}
+
+// renderHeatPlots is RenderPlots with heading drawn above each frame in place of the formula.
+func renderHeatPlots(heatColourCount int, plots []*Plot, plotSize image.Rectangle, scale int, heading string, timeUpperBound float64, tUsed bool, footerText string, speed time.Duration, w io.Writer) {
+	renderPlots(HeatColours(heatColourCount), len(plots), func(i int, img *image.Paletted) (float64, error) {
+		return plots[i].T, plots[i].Draw(img, heatColourCount)
+	}, plotSize, scale, heading, timeUpperBound, tUsed, footerText, speed, w)
+}
+
+// renderPlots writes a GIF of count frames to w. Each is drawn by drawFrame, which is given the frame's index and an
+// image of plotSize whose palette is colours after the white background, black and the axes' colour, and returns
+// the frame's t. The axes are then drawn over it and it is scaled and headed with heading.
+func renderPlots(colours []color.Color, count int, drawFrame func(i int, img *image.Paletted) (t float64, err error), plotSize image.Rectangle, scale int, heading string, timeUpperBound float64, tUsed bool, footerText string, speed time.Duration, w io.Writer) {
 	delays := []int{}
-	colours := []color.Color{
+	palette := []color.Color{
 		lineColor,
 		color.White,
 		color.Black,
 	}
-	colours = append(colours, HeatColours(heatColourCount)...)
+	palette = append(palette, colours...)
 	imgs := []*image.Paletted{}
-	for _, plot := range plots {
-		img := image.NewPaletted(plotSize, colours)
+	for i := 0; i < count; i++ {
+		img := image.NewPaletted(plotSize, palette)
 		if err := paintWhite(img, plotSize); err != nil {
 			log.Panic(err)
 		}
-		if err := plot.Draw(img, heatColourCount); err != nil {
+		t, err := drawFrame(i, img)
+		if err != nil {
 			log.Panic(err)
 		}
 		if err := drawPlane(img, plotSize); err != nil {
@@ -612,11 +1037,11 @@ func RenderPlots(heatColourCount int, plots []*Plot, plotSize image.Rectangle, s
 		}
 		img = FlipAndMoveImage(img)
 		img = ScaleImage(img, scale)
-		var err error
-		if img, err = AddHeaderAndFooter(img, function, plot.T, timeUpperBound, scale, tUsed, footerText); err != nil {
+		result := image.NewPaletted(headerAndFooterBounds(img.Rect, scale), img.Palette)
+		if err := drawHeaderAndFooter(result, img, heading, t, timeUpperBound, scale, tUsed, footerText); err != nil {
 			log.Panic(err)
 		}
-		imgs = append(imgs, img)
+		imgs = append(imgs, result)
 		delays = append(delays, int((speed)/(time.Millisecond*10)))
 	}
 	if err := gif.EncodeAll(w, &gif.GIF{
@@ -627,54 +1052,102 @@ func RenderPlots(heatColourCount int, plots []*Plot, plotSize image.Rectangle, s
 	}
 }
 
-func (function *Function) Plot(timeLowerBound int, timeUpperBound int, plotSize image.Rectangle, pointSize float64) (tUsed bool, plots []*Plot) {
-	for t := (timeLowerBound); t < (timeUpperBound) && tUsed || t == (timeLowerBound); t++ {
+// Plot plots each frame from timeLowerBound up to timeUpperBound, see FrameTimes. Only the first is plotted when the
+// formula doesn't use t or prev, prev reading each frame in the next.
+func (function *Function) Plot(timeLowerBound, timeUpperBound, timeStep float64, plotSize image.Rectangle, pointSize float64) (tUsed bool, plots []*Plot) {
+	previous := function.initialPlot(plotSize, timeLowerBound, pointSize)
+	frames := newTimeline(timeLowerBound, timeStep)
+	for _, t := range FrameTimes(timeLowerBound, timeUpperBound, timeStep) {
 		var err error
 		var plot *Plot
-		if plot, tUsed, err = function.PlotForT(plotSize, t, pointSize); err != nil {
+		if plot, tUsed, err = function.plotForT(plotSize, previous, t, pointSize, frames); err != nil {
 			log.Panic(err)
 		}
 		plots = append(plots, plot)
+		previous = plot
+		if !tUsed {
+			break
+		}
 	}
 	return
 }
 
+// maxFrames stops an enormous range of t or a tiny step from plotting forever.
+const maxFrames = 10000
+
+// FrameTimes returns t for each frame of an animation, timeLowerBound and then every timeStep after it which is
+// before timeUpperBound, at most maxFrames of them. A timeStep which isn't positive is taken as 1. The times are
+// rounded to 9 decimal places, so steps such as 0.1 don't gather rounding errors.
+func FrameTimes(timeLowerBound, timeUpperBound, timeStep float64) []float64 {
+	if !(timeStep > 0) {
+		timeStep = 1
+	}
+	times := []float64{timeLowerBound}
+	for i := 1; i < maxFrames; i++ {
+		t := roundTime(timeLowerBound + float64(i)*timeStep)
+		if !(t < timeUpperBound) {
+			break
+		}
+		times = append(times, t)
+	}
+	return times
+}
+
+// roundTime rounds t to 9 decimal places, as FrameTimes does.
+func roundTime(t float64) float64 {
+	return math.Round(t*1e9) / 1e9
+}
+
 func ParseFunction(arg string) *Function {
-	yyResult = nil
-	if r := yyParse(NewCalcLexer(arg)); r != 0 {
-		log.Panic("Invalid formula: ", arg, " Left with ", yyResult)
+	f, err := ParseFunctionE(arg)
+	if err != nil {
+		log.Panic("Invalid formula: ", arg, " ", err)
 	}
-	return yyResult
+	return f
 }
 
-func AddHeaderAndFooter(img *image.Paletted, function *Function, t, timeUpperBound, scale int, tUsed bool, footerText string) (*image.Paletted, error) {
+func AddHeaderAndFooter(img *image.Paletted, function *Function, t, timeUpperBound float64, scale int, tUsed bool, footerText string) (*image.Paletted, error) {
+	result := image.NewPaletted(headerAndFooterBounds(img.Rect, scale), img.Palette)
+	if err := drawHeaderAndFooter(result, img, function.Heading(), t, timeUpperBound, scale, tUsed, footerText); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// headerAndFooterBounds is the size of an image of size bounds once the header and footer are added.
+func headerAndFooterBounds(bounds image.Rectangle, scale int) image.Rectangle {
+	return image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Max.X+20*scale*2, bounds.Max.Y+20*scale*2)
+}
+
+// drawHeaderAndFooter draws img into result, which is headerAndFooterBounds in size, surrounded by heading, usually
+// the formula, and the footer text.
+func drawHeaderAndFooter(result Image, img image.Image, heading string, t, timeUpperBound float64, scale int, tUsed bool, footerText string) error {
 	borderSizes := image.Pt(20*scale, 20*scale)
-	newRect := image.Rect(img.Rect.Min.X, img.Rect.Min.Y, img.Rect.Max.X+borderSizes.X*2, img.Rect.Max.Y+borderSizes.Y*2)
-	result := image.NewPaletted(newRect, img.Palette)
+	newRect := result.Bounds()
 	if err := paintWhite(result, newRect); err != nil {
-		return nil, err
+		return err
 	}
-	for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
-		for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+	for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+		for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
 			result.Set(x+borderSizes.X, y+borderSizes.Y, img.At(x, y))
 		}
 	}
-	if err := AddText(function.String(), result, newRect.Min.X+10, newRect.Min.Y+borderSizes.Y, scale); err != nil {
-		return nil, err
+	if err := AddText(heading, result, newRect.Min.X+10, newRect.Min.Y+borderSizes.Y, scale); err != nil {
+		return err
 	}
 	if tUsed {
-		if err := AddText(fmt.Sprintf("T: %d/%d - %s", t, (timeUpperBound), footerText), result, newRect.Min.X+10, newRect.Max.Y-10, scale); err != nil {
-			return nil, err
+		if err := AddText(fmt.Sprintf("T: %g/%g - %s", t, timeUpperBound, footerText), result, newRect.Min.X+10, newRect.Max.Y-10, scale); err != nil {
+			return err
 		}
 	} else {
 		if err := AddText(footerText, result, newRect.Min.X+10, newRect.Max.Y-10, scale); err != nil {
-			return nil, err
+			return err
 		}
 	}
-	return result, nil
+	return nil
 }
 
-func AddText(s string, img *image.Paletted, x, y, scale int) error {
+func AddText(s string, img Image, x, y, scale int) error {
 	face := truetype.NewFace(goregularfnt, &truetype.Options{
 		Size:       12 * float64(scale),
 		DPI:        96,
@@ -720,7 +1193,9 @@ type Plot struct {
 	Size   image.Rectangle
 	Values []float64
 	Sets   int
-	T      int
+	T      float64
+	// totals are the running totals of its accumulates, which the next frame carries on from.
+	totals *frameTotals
 }
 
 func (plot *Plot) Draw(img *image.Paletted, heatColourCount int) (err error) {
@@ -775,19 +1250,33 @@ func (plot *Plot) Equals(plot2 *Plot) bool {
 	return true
 }
 
-func (function *Function) PlotForT(size image.Rectangle, t int, pointSize float64) (plot *Plot, TUsed bool, err error) {
+// PlotForT plots a first frame at t, prev reading the initial condition.
+func (function *Function) PlotForT(size image.Rectangle, t float64, pointSize float64) (plot *Plot, TUsed bool, err error) {
+	return function.plotForT(size, function.initialPlot(size, t, pointSize), t, pointSize, timeline{})
+}
+
+// plotForT plots the frame at t of frames which follows previous, prev reading it. TUsed is also set when prev is
+// used, as the frame then changes from one to the next.
+func (function *Function) plotForT(size image.Rectangle, previous *Plot, t float64, pointSize float64, frames timeline) (plot *Plot, TUsed bool, err error) {
 	plot = &Plot{
 		Size:   size,
 		Values: make([]float64, size.Dy()*size.Dx()),
 		T:      t,
 	}
+	fields := newFieldPlotter(function, size, previous, t, pointSize, frames)
+	if previous != nil {
+		fields.carried = previous.totals
+	}
+	plot.totals = fields.totals
+	fields.plotStatements()
 	for x := size.Min.X; x < size.Max.X; x++ {
 		for y := size.Min.Y; y < size.Max.Y; y++ {
+			state := fields.state(x, y)
 			var w float64
-			w, TUsed, err = function.Evaluate(float64(x)*(pointSize), float64(y)*(pointSize), t)
-			if err != nil {
+			if w, err = function.evaluate(state); err != nil {
 				return nil, false, err
 			}
+			TUsed = TUsed || state.AccessedT || state.AccessedPrev || fields.tUsed
 			plot.Set(x, y, w)
 		}
 	}
@@ -795,7 +1284,18 @@ func (function *Function) PlotForT(size image.Rectangle, t int, pointSize float6
 }
 
 func (v Function) Depth() int {
-	return v.Equals.Depth()
+	var d int
+	if v.Colour != nil {
+		d = v.Colour.Depth()
+	} else {
+		d = v.Equals.Depth()
+	}
+	for _, b := range v.Bindings {
+		if bd := b.Depth(); bd > d {
+			d = bd
+		}
+	}
+	return d
 }
 
 func HeatColours(heatColourCount int) []color.Color {
@@ -1,6 +1,12 @@
 package heatPlot
 
-import "testing"
+import (
+	"fmt"
+	"image"
+	"math"
+	"reflect"
+	"testing"
+)
 
 func TestSimplify(t *testing.T) {
 	for _, eachTest := range []struct {
@@ -20,12 +26,12 @@ func TestSimplify(t *testing.T) {
 			ExpectedFormula: "1 - (42 + 55.75) = X",
 		},
 		{
-			InputFormula:    "42 Expm1 55.75 = X",
-			ExpectedFormula: "42 Expm1 55.75 = X",
+			InputFormula:    "42 Atan2 55.75 = X",
+			ExpectedFormula: "42 Atan2 55.75 = X",
 		},
 		{
-			InputFormula:    "42 Expm1 T = X",
-			ExpectedFormula: "42 Expm1 T = X",
+			InputFormula:    "42 Atan2 T = X",
+			ExpectedFormula: "42 Atan2 T = X",
 		},
 		{
 			InputFormula:    "42 % T = X",
@@ -53,3 +59,119 @@ func TestSimplify(t *testing.T) {
 		}
 	}
 }
+
+func TestVariadicFunctions(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula  string
+		Expected float64
+		String   string
+	}{
+		{Formula: "0 = max(1, 7, 3, 5)", Expected: 7, String: "0 = max(1, 7, 3, 5)"},
+		{Formula: "0 = min(4, 2, 8)", Expected: 2, String: "0 = min(4, 2, 8)"},
+		{Formula: "0 = min(x, y)", Expected: 2, String: "0 = min(x, y)"},
+		{Formula: "0 = max(x)", Expected: 3, String: "0 = max(x)"},
+		{Formula: "0 = sum(x, y, 1, 4)", Expected: 10, String: "0 = sum(x, y, 1, 4)"},
+		{Formula: "0 = mean(x, y, 1)", Expected: 2, String: "0 = mean(x, y, 1)"},
+		{Formula: "0 = product(x, y, 0.5)", Expected: 3, String: "0 = product(x, y, 0.5)"},
+		{Formula: "0 = hypot(2, 3, 6)", Expected: 7, String: "0 = hypot(2, 3, 6)"},
+		{Formula: "0 = hypot(x, 4)", Expected: 5, String: "0 = hypot(x, 4)"},
+		{Formula: "0 = x sum y", Expected: 5, String: "0 = x sum y"},
+		{Formula: "0 = max(x, y, sum(x, y) / 2) * 2", Expected: 6, String: "0 = max(x, y, sum(x, y) / 2) * 2"},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.String() != each.String {
+				t.Errorf("Got %#v expected %#v", f.String(), each.String)
+			}
+			v, _, err := f.Evaluate(3, 2, 0)
+			if err != nil {
+				t.Fatalf("Evaluate failed: %v", err)
+			}
+			if math.Abs(v-each.Expected) > 1e-9 {
+				t.Errorf("Got %v expected %v", v, each.Expected)
+			}
+		})
+	}
+}
+
+func TestPolarVars(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula  string
+		X, Y     float64
+		Expected float64
+	}{
+		{Formula: "0 = r", X: 3, Y: 4, Expected: 5},
+		{Formula: "0 = R", X: -3, Y: -4, Expected: 5},
+		{Formula: "0 = theta", X: 0, Y: 2, Expected: math.Pi / 2},
+		{Formula: "0 = θ", X: -1, Y: 0, Expected: math.Pi},
+		{Formula: "0 = 2θ", X: 1, Y: 1, Expected: math.Pi / 2},
+		{Formula: "0 = Theta * r", X: 0, Y: -2, Expected: -math.Pi},
+		{Formula: "r = 7; 0 = r", X: 3, Y: 4, Expected: 7},
+		{Formula: "f(r) = r * 2; 0 = f(1) + r", X: 3, Y: 4, Expected: 7},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.String() != each.Formula {
+				t.Errorf("Failed to match %v with %v", f.String(), each.Formula)
+			}
+			if w, _, _ := f.Evaluate(each.X, each.Y, 0); math.Abs(w-each.Expected) > 1e-12 {
+				t.Errorf("Got %v expected %v", w, each.Expected)
+			}
+		})
+	}
+}
+
+func TestPolarVarsAccessed(t *testing.T) {
+	state := &RealState{X: 3, Y: 4}
+	ParseFunction("0 = theta").Equals.RHS.Evaluate(state)
+	if !state.AccessedTheta || state.AccessedR {
+		t.Errorf("Expected only theta accessed got r %v theta %v", state.AccessedR, state.AccessedTheta)
+	}
+	if _, err := ParseFunctionE("theta = 1; x = 2; y = theta"); err == nil {
+		t.Errorf("Expected x to be refused as a binding")
+	}
+}
+
+func TestFrameTimes(t *testing.T) {
+	for eachI, each := range []struct {
+		Lower, Upper, Step float64
+		Expected           []float64
+	}{
+		{Lower: 0, Upper: 3, Step: 1, Expected: []float64{0, 1, 2}},
+		{Lower: 0, Upper: 0.3, Step: 0.05, Expected: []float64{0, 0.05, 0.1, 0.15, 0.2, 0.25}},
+		{Lower: -1, Upper: 1, Step: 0.75, Expected: []float64{-1, -0.25, 0.5}},
+		{Lower: 2, Upper: 4, Step: 0, Expected: []float64{2, 3}},
+		{Lower: 5, Upper: 1, Step: 1, Expected: []float64{5}},
+	} {
+		t.Run(fmt.Sprintf("%d: %v to %v by %v", eachI, each.Lower, each.Upper, each.Step), func(t *testing.T) {
+			if got := FrameTimes(each.Lower, each.Upper, each.Step); !reflect.DeepEqual(got, each.Expected) {
+				t.Errorf("Got %v expected %v", got, each.Expected)
+			}
+		})
+	}
+	if got := len(FrameTimes(0, math.Inf(1), 1)); got != maxFrames {
+		t.Errorf("Got %d frames expected %d", got, maxFrames)
+	}
+}
+
+func TestPlotFractionalT(t *testing.T) {
+	f := ParseFunction("0 = t")
+	tUsed, plots := f.Plot(0, 1, 0.25, image.Rect(-1, -1, 1, 1), 1)
+	if !tUsed || len(plots) != 4 {
+		t.Fatalf("Got %d plots T used %v", len(plots), tUsed)
+	}
+	for i, plot := range plots {
+		if expected := float64(i) / 4; plot.T != expected || plot.Get(0, 0) != expected {
+			t.Errorf("Plot %d is for T %v with %v expected %v", i, plot.T, plot.Get(0, 0), expected)
+		}
+	}
+	if _, plots := ParseFunction("0 = x").Plot(0, 1, 0.25, image.Rect(-1, -1, 1, 1), 1); len(plots) != 1 {
+		t.Errorf("Got %d plots for a formula without t", len(plots))
+	}
+}
@@ -0,0 +1,347 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StringLiteral is text in double quotes, as in "terrain.png", with the escapes of a Go string. It can only be the
+// file name or an option given to img and has no value of its own.
+type StringLiteral struct {
+	// Text is the string as it was written, quotes and escapes included.
+	Text  string
+	Value string
+}
+
+// newStringLiteral makes a StringLiteral of text as it was lexed, which the lexer has already checked unquotes.
+func newStringLiteral(text string) Expression {
+	value, _ := strconv.Unquote(text)
+	return &StringLiteral{Text: text, Value: value}
+}
+
+func (v StringLiteral) Evaluate(state State) float64 {
+	return math.NaN()
+}
+
+func (v StringLiteral) String() string {
+	return v.Text
+}
+
+func (v StringLiteral) Simplify() Expression {
+	return &v
+}
+
+func (v StringLiteral) Depth() int {
+	return 1
+}
+
+// Interpolation is how img reads between the pixels of an image.
+type Interpolation int
+
+const (
+	// InterpolationBilinear blends the 4 pixels around the point by how near it is to each.
+	InterpolationBilinear Interpolation = iota
+	// InterpolationNearest reads the pixel the point is in.
+	InterpolationNearest
+)
+
+var interpolationNames = []string{"bilinear", "nearest"}
+
+func (i Interpolation) String() string {
+	if i < 0 || int(i) >= len(interpolationNames) {
+		return fmt.Sprintf("Interpolation(%d)", int(i))
+	}
+	return interpolationNames[i]
+}
+
+// Channel is what img reads from each pixel, each from 0 to 1.
+type Channel int
+
+const (
+	// ChannelLuminance is the brightness of the red, green and blue, weighted as Rec. 601 does.
+	ChannelLuminance Channel = iota
+	ChannelRed
+	ChannelGreen
+	ChannelBlue
+	ChannelAlpha
+)
+
+var channelNames = []string{"luminance", "red", "green", "blue", "alpha"}
+
+func (c Channel) String() string {
+	if c < 0 || int(c) >= len(channelNames) {
+		return fmt.Sprintf("Channel(%d)", int(c))
+	}
+	return channelNames[c]
+}
+
+// ImageSample is img("terrain.png", x, y), an image read at X, Y, as in "y = img("terrain.png", x / 10, y / 10) *
+// sin(t)". The image is centred on the origin with y going up and its longer side from -1 to 1. Options can follow
+// X and Y, each in quotes: "bilinear" (the default) or "nearest" for the Interpolation, "clamp" (the default), "wrap"
+// or "zero" for what is read beyond the edges, as with prev, and "luminance" (the default), "red", "green", "blue" or
+// "alpha" for the Channel.
+//
+// PNG, JPEG and GIF files can be read, the first frame of a GIF being used, from the directory given by
+// Parser.ImageDir. The image is loaded when the formula is parsed and kept for every frame, and for other formulas
+// using the same file until it changes.
+type ImageSample struct {
+	// Name is img as it was written.
+	Name          string
+	File          *StringLiteral
+	X, Y          Expression
+	Options       []*StringLiteral
+	Interpolation Interpolation
+	Boundary      Boundary
+	Channel       Channel
+	raster        *raster
+}
+
+func (v ImageSample) Evaluate(state State) float64 {
+	x, y := v.X.Evaluate(state), v.Y.Evaluate(state)
+	if v.raster == nil || math.IsNaN(x) || math.IsNaN(y) {
+		return math.NaN()
+	}
+	return v.raster.sample(x, y, v.Interpolation, v.Boundary, v.Channel)
+}
+
+func (v ImageSample) String() string {
+	args := []string{v.File.String(), v.X.String(), v.Y.String()}
+	for _, o := range v.Options {
+		args = append(args, o.String())
+	}
+	return fmt.Sprintf("%s(%s)", v.Name, strings.Join(args, ", "))
+}
+
+func (v ImageSample) Simplify() Expression {
+	v.X = removeBrackets(v.X.Simplify())
+	v.Y = removeBrackets(v.Y.Simplify())
+	return &v
+}
+
+func (v ImageSample) Depth() int {
+	return maxDepth(v.X, v.Y)
+}
+
+// raster is a decoded image, the channels of each pixel from 0 to 1 without the alpha premultiplied, a row at a time
+// from the top.
+type raster struct {
+	size   image.Rectangle
+	pixels [][4]float64
+}
+
+func newRaster(img image.Image) *raster {
+	bounds := img.Bounds()
+	r := &raster{
+		size:   image.Rect(0, 0, bounds.Dx(), bounds.Dy()),
+		pixels: make([][4]float64, bounds.Dx()*bounds.Dy()),
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			r.pixels[(y-bounds.Min.Y)*bounds.Dx()+x-bounds.Min.X] = [4]float64{
+				float64(c.R) / 0xFFFF,
+				float64(c.G) / 0xFFFF,
+				float64(c.B) / 0xFFFF,
+				float64(c.A) / 0xFFFF,
+			}
+		}
+	}
+	return r
+}
+
+// at is channel of pixel x, y, counting from the top left, with those beyond the edges read as boundary says.
+func (r *raster) at(x, y int, boundary Boundary, channel Channel) float64 {
+	p, ok := boundary.point(image.Pt(x, y), r.size)
+	if !ok {
+		return 0
+	}
+	c := r.pixels[p.Y*r.size.Dx()+p.X]
+	if channel == ChannelLuminance {
+		return 0.299*c[0] + 0.587*c[1] + 0.114*c[2]
+	}
+	return c[channel-ChannelRed]
+}
+
+// sample is channel at the point x, y, see ImageSample for where the image is.
+func (r *raster) sample(x, y float64, interpolation Interpolation, boundary Boundary, channel Channel) float64 {
+	scale := float64(max(r.size.Dx(), r.size.Dy())) / 2
+	px := float64(r.size.Dx())/2 + x*scale - 0.5
+	py := float64(r.size.Dy())/2 - y*scale - 0.5
+	if math.Abs(px) > math.MaxInt32 || math.Abs(py) > math.MaxInt32 {
+		return math.NaN()
+	}
+	if interpolation == InterpolationNearest {
+		return r.at(int(math.Round(px)), int(math.Round(py)), boundary, channel)
+	}
+	left, top := math.Floor(px), math.Floor(py)
+	fx, fy := px-left, py-top
+	x0, y0 := int(left), int(top)
+	upper := r.at(x0, y0, boundary, channel)*(1-fx) + r.at(x0+1, y0, boundary, channel)*fx
+	lower := r.at(x0, y0+1, boundary, channel)*(1-fx) + r.at(x0+1, y0+1, boundary, channel)*fx
+	return upper*(1-fy) + lower*fy
+}
+
+// cachedRaster is a loaded image and the modification time and size of its file when it was loaded.
+type cachedRaster struct {
+	modified time.Time
+	size     int64
+	raster   *raster
+}
+
+var (
+	rastersLock sync.Mutex
+	// rasters are the images img has loaded, by absolute path.
+	rasters = map[string]*cachedRaster{}
+)
+
+// The reasons loadRaster gives for not reading a file, which say nothing of the directories outside dir.
+var (
+	errImageOutside  = errors.New("it isn't inside the image directory")
+	errImageMissing  = errors.New("there is no such file")
+	errImageUnusable = errors.New("it can't be read from the image directory")
+)
+
+// loadRaster loads the image in file, a name relative to dir, or returns the one already loaded if the file hasn't
+// changed since. Names leading outside dir, through ".." or a symbolic link, are errors.
+func loadRaster(dir, file string) (*raster, error) {
+	if !filepath.IsLocal(file) {
+		return nil, errImageOutside
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errImageUnusable
+	}
+	root, err := os.OpenRoot(abs)
+	if err != nil {
+		return nil, errImageUnusable
+	}
+	defer root.Close()
+	info, err := root.Stat(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errImageMissing
+	} else if err != nil {
+		return nil, errImageUnusable
+	}
+	path := filepath.Join(abs, file)
+	rastersLock.Lock()
+	defer rastersLock.Unlock()
+	if c, ok := rasters[path]; ok && c.modified.Equal(info.ModTime()) && c.size == info.Size() {
+		return c.raster, nil
+	}
+	f, err := root.Open(file)
+	if err != nil {
+		return nil, errImageUnusable
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	if img.Bounds().Empty() {
+		return nil, fmt.Errorf("%s has no pixels", file)
+	}
+	r := newRaster(img)
+	rasters[path] = &cachedRaster{
+		modified: info.ModTime(),
+		size:     info.Size(),
+		raster:   r,
+	}
+	return r, nil
+}
+
+// isImageName reports whether name is img.
+func isImageName(name string) bool {
+	return strings.EqualFold(name, "img")
+}
+
+// imageHint is the hint given with the errors of img.
+const imageHint = `for example img("terrain.png", x, y), or img("terrain.png", x, y, "nearest", "wrap", "red") with options`
+
+// image recognises img("file", x, y, options...), loading the file. Errors are recorded against the tokens and nil
+// returned.
+func (lex *CalcLexer) image(name string, args []Expression, tokens []lexedToken) *ImageSample {
+	at := findToken(tokens, name)
+	file, ok := Expression(nil), false
+	if len(args) >= 3 {
+		file = args[0]
+		_, ok = file.(*StringLiteral)
+		for _, xy := range args[1:3] {
+			if _, isString := xy.(*StringLiteral); isString {
+				ok = false
+			}
+		}
+	}
+	if !ok {
+		lex.fail(at, fmt.Sprintf("%s takes a file name in quotes, x, y and any options", name), imageHint)
+		return nil
+	}
+	v := &ImageSample{
+		Name: name,
+		File: file.(*StringLiteral),
+		X:    args[1],
+		Y:    args[2],
+	}
+	given := map[string]*StringLiteral{}
+	for _, arg := range args[3:] {
+		option, ok := arg.(*StringLiteral)
+		if !ok {
+			lex.fail(at, fmt.Sprintf("the options of %s are strings in quotes", name), imageHint)
+			return nil
+		}
+		kind := v.setOption(option.Value)
+		if kind == "" {
+			lex.fail(findToken(tokens, option.Text), fmt.Sprintf("unknown %s option %s", name, option.Text), "the options are bilinear or nearest, clamp, wrap or zero and luminance, red, green, blue or alpha")
+			return nil
+		}
+		if earlier, ok := given[kind]; ok {
+			lex.fail(findToken(tokens, option.Text), fmt.Sprintf("%s is given %s after %s", name, option.Text, earlier.Text), fmt.Sprintf("give one %s", kind))
+			return nil
+		}
+		given[kind] = option
+		v.Options = append(v.Options, option)
+	}
+	if lex.imageDir == "" {
+		lex.fail(at, fmt.Sprintf("%s can't read files as no image directory has been given", name), "set Parser.ImageDir from Go or use the -images flag")
+		return nil
+	}
+	r, err := loadRaster(lex.imageDir, v.File.Value)
+	if err != nil {
+		lex.fail(findToken(tokens, v.File.Text), fmt.Sprintf("can't load %s: %v", v.File.Text, err), "img reads PNG, JPEG and GIF files in the image directory, names being relative to it")
+		return nil
+	}
+	v.raster = r
+	return v
+}
+
+// setOption sets the option named, returning which kind of option it is, or "" if there is no such option.
+func (v *ImageSample) setOption(name string) string {
+	for i, n := range interpolationNames {
+		if strings.EqualFold(name, n) {
+			v.Interpolation = Interpolation(i)
+			return "interpolation"
+		}
+	}
+	if b, err := ParseBoundary(name); err == nil {
+		v.Boundary = b
+		return "boundary"
+	}
+	for i, n := range channelNames {
+		if strings.EqualFold(name, n) {
+			v.Channel = Channel(i)
+			return "channel"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,263 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// writeTestImage writes a 4 by 2 PNG called test.png into a temporary directory, transparent black but for a red
+// pixel at the top left and a white one at the bottom right, returning the directory.
+func writeTestImage(t *testing.T) string {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	img.Set(0, 0, color.NRGBA{R: 0xFF, A: 0xFF})
+	img.Set(3, 1, color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF})
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "test.png"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	return dir
+}
+
+// imageParser is a Parser reading images from dir.
+func imageParser(dir string) *Parser {
+	p := NewParser()
+	p.ImageDir = dir
+	return p
+}
+
+func TestImageSample(t *testing.T) {
+	parser := imageParser(writeTestImage(t))
+	// The pixel centres are 0.5 apart, the red one at -0.75, 0.25 and the white one at 0.75, -0.25.
+	for eachI, each := range []struct {
+		Args     string
+		X, Y     float64
+		Expected float64
+	}{
+		{Args: `"nearest"`, X: -0.75, Y: 0.25, Expected: 0.299},
+		{Args: `"nearest"`, X: -0.6, Y: 0.1, Expected: 0.299},
+		{Args: `"nearest"`, X: 0.75, Y: -0.25, Expected: 1},
+		{Args: `"nearest"`, X: 0, Y: 0, Expected: 0},
+		{Args: `"nearest", "red"`, X: -0.75, Y: 0.25, Expected: 1},
+		{Args: `"green", "nearest"`, X: -0.75, Y: 0.25, Expected: 0},
+		{Args: `"nearest", "blue"`, X: 0.75, Y: -0.25, Expected: 1},
+		{Args: `"alpha", "nearest"`, X: 0.25, Y: 0.25, Expected: 0},
+		{Args: `"red"`, X: -0.5, Y: 0.25, Expected: 0.5},
+		{Args: `"red"`, X: -0.75, Y: 0, Expected: 0.5},
+		{Args: `"red"`, X: -0.5, Y: 0, Expected: 0.25},
+		{Args: `"BILINEAR", "Red"`, X: -0.75, Y: 0.25, Expected: 1},
+		{Args: `"red"`, X: -2.75, Y: 0.25, Expected: 1},
+		{Args: `"red", "wrap"`, X: -2.75, Y: 0.25, Expected: 1},
+		{Args: `"red", "zero"`, X: -2.75, Y: 0.25, Expected: 0},
+		{Args: `"wrap"`, X: 1.25, Y: -0.25, Expected: 0},
+		{Args: `"clamp"`, X: 1.25, Y: -0.25, Expected: 1},
+		{Args: `"nearest"`, X: math.NaN(), Y: 0, Expected: math.NaN()},
+		{Args: `"nearest"`, X: 1e300, Y: 0, Expected: math.NaN()},
+	} {
+		formula := fmt.Sprintf(`0 = img("test.png", x, y, %s)`, each.Args)
+		t.Run(fmt.Sprintf("%d: %s", eachI, formula), func(t *testing.T) {
+			f, err := parser.Parse(formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.String() != formula {
+				t.Errorf("Got %#v expected %#v", f.String(), formula)
+			}
+			if _, err := parser.Parse(f.Simplify().String()); err != nil {
+				t.Errorf("Reparse failed: %v", err)
+			}
+			got, _, err := f.Evaluate(each.X, each.Y, 0)
+			if err != nil {
+				t.Fatalf("Evaluate failed: %v", err)
+			}
+			if math.IsNaN(each.Expected) != math.IsNaN(got) || math.Abs(got-each.Expected) > 1e-4 {
+				t.Errorf("Got %v expected %v", got, each.Expected)
+			}
+		})
+	}
+}
+
+func TestImageCache(t *testing.T) {
+	dir := writeTestImage(t)
+	first, err := loadRaster(dir, "test.png")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if again, err := loadRaster(dir, "test.png"); err != nil || again != first {
+		t.Errorf("Got %p %v expected the same image %p", again, err, first)
+	}
+	img := image.NewGray(image.Rect(0, 0, 3, 3))
+	f, err := os.Create(filepath.Join(dir, "test.png"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	f.Close()
+	changed, err := loadRaster(dir, "test.png")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if changed == first || changed.size != image.Rect(0, 0, 3, 3) {
+		t.Errorf("Got %v expected the changed image", changed.size)
+	}
+}
+
+func TestImageErrors(t *testing.T) {
+	dir := writeTestImage(t)
+	if err := os.WriteFile(filepath.Join(dir, "notAnImage.png"), []byte("not an image"), 0o644); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	outside := writeTestImage(t)
+	if err := os.Symlink(filepath.Join(outside, "test.png"), filepath.Join(dir, "link.png")); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+	parser := imageParser(dir)
+	for eachI, each := range []struct {
+		Formula string
+		Complex bool
+		Column  int
+		Reason  string
+	}{
+		{
+			Formula: `0 = "x"`,
+			Column:  5,
+			Reason:  "a string can only be a file name or option given to img",
+		},
+		{
+			Formula: `0 = sin("x")`,
+			Column:  9,
+			Reason:  "a string can only be a file name or option given to img",
+		},
+		{
+			Formula: `0 = img("x", y)`,
+			Column:  5,
+			Reason:  "img takes a file name in quotes, x, y and any options",
+		},
+		{
+			Formula: `0 = img(x, y, "x")`,
+			Column:  5,
+			Reason:  "img takes a file name in quotes, x, y and any options",
+		},
+		{
+			Formula: `0 = img("missing.png", x, y, 1)`,
+			Column:  5,
+			Reason:  "the options of img are strings in quotes",
+		},
+		{
+			Formula: `0 = img("missing.png", x, y, "cubic")`,
+			Column:  30,
+			Reason:  `unknown img option "cubic"`,
+		},
+		{
+			Formula: `0 = img("missing.png", x, y, "wrap", "red", "zero")`,
+			Column:  45,
+			Reason:  `img is given "zero" after "wrap"`,
+		},
+		{
+			Formula: `0 = img("missing.png", x, y)`,
+			Column:  9,
+			Reason:  `can't load "missing.png": there is no such file`,
+		},
+		{
+			Formula: `0 = img("notAnImage.png", x, y)`,
+			Column:  9,
+			Reason:  `can't load "notAnImage.png": image: unknown format`,
+		},
+		{
+			Formula: fmt.Sprintf(`0 = img("../%s/test.png", x, y)`, filepath.Base(outside)),
+			Column:  9,
+			Reason:  fmt.Sprintf(`can't load "../%s/test.png": it isn't inside the image directory`, filepath.Base(outside)),
+		},
+		{
+			Formula: fmt.Sprintf("0 = img(%s, x, y)", strconv.Quote(filepath.Join(outside, "test.png"))),
+			Column:  9,
+			Reason:  fmt.Sprintf("can't load %s: it isn't inside the image directory", strconv.Quote(filepath.Join(outside, "test.png"))),
+		},
+		{
+			Formula: `0 = img("link.png", x, y)`,
+			Column:  9,
+			Reason:  `can't load "link.png": it can't be read from the image directory`,
+		},
+		{
+			Formula: `y = d(img("test.png", x, y), x)`,
+			Column:  5,
+			Reason:  "img has no derivative",
+		},
+		{
+			Formula: `0 = img("test.png", x, y) + z`,
+			Complex: true,
+			Column:  1,
+			Reason:  `img("test.png", x, y) isn't defined for complex numbers`,
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			parse := parser.Parse
+			if each.Complex {
+				parse = parser.ParseComplex
+			}
+			_, err := parse(each.Formula)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a *ParseError got %#v", err)
+			}
+			if pe.Column != each.Column || pe.Reason != each.Reason {
+				t.Errorf("Got column %d %#v expected column %d %#v", pe.Column, pe.Reason, each.Column, each.Reason)
+			}
+		})
+	}
+}
+
+func TestImageDirRequired(t *testing.T) {
+	_, err := ParseFunctionE(`0 = img("test.png", x, y)`)
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Expected a *ParseError got %#v", err)
+	}
+	if pe.Column != 5 || pe.Reason != "img can't read files as no image directory has been given" {
+		t.Errorf("Got column %d %#v", pe.Column, pe.Reason)
+	}
+}
+
+func TestImageShadowed(t *testing.T) {
+	f, err := ParseFunctionE("img(a, b) = a * b; 0 = img(x, y)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got, _, err := f.Evaluate(2, 3, 0); err != nil || got != 6 {
+		t.Errorf("Got %v %v expected 6", got, err)
+	}
+}
+
+func TestLexerStrings(t *testing.T) {
+	lexer := NewCalcLexer(`img("a \"b\".png", x, y)`).(*CalcLexer)
+	var lval yySymType
+	lexer.Lex(&lval)
+	if c := lexer.Lex(&lval); c != int(rune('(')) {
+		t.Fatalf("Got %d expected (", c)
+	}
+	if c := lexer.Lex(&lval); c != STRING || lval.s != `"a \"b\".png"` {
+		t.Errorf("Got %d %#v expected STRING", c, lval.s)
+	}
+	_, err := ParseFunctionE(`0 = img("terrain.png, x, y)`)
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Expected a *ParseError got %#v", err)
+	}
+	if pe.Column != 9 || pe.Reason != "unterminated string" {
+		t.Errorf("Got column %d %#v", pe.Column, pe.Reason)
+	}
+}
@@ -0,0 +1,271 @@
+package heatPlot
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+)
+
+const (
+	// integralTolerance is the error adaptive Simpson's rule aims for over the whole of an integral.
+	integralTolerance = 1e-9
+	// maxIntegralDepth stops an integrand which never settles, such as sin(1 / s) near 0, from splitting the interval
+	// forever. The deepest intervals are 2^-maxIntegralDepth of the whole.
+	maxIntegralDepth = 20
+)
+
+// Integral is integrate(s, from, to, body), the integral of Body as the variable Index goes from From to To. It is
+// worked out with adaptive Simpson's rule, Body being evaluated with Index bound in a scope of its own. As in
+// "y = integrate(s, 0, x, sin(s) / s)". Swapping From and To negates it and infinite bounds give NaN.
+type Integral struct {
+	Index string
+	From  Expression
+	To    Expression
+	Body  Expression
+}
+
+func (v Integral) Evaluate(state State) float64 {
+	from, to := v.From.Evaluate(state), v.To.Evaluate(state)
+	if math.IsNaN(from) || math.IsNaN(to) || math.IsInf(from, 0) || math.IsInf(to, 0) {
+		return math.NaN()
+	}
+	if from == to {
+		return 0
+	}
+	scope := state.Scope()
+	f := func(s float64) float64 {
+		scope.Bind(v.Index, s)
+		return v.Body.Evaluate(scope)
+	}
+	mid := (from + to) / 2
+	fa, fm, fb := f(from), f(mid), f(to)
+	whole := simpson(from, to, fa, fm, fb)
+	return adaptiveSimpson(f, from, to, fa, fm, fb, whole, integralTolerance, maxIntegralDepth)
+}
+
+// simpson is Simpson's rule over a to b given f at a, halfway and b.
+func simpson(a, b, fa, fm, fb float64) float64 {
+	return (b - a) / 6 * (fa + 4*fm + fb)
+}
+
+// adaptiveSimpson halves the interval a to b until Simpson's rule over the halves agrees with whole, the rule over
+// all of it, to within tolerance. The difference between the two is used to improve the result as well.
+func adaptiveSimpson(f func(float64) float64, a, b, fa, fm, fb, whole, tolerance float64, depth int) float64 {
+	m := (a + b) / 2
+	lm, rm := (a+m)/2, (m+b)/2
+	flm, frm := f(lm), f(rm)
+	left, right := simpson(a, m, fa, flm, fm), simpson(m, b, fm, frm, fb)
+	delta := left + right - whole
+	if depth <= 0 || math.Abs(delta) <= 15*tolerance || math.IsNaN(delta) {
+		return left + right + delta/15
+	}
+	return adaptiveSimpson(f, a, m, fa, flm, fm, left, tolerance/2, depth-1) +
+		adaptiveSimpson(f, m, b, fm, frm, fb, right, tolerance/2, depth-1)
+}
+
+func (v Integral) binds() (string, []Expression) {
+	return v.Index, []Expression{v.Body}
+}
+
+func (v Integral) String() string {
+	return fmt.Sprintf("integrate(%s, %s, %s, %s)", v.Index, v.From.String(), v.To.String(), v.Body.String())
+}
+
+func (v Integral) Simplify() Expression {
+	v.From = removeBrackets(v.From.Simplify())
+	v.To = removeBrackets(v.To.Simplify())
+	v.Body = removeBrackets(v.Body.Simplify())
+	return &v
+}
+
+func (v Integral) Depth() int {
+	return maxDepth(v.From, v.To, v.Body)
+}
+
+// integral recognises integrate(s, from, to, body), where the first argument names the variable of integration. As
+// with a sum's index it can be any name other than the built in variables. It returns nil for anything else.
+func (lex *CalcLexer) integral(name string, args []Expression) *Integral {
+	if len(args) != 4 || !strings.EqualFold(name, "integrate") {
+		return nil
+	}
+	index, ok := args[0].(*Var)
+	if !ok || lex.builtinVar(index.Var) {
+		return nil
+	}
+	return &Integral{
+		Index: index.Var,
+		From:  args[1],
+		To:    args[2],
+		Body:  args[3],
+	}
+}
+
+// Accumulate is accumulate(expr), the sum of Expr over the frames of the animation up to and including the current
+// one, see State.Frames, so each frame shows a running total of them, as in "y = accumulate(sin(x + t)) / 10". Only
+// the latest maxFrames values are added up. Bindings are the variables bound before it, which are worked out again
+// for each t.
+//
+// When the total was kept in the frame before, see State.Total, only the current frame is added to it, so plotting an
+// animation doesn't add up every frame again in each. carried is set when Expr uses nothing but x, y, t and the
+// Bindings, so its total at a pixel is the same wherever it is worked out.
+type Accumulate struct {
+	Expr     Expression
+	Bindings []*Binding
+	carried  bool
+}
+
+func (v Accumulate) Evaluate(state State) float64 {
+	now := state.CurT()
+	start, step := state.Frames()
+	// The frames before now, allowing for the rounding of their times.
+	before := math.Floor((now-start)/step + 1e-6)
+	if !(before > 0) {
+		before = 0
+	}
+	if v.carried {
+		if total, ok := state.Total(v.Expr, roundTime(now-step)); ok {
+			total += v.frame(state, now)
+			if before >= maxFrames {
+				total -= v.frame(state, roundTime(now-maxFrames*step))
+			}
+			state.KeepTotal(v.Expr, total)
+			return total
+		}
+	}
+	result := 0.0
+	for back := math.Min(before, maxFrames-1); back >= 0; back-- {
+		result += v.frame(state, roundTime(now-back*step))
+	}
+	if v.carried {
+		state.KeepTotal(v.Expr, result)
+	}
+	return result
+}
+
+// frame is Expr in the frame at t.
+func (v Accumulate) frame(state State, t float64) float64 {
+	frame := (&frameState{State: state, T: t}).Scope()
+	for _, b := range v.Bindings {
+		b.Evaluate(frame)
+	}
+	return v.Expr.Evaluate(frame)
+}
+
+func (v Accumulate) String() string {
+	return fmt.Sprintf("accumulate(%s)", v.Expr.String())
+}
+
+func (v Accumulate) Simplify() Expression {
+	v.Expr = removeBrackets(v.Expr.Simplify())
+	return &v
+}
+
+func (v Accumulate) Depth() int {
+	return maxDepth(v.Expr)
+}
+
+// readsPrev reports whether Expr reads the previous frame, directly or through the Bindings it uses.
+func (v Accumulate) readsPrev() bool {
+	fromPrev := map[string]bool{}
+	usesFromPrev := func(e Expression) bool {
+		found := usesPrev(e)
+		visitVars(e, func(v *Var) {
+			found = found || fromPrev[strings.ToUpper(v.Var)]
+		})
+		return found
+	}
+	for _, b := range v.Bindings {
+		fromPrev[strings.ToUpper(b.Name)] = usesFromPrev(b.Expr)
+	}
+	return usesFromPrev(v.Expr)
+}
+
+// timeline is the frames of an animation, the first at start and each step after the one before. The zero timeline is
+// every 1 from 0.
+type timeline struct {
+	start, step float64
+}
+
+// newTimeline is the timeline of the frames FrameTimes gives.
+func newTimeline(timeLowerBound, timeStep float64) timeline {
+	if !(timeStep > 0) {
+		timeStep = 1
+	}
+	return timeline{start: timeLowerBound, step: timeStep}
+}
+
+// orDefault is the start and step of the timeline, every 1 from 0 when it is the zero timeline.
+func (tl timeline) orDefault() (start, step float64) {
+	if !(tl.step > 0) {
+		return 0, 1
+	}
+	return tl.start, tl.step
+}
+
+// frameState is another frame of the animation, everything but t comes from the State it wraps.
+type frameState struct {
+	State
+	T float64
+}
+
+func (s *frameState) CurT() float64 {
+	return s.T
+}
+
+// Total is never kept for another frame, as an accumulate inside another is worked out for frames other than the
+// one being plotted.
+func (s *frameState) Total(e Expression, t float64) (float64, bool) {
+	return 0, false
+}
+
+func (s *frameState) KeepTotal(e Expression, total float64) {}
+
+func (s *frameState) Scope() State {
+	return newScopedState(s)
+}
+
+// frameTotals are the running totals of the accumulates in the frame at t of frames, kept at each pixel by their
+// expression. The nil frameTotals keeps none.
+type frameTotals struct {
+	frames timeline
+	t      float64
+	values map[Expression]map[image.Point]float64
+}
+
+func newFrameTotals(frames timeline, t float64) *frameTotals {
+	return &frameTotals{
+		frames: frames,
+		t:      t,
+		values: map[Expression]map[image.Point]float64{},
+	}
+}
+
+// total is the running total of e at pixel, when these are the totals of the frame at t of frames and it was kept.
+func (ft *frameTotals) total(e Expression, pixel image.Point, frames timeline, t float64) (float64, bool) {
+	if ft == nil || ft.frames != frames || ft.t != t {
+		return 0, false
+	}
+	total, ok := ft.values[e][pixel]
+	return total, ok
+}
+
+func (ft *frameTotals) keep(e Expression, pixel image.Point, total float64) {
+	if ft == nil {
+		return
+	}
+	if ft.values[e] == nil {
+		ft.values[e] = map[image.Point]float64{}
+	}
+	ft.values[e][pixel] = total
+}
+
+// accumulateBindings gives every Accumulate in e the bindings made before it.
+func accumulateBindings(e Expression, bindings []*Binding) {
+	if a, ok := e.(*Accumulate); ok {
+		a.Bindings = bindings
+	}
+	for _, child := range children(e) {
+		accumulateBindings(child, bindings)
+	}
+}
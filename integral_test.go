@@ -0,0 +1,289 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"testing"
+)
+
+func TestIntegral(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula  string
+		String   string
+		Expected func(x, y, t float64) float64
+		TUsed    bool
+	}{
+		{
+			Formula:  "0 = integrate(s, 0, x, s^2)",
+			String:   "0 = integrate(s, 0, x, s ^ 2)",
+			Expected: func(x, y, t float64) float64 { return x * x * x / 3 },
+		},
+		{
+			Formula:  "0 = integrate(s, 0, pi, sin(s * y))",
+			String:   "0 = integrate(s, 0, pi, sin(s * y))",
+			Expected: func(x, y, t float64) float64 { return (1 - math.Cos(math.Pi*y)) / y },
+		},
+		{
+			Formula:  "0 = integrate(s, x, 0, 1)",
+			String:   "0 = integrate(s, x, 0, 1)",
+			Expected: func(x, y, t float64) float64 { return -x },
+		},
+		{
+			Formula:  "0 = integrate(u, 0, t, exp(-u))",
+			String:   "0 = integrate(u, 0, t, exp(-u))",
+			Expected: func(x, y, t float64) float64 { return 1 - math.Exp(-float64(t)) },
+			TUsed:    true,
+		},
+		{
+			Formula:  "f(a) = integrate(s, 0, a, integrate(v, 0, s, 1)); 0 = f(x)",
+			String:   "f(a) = integrate(s, 0, a, integrate(v, 0, s, 1)); 0 = f(x)",
+			Expected: func(x, y, t float64) float64 { return x * x / 2 },
+		},
+		{
+			Formula:  "0 = accumulate(t)",
+			String:   "0 = accumulate(t)",
+			Expected: func(x, y, t float64) float64 { return float64(t*(t+1)) / 2 },
+			TUsed:    true,
+		},
+		{
+			Formula:  "0 = accumulate(x)",
+			String:   "0 = accumulate(x)",
+			Expected: func(x, y, t float64) float64 { return x * float64(t+1) },
+			TUsed:    true,
+		},
+		{
+			Formula:  "a = x * t; 0 = accumulate(a) + a",
+			String:   "a = x * t; 0 = accumulate(a) + a",
+			Expected: func(x, y, t float64) float64 { return x*float64(t*(t+1))/2 + x*float64(t) },
+			TUsed:    true,
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.String() != each.String {
+				t.Errorf("Got %#v expected %#v", f.String(), each.String)
+			}
+			if _, err := ParseFunctionE(f.Simplify().String()); err != nil {
+				t.Errorf("Reparse failed: %v", err)
+			}
+			for _, p := range [][3]float64{{3, 5, 7}, {-1.5, 2, 1}, {0.25, -4, 12}} {
+				got, tUsed, err := f.Evaluate(p[0], p[1], p[2])
+				if err != nil {
+					t.Fatalf("Evaluate failed: %v", err)
+				}
+				if expected := each.Expected(p[0], p[1], p[2]); math.Abs(got-expected) > 1e-8 {
+					t.Errorf("At %v got %v expected %v", p, got, expected)
+				}
+				if tUsed != each.TUsed {
+					t.Errorf("At %v T used %v expected %v", p, tUsed, each.TUsed)
+				}
+			}
+		})
+	}
+}
+
+func TestIntegralBounds(t *testing.T) {
+	for _, each := range []string{"0 = integrate(s, 0, 1 / 0, s)", "0 = integrate(s, nan(), 1, s)"} {
+		f, err := ParseFunctionE(each)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		if got, _, _ := f.Evaluate(1, 1, 0); !math.IsNaN(got) {
+			t.Errorf("%s got %v expected NaN", each, got)
+		}
+	}
+}
+
+func TestIntegralDerivative(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula  string
+		Expected func(x, y, t float64) float64
+	}{
+		{
+			Formula:  "y = d(integrate(s, 0, x, s^2), x)",
+			Expected: func(x, y, t float64) float64 { return x * x },
+		},
+		{
+			Formula:  "y = d(integrate(s, x, 2x, s * y), x)",
+			Expected: func(x, y, t float64) float64 { return 4*x*y - x*y },
+		},
+		{
+			Formula:  "y = d(integrate(s, 0, 1, sin(s * x)), x)",
+			Expected: func(x, y, t float64) float64 { return math.Sin(x)/x + (math.Cos(x)-1)/(x*x) },
+		},
+		{
+			Formula:  "y = d(accumulate(x^2 * t), x)",
+			Expected: func(x, y, t float64) float64 { return x * float64(t*(t+1)) },
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			for _, p := range [][3]float64{{3, 5, 7}, {-1.5, 2, 1}, {0.25, -4, 12}} {
+				got, _, err := f.Evaluate(p[0], p[1], p[2])
+				if err != nil {
+					t.Fatalf("Evaluate failed: %v", err)
+				}
+				if expected := each.Expected(p[0], p[1], p[2]) - p[1]; math.Abs(got-expected) > 1e-8 {
+					t.Errorf("At %v got %v expected %v", p, got, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestIntegralErrors(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula string
+		Column  int
+		Reason  string
+	}{
+		{
+			Formula: "y = integrate(x, 0, 1, x)",
+			Column:  5,
+			Reason:  "integrate takes a variable, its first and last values and the integrand",
+		},
+		{
+			Formula: "y = integrate(s, 0, 1)",
+			Column:  5,
+			Reason:  "integrate takes a variable, its first and last values and the integrand",
+		},
+		{
+			Formula: "y = integrate(s, 0, 1, s) + s",
+			Column:  29,
+			Reason:  "variable s is used before it is defined",
+		},
+		{
+			Formula: "y = accumulate(x, y)",
+			Column:  5,
+			Reason:  "accumulate takes 1 argument but was given 2",
+		},
+		{
+			Formula: "y = d(accumulate(x), t)",
+			Column:  5,
+			Reason:  "accumulate has no derivative with respect to t",
+		},
+		{
+			Formula: "z = accumulate(z)",
+			Column:  1,
+			Reason:  "accumulate(z) isn't defined for complex numbers",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			_, err := ParseFunctionE(each.Formula)
+			if each.Formula[0] == 'z' {
+				_, err = ParseComplexFunctionE(each.Formula)
+			}
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a *ParseError got %#v", err)
+			}
+			if pe.Column != each.Column || pe.Reason != each.Reason {
+				t.Errorf("Got column %d %#v expected column %d %#v", pe.Column, pe.Reason, each.Column, each.Reason)
+			}
+		})
+	}
+}
+
+func TestAccumulateFractionalT(t *testing.T) {
+	f := ParseFunction("0 = accumulate(t)")
+	for _, each := range []struct{ T, Expected float64 }{{T: 2.5, Expected: 0.5 + 1.5 + 2.5}, {T: 0.25, Expected: 0.25}, {T: -0.5, Expected: -0.5}} {
+		if got, _, _ := f.Evaluate(0, 0, each.T); got != each.Expected {
+			t.Errorf("At T %v got %v expected %v", each.T, got, each.Expected)
+		}
+	}
+}
+
+func TestAccumulateFrames(t *testing.T) {
+	size := image.Rect(-1, -1, 1, 1)
+	for _, each := range []struct {
+		Formula            string
+		Lower, Upper, Step float64
+		Expected           []float64
+	}{
+		{Formula: "0 = accumulate(t)", Lower: 0, Upper: 1, Step: 0.25, Expected: []float64{0, 0.25, 0.75, 1.5}},
+		{Formula: "0 = accumulate(t)", Lower: -2, Upper: 1, Step: 1, Expected: []float64{-2, -3, -3}},
+		{Formula: "0 = accumulate(1)", Lower: 10, Upper: 11, Step: 0.05, Expected: []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}},
+		{Formula: "a = t * 2; 0 = accumulate(a)", Lower: 0.5, Upper: 2, Step: 0.5, Expected: []float64{1, 3, 6}},
+	} {
+		_, plots := ParseFunction(each.Formula).Plot(each.Lower, each.Upper, each.Step, size, 1)
+		if len(plots) != len(each.Expected) {
+			t.Fatalf("%s got %d plots expected %d", each.Formula, len(plots), len(each.Expected))
+		}
+		for i, plot := range plots {
+			if got := plot.Get(0, 0); math.Abs(got-each.Expected[i]) > 1e-9 {
+				t.Errorf("%s from %v by %v frame %d at T %v got %v expected %v", each.Formula, each.Lower, each.Step, i, plot.T, got, each.Expected[i])
+			}
+		}
+	}
+	_, plots := ParseFunction("rgb(accumulate(t) / 10, 0, 0)").PlotColour(1, 3, 0.5, size, 1)
+	if got, expected := plots[len(plots)-1].Get(0, 0).R, channel((1+1.5+2+2.5)/10); got != expected {
+		t.Errorf("Colour got %v expected %v", got, expected)
+	}
+}
+
+func TestAccumulateCarried(t *testing.T) {
+	size := image.Rect(-2, -2, 2, 2)
+	for _, formula := range []string{
+		"0 = accumulate(sin(x + t) * y)",
+		"a = x * t; 0 = accumulate(a) + accumulate(a^2)",
+		"f(a) = accumulate(a * t) + accumulate(x); 0 = f(x) + f(y)",
+		"0 = sum(k = 1, 3, accumulate(k * t) + accumulate(x))",
+		"0 = accumulate(accumulate(t) * x)",
+		"0 = if(x > 0, accumulate(t), 1)",
+	} {
+		f := ParseFunction(formula)
+		_, plots := f.Plot(0, 12, 1, size, 0.5)
+		if len(plots) != 12 {
+			t.Fatalf("%s got %d plots expected 12", formula, len(plots))
+		}
+		for _, plot := range plots {
+			// PlotForT works each frame out on its own, adding up every frame before it.
+			expected, _, err := f.PlotForT(size, plot.T, 0.5)
+			if err != nil {
+				t.Fatalf("%s PlotForT failed: %v", formula, err)
+			}
+			if !plot.Equals(expected) {
+				t.Errorf("%s at T %v got %v expected %v", formula, plot.T, plot.Values, expected.Values)
+			}
+		}
+	}
+}
+
+func TestAccumulateTotal(t *testing.T) {
+	f := ParseFunction("0 = accumulate(t + 1)")
+	e := f.Equals.RHS.(*Accumulate).Expr
+	carried := newFrameTotals(timeline{}, 4)
+	carried.keep(e, image.Pt(0, 0), 100)
+	late := newFrameTotals(timeline{}, maxFrames+3)
+	late.keep(e, image.Pt(0, 0), 0)
+	for _, each := range []struct {
+		Name     string
+		State    *RealState
+		Expected float64
+	}{
+		{Name: "Carried", State: &RealState{T: 5, carried: carried}, Expected: 106},
+		{Name: "Another pixel", State: &RealState{T: 5, Pixel: image.Pt(1, 0), carried: carried}, Expected: 21},
+		{Name: "Not the frame before", State: &RealState{T: 6, carried: carried}, Expected: 28},
+		{Name: "Other frames", State: &RealState{T: 5, frames: timeline{start: 1, step: 1}, carried: carried}, Expected: 20},
+		// The frame maxFrames before is taken off as the current one is added.
+		{Name: "Past maxFrames", State: &RealState{T: maxFrames + 4, carried: late}, Expected: maxFrames},
+	} {
+		t.Run(each.Name, func(t *testing.T) {
+			each.State.totals = newFrameTotals(each.State.frames, each.State.T)
+			if got := f.Equals.Evaluate(each.State); got != each.Expected {
+				t.Errorf("Got %v expected %v", got, each.Expected)
+			}
+			if kept, ok := each.State.totals.total(e, each.State.Pixel, each.State.frames, each.State.T); !ok || kept != each.Expected {
+				t.Errorf("Kept %v, %v expected %v", kept, ok, each.Expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package heatPlot
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strings"
+)
+
+// maxIterations stops an iterate with an enormous limit from hanging the plot. A larger limit is an error when it is
+// constant and NaN otherwise.
+const maxIterations = 10000
+
+// Iterate is iterate(w, start, update, bailout, max) or escape(w, start, update, bailout, max), the escape time of an
+// iterated map such as the Mandelbrot set's "y = iterate(w, 0, w^2 + z, abs(w) > 2, 100)". w begins as Start and is
+// replaced by Update until Bailout is true or Max updates have been made, Update and Bailout seeing w. iterate gives
+// how many updates were made and escape a smooth version of it, for colouring without bands.
+//
+// Every argument is evaluated over complex numbers, even in a formula which isn't complex, with z as x + iy and i the
+// imaginary unit. t can be used to animate a Julia set, as in "y = escape(w, z, w^2 + 0.7885 exp(i t / 20), abs(w) >
+// 2, 200)".
+type Iterate struct {
+	// Name is iterate or escape as it was written.
+	Name    string
+	Var     string
+	Start   Expression
+	Update  Expression
+	Bailout Expression
+	Max     Expression
+}
+
+// isSmooth reports whether the smooth escape value is wanted rather than the count.
+func (v Iterate) isSmooth() bool {
+	return strings.EqualFold(v.Name, "escape")
+}
+
+func (v Iterate) Evaluate(state State) float64 {
+	return real(v.EvaluateComplex(&ComplexState{outer: state}))
+}
+
+func (v Iterate) EvaluateComplex(state *ComplexState) complex128 {
+	limit := math.Floor(real(evaluateComplex(v.Max, state)))
+	if limit > maxIterations {
+		return cmplx.NaN()
+	}
+	if math.IsNaN(limit) || limit < 0 {
+		limit = 0
+	}
+	scope := state.Scope()
+	w := evaluateComplex(v.Start, state)
+	for n := 0.0; n < limit; n++ {
+		scope.Bind(v.Var, w)
+		if isComplexTrue(evaluateComplex(v.Bailout, scope)) {
+			return complex(v.escape(n, w), 0)
+		}
+		w = evaluateComplex(v.Update, scope)
+	}
+	return complex(limit, 0)
+}
+
+// escape is the value when w bails out after n updates. The smooth value assumes the update squares w, as most do, and
+// that w has got well away from the unit circle.
+func (v Iterate) escape(n float64, w complex128) float64 {
+	if !v.isSmooth() {
+		return n
+	}
+	if m := cmplx.Abs(w); m > 1 && !math.IsInf(m, 0) {
+		return n + 1 - math.Log2(math.Log(m))
+	}
+	return n
+}
+
+func (v Iterate) binds() (string, []Expression) {
+	return v.Var, []Expression{v.Update, v.Bailout}
+}
+
+func (v Iterate) String() string {
+	return fmt.Sprintf("%s(%s, %s, %s, %s, %s)", v.Name, v.Var, v.Start.String(), v.Update.String(), v.Bailout.String(), v.Max.String())
+}
+
+func (v Iterate) Simplify() Expression {
+	v.Start = removeBrackets(v.Start.Simplify())
+	v.Update = removeBrackets(v.Update.Simplify())
+	v.Bailout = removeBrackets(v.Bailout.Simplify())
+	v.Max = removeBrackets(v.Max.Simplify())
+	return &v
+}
+
+func (v Iterate) Depth() int {
+	return maxDepth(v.Start, v.Update, v.Bailout, v.Max)
+}
+
+// isIterateName reports whether name is iterate or escape.
+func isIterateName(name string) bool {
+	return strings.EqualFold(name, "iterate") || strings.EqualFold(name, "escape")
+}
+
+// iterate recognises iterate(w, start, update, bailout, max) and escape(...), where the first argument names the
+// variable being iterated. It can be any name other than the built in variables, z and i included. It returns nil
+// for anything else.
+func (lex *CalcLexer) iterate(name string, args []Expression) *Iterate {
+	if len(args) != 5 || !isIterateName(name) {
+		return nil
+	}
+	w, ok := args[0].(*Var)
+	if !ok || isBuiltinVar(w.Var) || isComplexVar(w.Var) {
+		return nil
+	}
+	return &Iterate{
+		Name:    name,
+		Var:     w.Var,
+		Start:   args[1],
+		Update:  args[2],
+		Bailout: args[3],
+		Max:     args[4],
+	}
+}
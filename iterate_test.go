@@ -0,0 +1,189 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+// mandelbrot is the escape time of c written out, smooth as escape gives it.
+func mandelbrot(c complex128, limit int, smooth bool) float64 {
+	w := complex(0, 0)
+	for n := 0; n < limit; n++ {
+		if cmplx.Abs(w) > 2 {
+			if smooth {
+				return float64(n) + 1 - math.Log2(math.Log(cmplx.Abs(w)))
+			}
+			return float64(n)
+		}
+		w = w*w + c
+	}
+	return float64(limit)
+}
+
+func TestIterate(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula  string
+		String   string
+		Expected func(x, y, t float64) float64
+		TUsed    bool
+	}{
+		{
+			Formula:  "0 = iterate(w, 0, w^2 + z, abs(w) > 2, 50)",
+			String:   "0 = iterate(w, 0, w ^ 2 + z, abs(w) > 2, 50)",
+			Expected: func(x, y, t float64) float64 { return mandelbrot(complex(x, y), 50, false) },
+		},
+		{
+			Formula:  "0 = escape(w, 0, w^2 + x + i y, abs(w) > 2, 50)",
+			String:   "0 = escape(w, 0, w ^ 2 + x + i y, abs(w) > 2, 50)",
+			Expected: func(x, y, t float64) float64 { return mandelbrot(complex(x, y), 50, true) },
+		},
+		{
+			Formula: "0 = iterate(w, z, w^2 + 0.7885 exp(i t / 20), abs(w) > 2, 100)",
+			String:  "0 = iterate(w, z, w ^ 2 + 0.7885 exp(i t / 20), abs(w) > 2, 100)",
+			Expected: func(x, y, t float64) float64 {
+				w, c := complex(x, y), 0.7885*cmplx.Exp(complex(0, float64(t)/20))
+				for n := 0; n < 100; n++ {
+					if cmplx.Abs(w) > 2 {
+						return float64(n)
+					}
+					w = w*w + c
+				}
+				return 100
+			},
+			TUsed: true,
+		},
+		{
+			Formula: "0 = iterate(w, x * 100, w / 2, abs(w) < 1, 20)",
+			String:  "0 = iterate(w, x * 100, w / 2, abs(w) < 1, 20)",
+			Expected: func(x, y, t float64) float64 {
+				n := 0.0
+				for w := math.Abs(x * 100); w >= 1 && n < 20; w /= 2 {
+					n++
+				}
+				return n
+			},
+		},
+		{
+			Formula:  "c = 0.25; f(a) = a * a; 0 = iterate(w, 0, f(w) + c, abs(w) > 2, 30)",
+			String:   "c = 0.25; f(a) = a * a; 0 = iterate(w, 0, f(w) + c, abs(w) > 2, 30)",
+			Expected: func(x, y, t float64) float64 { return 30 },
+		},
+		{
+			Formula:  "0 = iterate(w, 0, w + 1, 0, -5) + iterate(w, 0, w + 1, 0, 10000)",
+			String:   "0 = iterate(w, 0, w + 1, 0, -5) + iterate(w, 0, w + 1, 0, 10000)",
+			Expected: func(x, y, t float64) float64 { return maxIterations },
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.String() != each.String {
+				t.Errorf("Got %#v expected %#v", f.String(), each.String)
+			}
+			if _, err := ParseFunctionE(f.Simplify().String()); err != nil {
+				t.Errorf("Reparse failed: %v", err)
+			}
+			for _, p := range [][3]float64{{0.3, 0.5, 7}, {-0.75, 0.1, 1}, {1, 1, 12}, {-1.5, 0, 3}} {
+				got, tUsed, err := f.Evaluate(p[0], p[1], p[2])
+				if err != nil {
+					t.Fatalf("Evaluate failed: %v", err)
+				}
+				if expected := each.Expected(p[0], p[1], p[2]); math.Abs(got-expected) > 1e-9 {
+					t.Errorf("At %v got %v expected %v", p, got, expected)
+				}
+				if tUsed != each.TUsed {
+					t.Errorf("At %v T used %v expected %v", p, tUsed, each.TUsed)
+				}
+			}
+		})
+	}
+}
+
+func TestIterateComplex(t *testing.T) {
+	f, err := ParseComplexFunctionE("0 = iterate(w, 0, w^2 + z, abs(w) > 2, 50)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	for _, z := range []complex128{0, 1 + 1i, -0.75 + 0.1i} {
+		got, _, err := f.EvaluateComplex(z, 0)
+		if err != nil {
+			t.Fatalf("Evaluate failed: %v", err)
+		}
+		if expected := complex(mandelbrot(z, 50, false), 0); got != expected {
+			t.Errorf("At %v got %v expected %v", z, got, expected)
+		}
+	}
+}
+
+func TestIterateErrors(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula string
+		Column  int
+		Reason  string
+	}{
+		{
+			Formula: "y = iterate(x, 0, x^2, abs(x) > 2, 10)",
+			Column:  5,
+			Reason:  "iterate takes a variable, its first value, the next value, when to stop and the most steps",
+		},
+		{
+			Formula: "y = escape(w, 0, w^2 + z, abs(w) > 2)",
+			Column:  5,
+			Reason:  "escape takes a variable, its first value, the next value, when to stop and the most steps",
+		},
+		{
+			Formula: "y = iterate(w, 0, floor(w), w > 2, 10)",
+			Column:  19,
+			Reason:  "floor has no complex version",
+		},
+		{
+			Formula: "y = escape(w, 0, w^2 + z, abs(w) > 2, 1e9)",
+			Column:  5,
+			Reason:  "escape takes at most 10000 steps",
+		},
+		{
+			Formula: "y = iterate(w, w, w^2, abs(w) > 2, 10)",
+			Column:  16,
+			Reason:  "variable w is used before it is defined",
+		},
+		{
+			Formula: "y = z + iterate(w, 0, w^2 + z, abs(w) > 2, 10)",
+			Column:  5,
+			Reason:  "variable z is used before it is defined",
+		},
+		{
+			Formula: "y = d(iterate(w, 0, w^2 + z, abs(w) > 2, 10), x)",
+			Column:  5,
+			Reason:  "iterate has no derivative",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			_, err := ParseFunctionE(each.Formula)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a *ParseError got %#v", err)
+			}
+			if pe.Column != each.Column || pe.Reason != each.Reason {
+				t.Errorf("Got column %d %#v expected column %d %#v", pe.Column, pe.Reason, each.Column, each.Reason)
+			}
+		})
+	}
+}
+
+func TestIterateTooManySteps(t *testing.T) {
+	f, err := ParseFunctionE("0 = iterate(w, 0, w + 1, 0, 1e9 * x)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got, _, err := f.Evaluate(1, 0, 0); err != nil || !math.IsNaN(got) {
+		t.Errorf("Got %v %v expected NaN", got, err)
+	}
+	if got, _, err := f.Evaluate(1e-6, 0, 0); err != nil || got != 1000 {
+		t.Errorf("Got %v %v expected 1000", got, err)
+	}
+}
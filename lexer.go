@@ -1,87 +1,455 @@
 package heatPlot
 
 import (
-	"errors"
+	"fmt"
 	"log"
 	"regexp"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 var (
 	calcLexerRegex *regexp.Regexp
+	// calcLexerOperators maps the operators which are longer than a single character to their token.
+	calcLexerOperators = map[string]int{
+		"<=": LE,
+		">=": GE,
+		"==": EQ,
+		"!=": NE,
+		"&&": AND,
+		"||": OR,
+	}
+	// calcLexerKeywords are the identifiers with their own grammar rather than being a function or a variable.
+	calcLexerKeywords = map[string]int{
+		"IF":        IF,
+		"PIECEWISE": PIECEWISE,
+		"RGB":       COLOUR,
+		"RGBA":      COLOUR,
+	}
+	// calcLexerSymbols are the mathematical symbols formulas are often pasted with, lexed as the token they stand for.
+	calcLexerSymbols = map[rune]int{
+		'×': '*',
+		'·': '*',
+		'÷': '/',
+		'−': '-',
+		'≤': LE,
+		'≥': GE,
+		'≠': NE,
+		'√': ROOT,
+	}
+	// calcLexerSymbolConstants are the constants which can be written as a single symbol.
+	calcLexerSymbolConstants = map[rune]string{
+		'π': "pi",
+		'τ': "tau",
+	}
+	calcLexerSuperscriptRegex = regexp.MustCompile(`^⁻?[⁰¹²³⁴⁵⁶⁷⁸⁹]+`)
+	superscriptDigits         = strings.NewReplacer("⁰", "0", "¹", "1", "²", "2", "³", "3", "⁴", "4", "⁵", "5", "⁶", "6", "⁷", "7", "⁸", "8", "⁹", "9")
 )
 
 func init() {
 	var err error
-	calcLexerRegex, err = regexp.Compile(`^(?:(\s)|([+%=,*^/()-])|(\d+(?:\.\d+)?)|([XxYyTt]\b)|(\w+))`)
+	calcLexerRegex, err = regexp.Compile(`^(?:(\s)|(<=|>=|==|!=|&&|\|\|)|([+%=,*^/()<>!;-])|(0[xX][0-9a-fA-F](?:_?[0-9a-fA-F])*|0[bB][01](?:_?[01])*|(?:\d(?:_?\d)*(?:\.(?:\d(?:_?\d)*)?)?|\.\d(?:_?\d)*)(?:[eE][+-]?\d(?:_?\d)*)?)|([XxYyTtRr]\b|(?i:theta)\b|θ)|(\w+))`)
 	if err != nil {
 		log.Panic("Regex compile issue", err)
 	}
 }
 
 type CalcLexer struct {
-	input string
-	err   error
+	source string
+	input  string
+	pos    int
+	line   int
+	column int
+	tokens []lexedToken
+	result *Function
+	err    error
+	// pending are tokens already lexed to be returned before reading any more input, pendingFloat is the value of
+	// any FLOAT among them.
+	pending      []lexedToken
+	pendingFloat float64
+	// complex is set when the formula is evaluated over complex numbers, see Parser.ParseComplex.
+	complex bool
+	// imageDir is where img reads files from, see Parser.ImageDir.
+	imageDir string
+}
+
+// lexedToken records where a token came from so errors can point back at it. line and column are 1 based, column
+// counts runes.
+type lexedToken struct {
+	char   int
+	offset int
+	line   int
+	column int
+	text   string
 }
 
 func NewCalcLexer(input string) yyLexer {
 	return &CalcLexer{
-		input: input,
+		source: input,
+		input:  input,
+		line:   1,
+		column: 1,
 	}
 }
 
 func (lex *CalcLexer) Lex(lval *yySymType) int {
+	if len(lex.pending) > 0 {
+		token := lex.pending[0]
+		lex.pending = lex.pending[1:]
+		lval.float = lex.pendingFloat
+		lex.tokens = append(lex.tokens, token)
+		return token.char
+	}
 	for {
+		token := lexedToken{offset: lex.pos, line: lex.line, column: lex.column}
 		if len(lex.input) == 0 {
+			lex.tokens = append(lex.tokens, token)
 			return 0
 		}
 		r := lex.subLex(lval)
 		if r == -1 {
 			continue
 		}
+		token.char = r
+		token.text = lex.source[token.offset:lex.pos]
+		lex.tokens = append(lex.tokens, token)
 		return r
 	}
 }
 
+// advance consumes n bytes of input keeping the line and column up to date.
+func (lex *CalcLexer) advance(n int) {
+	for _, r := range lex.input[:n] {
+		if r == '\n' {
+			lex.line++
+			lex.column = 1
+		} else {
+			lex.column++
+		}
+	}
+	lex.input = lex.input[n:]
+	lex.pos += n
+}
+
 func (lex *CalcLexer) subLex(lval *yySymType) int {
-	rResult := calcLexerRegex.FindStringSubmatch(lex.input)
-	defer func() {
-		if len(rResult) <= 1 || len(rResult[0]) == 0 {
-			return
+	if r, n := utf8.DecodeRuneInString(lex.input); r >= utf8.RuneSelf {
+		if char, ok := lex.symbol(lval, r, n); ok {
+			return char
 		}
-		lex.input = lex.input[len(rResult[0]):]
-	}()
+	}
+	if strings.HasPrefix(lex.input, `"`) {
+		return lex.quoted(lval)
+	}
+	rResult := calcLexerRegex.FindStringSubmatch(lex.input)
 	if len(rResult) <= 1 || len(rResult[0]) == 0 {
-		return 1
+		return lex.unknownCharacter()
 	}
+	defer lex.advance(len(rResult[0]))
 	if len(rResult[1]) > 0 {
 		return -1
 	}
 	if len(rResult[2]) > 0 {
-		return int(rune(rResult[2][0]))
+		return calcLexerOperators[rResult[2]]
 	}
 	if len(rResult[3]) > 0 {
+		return int(rune(rResult[3][0]))
+	}
+	if len(rResult[4]) > 0 {
 		var err error
-		lval.float, err = strconv.ParseFloat(rResult[3], 64)
+		lval.float, err = parseNumber(rResult[4])
 		if err != nil {
-			lex.err = err
+			lex.fail(lex.here(len(rResult[4])), fmt.Sprintf("invalid number %q", rResult[4]), "numbers must fit in a 64 bit float and hexadecimal or binary ones in a 64 bit integer")
 			return 1
 		}
 		return FLOAT
 	}
-	if len(rResult[4]) > 0 {
-		lval.s = rResult[4]
-		return VAR
-	}
 	if len(rResult[5]) > 0 {
 		lval.s = rResult[5]
-		return FUNCNAME
+		return VAR
+	}
+	if len(rResult[6]) > 0 {
+		lval.s = rResult[6]
+		if keyword, ok := calcLexerKeywords[strings.ToUpper(rResult[6])]; ok {
+			return keyword
+		}
+		// Whether a function which can be infix is called with its arguments in brackets or written between them is
+		// up to the grammar, by whether an expression comes before it.
+		if lex.infixFunction(rResult[6]) {
+			return INFIXNAME
+		}
+		if strings.HasPrefix(strings.TrimLeft(lex.input[len(rResult[0]):], " \t\r\n"), "(") {
+			return FUNCNAME
+		}
+		if isConstantName(rResult[6]) {
+			return CONSTNAME
+		}
+		if lex.knownFunction(rResult[6]) {
+			return INFIXNAME
+		}
+		return VAR
 	}
 	return 1
 }
 
+// symbol lexes the mathematical symbol r, n bytes long, as the token it stands for. A run of superscript digits such
+// as "²" is a power, it is returned as '^' with the number queued after it.
+func (lex *CalcLexer) symbol(lval *yySymType, r rune, n int) (int, bool) {
+	if superscript := calcLexerSuperscriptRegex.FindString(lex.input); superscript != "" {
+		at := lex.here(len(superscript))
+		digits := strings.TrimPrefix(superscript, "⁻")
+		if len(digits) < len(superscript) {
+			lex.pending = append(lex.pending, lexedToken{char: '-', offset: at.offset, line: at.line, column: at.column, text: "⁻"})
+		}
+		lex.pending = append(lex.pending, lexedToken{char: FLOAT, offset: at.offset, line: at.line, column: at.column, text: digits})
+		var err error
+		if lex.pendingFloat, err = parseNumber(superscriptDigits.Replace(digits)); err != nil {
+			lex.fail(at, fmt.Sprintf("invalid number %q", superscript), "numbers must fit in a 64 bit float")
+		}
+		lex.advance(len(superscript))
+		return '^', true
+	}
+	if char, ok := calcLexerSymbols[r]; ok {
+		lex.advance(n)
+		return char, true
+	}
+	if name, ok := calcLexerSymbolConstants[r]; ok {
+		lval.s = name
+		lex.advance(n)
+		return CONSTNAME, true
+	}
+	return 0, false
+}
+
+// quoted lexes a string in double quotes, with the escapes of a Go string. lval gets it as it was written, quotes and
+// all, see newStringLiteral.
+func (lex *CalcLexer) quoted(lval *yySymType) int {
+	s, err := strconv.QuotedPrefix(lex.input)
+	if err != nil {
+		n := strings.IndexByte(lex.input, '\n')
+		if n < 0 {
+			n = len(lex.input)
+		}
+		lex.fail(lex.here(n), "unterminated string", `close it with a ", a " inside it is written \"`)
+		lex.advance(n)
+		return 1
+	}
+	lval.s = s
+	lex.advance(len(s))
+	return STRING
+}
+
+// parseNumber converts a numeric literal, hexadecimal and binary literals are integers, the rest are decimal floats.
+// Both may use _ between digits.
+func parseNumber(s string) (float64, error) {
+	if len(s) > 1 && s[0] == '0' && strings.ContainsRune("xXbB", rune(s[1])) {
+		i, err := strconv.ParseUint(s, 0, 64)
+		return float64(i), err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// unknownCharacter consumes a character no token starts with and reports it, the parser then sees the unknown token.
+func (lex *CalcLexer) unknownCharacter() int {
+	r, n := utf8.DecodeRuneInString(lex.input)
+	lex.fail(lex.here(n), fmt.Sprintf("unexpected character %q", r), "remove it or replace it with an operator such as + - * / % ^")
+	lex.advance(n)
+	return 1
+}
+
+// here describes the next length bytes of input as a token, for reporting errors about text not yet lexed.
+func (lex *CalcLexer) here(length int) lexedToken {
+	return lexedToken{
+		offset: lex.pos,
+		line:   lex.line,
+		column: lex.column,
+		text:   lex.input[:length],
+	}
+}
+
+// fail records an error at the token unless an earlier error has already been recorded.
+func (lex *CalcLexer) fail(at lexedToken, reason, hint string) {
+	if lex.err != nil {
+		return
+	}
+	lex.err = &ParseError{
+		Input:   lex.source,
+		Offset:  at.offset,
+		Line:    at.line,
+		Column:  at.column,
+		Token:   at.text,
+		Message: "syntax error",
+		Reason:  reason,
+		Hint:    hint,
+	}
+}
+
+// Error records the first syntax error reported by the parser against the most recently lexed token.
 func (lex *CalcLexer) Error(s string) {
-	lex.err = errors.New(s)
+	if lex.err != nil {
+		return
+	}
+	pe := &ParseError{
+		Input:   lex.source,
+		Offset:  lex.pos,
+		Line:    lex.line,
+		Column:  lex.column,
+		Message: s,
+	}
+	if n := len(lex.tokens); n > 0 {
+		last := lex.tokens[n-1]
+		pe.Offset = last.offset
+		pe.Line = last.line
+		pe.Column = last.column
+		pe.Token = last.text
+		chars := make([]int, n)
+		for i, t := range lex.tokens {
+			chars[i] = t.char
+		}
+		pe.Expected = expectedTokens(chars)
+	}
+	pe.Reason, pe.Hint = lex.explain(pe.Expected)
+	lex.err = pe
+}
+
+// explain describes the most recently lexed token in terms of the one before it and suggests a fix.
+func (lex *CalcLexer) explain(expected []string) (reason, hint string) {
+	n := len(lex.tokens)
+	if n == 0 {
+		return "", ""
+	}
+	last := lex.tokens[n-1]
+	reason = "unexpected " + describeToken(last)
+	if n > 1 {
+		reason += " after " + describeToken(lex.tokens[n-2])
+	} else {
+		reason += " at the start of the formula"
+	}
+	open := []lexedToken{}
+	var equals *lexedToken
+	for i, t := range lex.tokens[:n-1] {
+		switch t.char {
+		case '(':
+			open = append(open, t)
+		case ')':
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		case '=':
+			// Only a sum or prod's index has an '=' in brackets.
+			if len(open) == 0 {
+				equals = &lex.tokens[i]
+			}
+		case ';':
+			equals = nil
+		}
+	}
+	// An operand is due at the start and after anything which can't end one, such as an operator, '(' or ','.
+	operandDue := n == 1 || !endsOperand(lex.tokens[n-2])
+	switch {
+	case last.char == ')' && len(open) == 0:
+		hint = "this ')' has no matching '('"
+	case last.char == '=' && equals != nil:
+		hint = fmt.Sprintf("this statement already has an '=' at line %d, column %d, use '==' to compare or ';' to start another statement", equals.line, equals.column)
+	case last.char == '=' && !operandDue:
+		hint = "use '==' to compare"
+	case last.char == 0 && containsString(expected, "')'") && len(open) > 0:
+		hint = fmt.Sprintf("add a ')' to close the '(' at line %d, column %d", open[len(open)-1].line, open[len(open)-1].column)
+	case last.char == 0 && containsString(expected, "'='"):
+		hint = "a formula needs an '=' between two expressions, for example y = x * 2"
+	case operandDue && containsString(expected, "FLOAT"):
+		hint = "expected a number, variable, function call or '(' here"
+	case containsString(expected, "FLOAT"):
+		hint = "expected an operator such as '+', '*' or '<' here"
+	case len(expected) > 0:
+		descriptions := make([]string, len(expected))
+		for i, e := range expected {
+			descriptions[i] = describeTokenName(e)
+		}
+		hint = "expected " + strings.Join(descriptions, ", ")
+	}
+	return reason, hint
+}
+
+// endsOperand reports whether t can be the last token of an operand, after which an operator rather than another
+// operand is due.
+func endsOperand(t lexedToken) bool {
+	switch t.char {
+	case FLOAT, VAR, CONSTNAME, STRING, ')':
+		return true
+	}
+	return false
+}
+
+func describeToken(t lexedToken) string {
+	switch t.char {
+	case 0:
+		return "end of formula"
+	case FLOAT:
+		return "number " + t.text
+	case VAR:
+		return "variable " + t.text
+	case FUNCNAME:
+		return "function " + t.text
+	case INFIXNAME:
+		return "operator " + t.text
+	case CONSTNAME:
+		return "constant " + t.text
+	case IF, PIECEWISE, COLOUR:
+		return t.text
+	case STRING:
+		return "string " + t.text
+	}
+	return fmt.Sprintf("'%s'", t.text)
+}
+
+func describeTokenName(name string) string {
+	switch name {
+	case "$end":
+		return "end of formula"
+	case "FLOAT":
+		return "number"
+	case "VAR":
+		return "variable"
+	case "FUNCNAME":
+		return "function"
+	case "INFIXNAME":
+		return "named operator"
+	case "CONSTNAME":
+		return "constant"
+	case "LE":
+		return "'<='"
+	case "GE":
+		return "'>='"
+	case "EQ":
+		return "'=='"
+	case "NE":
+		return "'!='"
+	case "AND":
+		return "'&&'"
+	case "OR":
+		return "'||'"
+	case "IF":
+		return "if"
+	case "PIECEWISE":
+		return "piecewise"
+	case "COLOUR":
+		return "rgb or rgba"
+	case "ROOT":
+		return "'√'"
+	case "STRING":
+		return "string"
+	}
+	return name
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, e := range haystack {
+		if e == needle {
+			return true
+		}
+	}
+	return false
 }
 
 func yyToknameByString(s string) int {
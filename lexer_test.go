@@ -2,6 +2,7 @@ package heatPlot
 
 import (
 	"fmt"
+	"math"
 	"testing"
 )
 
@@ -35,3 +36,152 @@ func TestLexer(t *testing.T) {
 		})
 	}
 }
+
+func TestLexerPositions(t *testing.T) {
+	lexer := NewCalcLexer("y =\n  sin(x)").(*CalcLexer)
+	for lexer.Lex(&yySymType{}) != 0 {
+	}
+	expected := []lexedToken{
+		{char: VAR, offset: 0, line: 1, column: 1, text: "y"},
+		{char: int(rune('=')), offset: 2, line: 1, column: 3, text: "="},
+		{char: FUNCNAME, offset: 6, line: 2, column: 3, text: "sin"},
+		{char: int(rune('(')), offset: 9, line: 2, column: 6, text: "("},
+		{char: VAR, offset: 10, line: 2, column: 7, text: "x"},
+		{char: int(rune(')')), offset: 11, line: 2, column: 8, text: ")"},
+		{char: 0, offset: 12, line: 2, column: 9, text: ""},
+	}
+	if len(lexer.tokens) != len(expected) {
+		t.Fatalf("Got %d tokens expected %d", len(lexer.tokens), len(expected))
+	}
+	for i, e := range expected {
+		if lexer.tokens[i] != e {
+			t.Errorf("Token %d got %#v expected %#v", i, lexer.tokens[i], e)
+		}
+	}
+}
+
+func TestLexerNumbers(t *testing.T) {
+	for eachI, each := range []struct {
+		Input  string
+		Values []float64
+	}{
+		{Input: "42", Values: []float64{42}},
+		{Input: "3.25", Values: []float64{3.25}},
+		{Input: ".5", Values: []float64{0.5}},
+		{Input: "5.", Values: []float64{5}},
+		{Input: "1e-3", Values: []float64{1e-3}},
+		{Input: "1E3", Values: []float64{1000}},
+		{Input: "2.5e+2", Values: []float64{250}},
+		{Input: ".5e1", Values: []float64{5}},
+		{Input: "5.e1", Values: []float64{50}},
+		{Input: "0xFF", Values: []float64{255}},
+		{Input: "0Xff", Values: []float64{255}},
+		{Input: "0b101", Values: []float64{5}},
+		{Input: "0B11", Values: []float64{3}},
+		{Input: "1_000_000", Values: []float64{1000000}},
+		{Input: "1_000.000_1", Values: []float64{1000.0001}},
+		{Input: "1e1_0", Values: []float64{1e10}},
+		{Input: "0xFF_FF", Values: []float64{65535}},
+		{Input: "0b1111_0000", Values: []float64{240}},
+		{Input: ".5 + 1.", Values: []float64{0.5, 1}},
+		{Input: "1e-3 - .25", Values: []float64{1e-3, 0.25}},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Input), func(t *testing.T) {
+			lexer := NewCalcLexer(each.Input).(*CalcLexer)
+			var values []float64
+			for {
+				lval := &yySymType{}
+				token := lexer.Lex(lval)
+				if token == 0 {
+					break
+				}
+				if token == FLOAT {
+					values = append(values, lval.float)
+				}
+			}
+			if lexer.err != nil {
+				t.Fatalf("Lex failed: %v", lexer.err)
+			}
+			if fmt.Sprint(values) != fmt.Sprint(each.Values) {
+				t.Errorf("Got %v expected %v", values, each.Values)
+			}
+		})
+	}
+}
+
+func TestLexerNumberBoundaries(t *testing.T) {
+	for eachI, each := range []struct {
+		Input  string
+		Output []int
+	}{
+		{Input: "2e", Output: []int{FLOAT, CONSTNAME}},
+		{Input: "2e x", Output: []int{FLOAT, CONSTNAME, VAR}},
+		{Input: "0x", Output: []int{FLOAT, VAR}},
+		{Input: "0b2", Output: []int{FLOAT, VAR}},
+		{Input: "1_", Output: []int{FLOAT, VAR}},
+		{Input: "2x", Output: []int{FLOAT, VAR}},
+		{Input: "1e5x", Output: []int{FLOAT, VAR}},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Input), func(t *testing.T) {
+			yyLexer := NewCalcLexer(each.Input)
+			for i, e := range append(each.Output, 0) {
+				if a := yyLexer.Lex(&yySymType{}); a != e {
+					t.Errorf("Token %d failed, got %d instead expected %d", i, a, e)
+				}
+			}
+		})
+	}
+}
+
+func TestConstStringReparses(t *testing.T) {
+	for _, v := range []float64{0, 1, 0.1, 1.0 / 3, 2.0 / 3, 1e-7, 1e21, 123456789.123456789, 5e-324, 1.7976931348623157e308, 0.000123} {
+		formula := fmt.Sprintf("y = %s", (&Const{Value: v}).String())
+		f, err := ParseFunctionE(formula)
+		if err != nil {
+			t.Errorf("Parse %#v failed: %v", formula, err)
+			continue
+		}
+		if c, ok := f.Equals.RHS.(*Const); !ok || c.Value != v {
+			t.Errorf("%#v parsed to %#v expected %v", formula, f.Equals.RHS, v)
+		}
+	}
+}
+
+func TestLexerUnicode(t *testing.T) {
+	for eachI, each := range []struct {
+		Input    string
+		Expected string
+	}{
+		{Input: "y = 2 × x ÷ 3", Expected: "y = 2 * x / 3"},
+		{Input: "y = 2·x − 1", Expected: "y = 2 * x - 1"},
+		{Input: "y = −x", Expected: "y = -x"},
+		{Input: "y = x²", Expected: "y = x ^ 2"},
+		{Input: "y = x³ + y¹⁰", Expected: "y = x ^ 3 + y ^ 10"},
+		{Input: "y = x⁻¹", Expected: "y = x ^ -1"},
+		{Input: "y = 2x²", Expected: "y = 2 x ^ 2"},
+		{Input: "y = √(x)", Expected: "y = Sqrt(x)"},
+		{Input: "y = √x + √(x + 1)", Expected: "y = Sqrt(x) + Sqrt(x + 1)"},
+		{Input: "y = 3√x", Expected: "y = 3 Sqrt(x)"},
+		{Input: "y = 2π + τ", Expected: "y = 2pi + tau"},
+		{Input: "y = sin(θ)", Expected: "y = sin(θ)"},
+		{Input: "y = x ≤ 1 && x ≥ -1 && x ≠ 0", Expected: "y = x <= 1 && x >= -1 && x != 0"},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Input), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Input)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.String() != each.Expected {
+				t.Errorf("Failed to match %v with %v", f.String(), each.Expected)
+			}
+			explicit := ParseFunction(each.Expected)
+			for _, p := range [][3]float64{{3, 5, 7}, {-1.5, 2, 1}, {0.25, -4, 12}} {
+				got, _, _ := f.Evaluate(p[0], p[1], p[2])
+				expected, _, _ := explicit.Evaluate(p[0], p[1], p[2])
+				if got != expected && !(math.IsNaN(got) && math.IsNaN(expected)) {
+					t.Errorf("At %v got %v expected %v", p, got, expected)
+				}
+			}
+		})
+	}
+}
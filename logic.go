@@ -0,0 +1,364 @@
+package heatPlot
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// truth converts a boolean into the 1 or 0 the rest of the expression tree can compose with.
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// isTrue treats any non zero number as true, NaN is false as it isn't anything.
+func isTrue(f float64) bool {
+	return f != 0 && !math.IsNaN(f)
+}
+
+func maxDepth(es ...Expression) int {
+	d := 0
+	for _, e := range es {
+		if ed := e.Depth(); ed > d {
+			d = ed
+		}
+	}
+	return d + 1
+}
+
+type LessThan struct {
+	LHS Expression
+	RHS Expression
+}
+
+func (v LessThan) Evaluate(state State) float64 {
+	return truth(v.LHS.Evaluate(state) < v.RHS.Evaluate(state))
+}
+
+func (v LessThan) String() string {
+	return fmt.Sprintf("%s < %s", v.LHS.String(), v.RHS.String())
+}
+
+func (v LessThan) Simplify() Expression {
+	v.RHS = v.RHS.Simplify()
+	v.LHS = v.LHS.Simplify()
+	return &v
+}
+
+func (v LessThan) Depth() int {
+	return maxDepth(v.LHS, v.RHS)
+}
+
+type LessOrEqual struct {
+	LHS Expression
+	RHS Expression
+}
+
+func (v LessOrEqual) Evaluate(state State) float64 {
+	return truth(v.LHS.Evaluate(state) <= v.RHS.Evaluate(state))
+}
+
+func (v LessOrEqual) String() string {
+	return fmt.Sprintf("%s <= %s", v.LHS.String(), v.RHS.String())
+}
+
+func (v LessOrEqual) Simplify() Expression {
+	v.RHS = v.RHS.Simplify()
+	v.LHS = v.LHS.Simplify()
+	return &v
+}
+
+func (v LessOrEqual) Depth() int {
+	return maxDepth(v.LHS, v.RHS)
+}
+
+type GreaterThan struct {
+	LHS Expression
+	RHS Expression
+}
+
+func (v GreaterThan) Evaluate(state State) float64 {
+	return truth(v.LHS.Evaluate(state) > v.RHS.Evaluate(state))
+}
+
+func (v GreaterThan) String() string {
+	return fmt.Sprintf("%s > %s", v.LHS.String(), v.RHS.String())
+}
+
+func (v GreaterThan) Simplify() Expression {
+	v.RHS = v.RHS.Simplify()
+	v.LHS = v.LHS.Simplify()
+	return &v
+}
+
+func (v GreaterThan) Depth() int {
+	return maxDepth(v.LHS, v.RHS)
+}
+
+type GreaterOrEqual struct {
+	LHS Expression
+	RHS Expression
+}
+
+func (v GreaterOrEqual) Evaluate(state State) float64 {
+	return truth(v.LHS.Evaluate(state) >= v.RHS.Evaluate(state))
+}
+
+func (v GreaterOrEqual) String() string {
+	return fmt.Sprintf("%s >= %s", v.LHS.String(), v.RHS.String())
+}
+
+func (v GreaterOrEqual) Simplify() Expression {
+	v.RHS = v.RHS.Simplify()
+	v.LHS = v.LHS.Simplify()
+	return &v
+}
+
+func (v GreaterOrEqual) Depth() int {
+	return maxDepth(v.LHS, v.RHS)
+}
+
+// EqualTo is the "==" comparison, not to be confused with Equals which is the "=" at the top of a formula.
+type EqualTo struct {
+	LHS Expression
+	RHS Expression
+}
+
+func (v EqualTo) Evaluate(state State) float64 {
+	return truth(v.LHS.Evaluate(state) == v.RHS.Evaluate(state))
+}
+
+func (v EqualTo) String() string {
+	return fmt.Sprintf("%s == %s", v.LHS.String(), v.RHS.String())
+}
+
+func (v EqualTo) Simplify() Expression {
+	v.RHS = v.RHS.Simplify()
+	v.LHS = v.LHS.Simplify()
+	return &v
+}
+
+func (v EqualTo) Depth() int {
+	return maxDepth(v.LHS, v.RHS)
+}
+
+type NotEqualTo struct {
+	LHS Expression
+	RHS Expression
+}
+
+func (v NotEqualTo) Evaluate(state State) float64 {
+	return truth(v.LHS.Evaluate(state) != v.RHS.Evaluate(state))
+}
+
+func (v NotEqualTo) String() string {
+	return fmt.Sprintf("%s != %s", v.LHS.String(), v.RHS.String())
+}
+
+func (v NotEqualTo) Simplify() Expression {
+	v.RHS = v.RHS.Simplify()
+	v.LHS = v.LHS.Simplify()
+	return &v
+}
+
+func (v NotEqualTo) Depth() int {
+	return maxDepth(v.LHS, v.RHS)
+}
+
+// And short circuits, the RHS isn't evaluated when the LHS is false.
+type And struct {
+	LHS Expression
+	RHS Expression
+}
+
+func (v And) Evaluate(state State) float64 {
+	return truth(isTrue(v.LHS.Evaluate(state)) && isTrue(v.RHS.Evaluate(state)))
+}
+
+func (v And) String() string {
+	return fmt.Sprintf("%s && %s", v.LHS.String(), v.RHS.String())
+}
+
+func (v And) Simplify() Expression {
+	v.RHS = v.RHS.Simplify()
+	v.LHS = v.LHS.Simplify()
+	return &v
+}
+
+func (v And) Depth() int {
+	return maxDepth(v.LHS, v.RHS)
+}
+
+// Or short circuits, the RHS isn't evaluated when the LHS is true.
+type Or struct {
+	LHS Expression
+	RHS Expression
+}
+
+func (v Or) Evaluate(state State) float64 {
+	return truth(isTrue(v.LHS.Evaluate(state)) || isTrue(v.RHS.Evaluate(state)))
+}
+
+func (v Or) String() string {
+	return fmt.Sprintf("%s || %s", v.LHS.String(), v.RHS.String())
+}
+
+func (v Or) Simplify() Expression {
+	v.RHS = v.RHS.Simplify()
+	v.LHS = v.LHS.Simplify()
+	return &v
+}
+
+func (v Or) Depth() int {
+	return maxDepth(v.LHS, v.RHS)
+}
+
+type Not struct {
+	Expr Expression
+}
+
+func (v Not) Evaluate(state State) float64 {
+	return truth(!isTrue(v.Expr.Evaluate(state)))
+}
+
+func (v Not) String() string {
+	return fmt.Sprintf("!%s", v.Expr.String())
+}
+
+func (v Not) Simplify() Expression {
+	// !!!x is !x, but !!x isn't x as it also turns x into a 1 or 0.
+	if child, ok := v.Expr.(*Not); ok {
+		if childChild, ok := child.Expr.(*Not); ok {
+			return childChild.Simplify()
+		}
+	}
+	v.Expr = v.Expr.Simplify()
+	return &v
+}
+
+func (v Not) Depth() int {
+	return v.Expr.Depth() + 1
+}
+
+// If evaluates Then when Condition is true, otherwise Else. Only the chosen branch is evaluated.
+type If struct {
+	Condition Expression
+	Then      Expression
+	Else      Expression
+}
+
+func (v If) Evaluate(state State) float64 {
+	if isTrue(v.Condition.Evaluate(state)) {
+		return v.Then.Evaluate(state)
+	}
+	return v.Else.Evaluate(state)
+}
+
+func (v If) String() string {
+	return fmt.Sprintf("if(%s, %s, %s)", v.Condition.String(), v.Then.String(), v.Else.String())
+}
+
+func (v If) Simplify() Expression {
+	v.Condition = removeBrackets(v.Condition.Simplify())
+	v.Then = removeBrackets(v.Then.Simplify())
+	v.Else = removeBrackets(v.Else.Simplify())
+	// The branch taken replaces the if, so it keeps its brackets unless it is a single operand.
+	if c, ok := v.Condition.(*Const); ok {
+		if isTrue(c.Value) {
+			return bracket(v.Then, 8)
+		}
+		return bracket(v.Else, 8)
+	}
+	return &v
+}
+
+func (v If) Depth() int {
+	return maxDepth(v.Condition, v.Then, v.Else)
+}
+
+// Piecewise evaluates the Value belonging to the first true Condition, or Otherwise when none are true. It is written
+// piecewise(condition1, value1, condition2, value2, ..., otherwise) where otherwise is optional and defaults to 0.
+type Piecewise struct {
+	Conditions []Expression
+	Values     []Expression
+	Otherwise  Expression
+}
+
+// NewPiecewise pairs up the arguments of piecewise(...), a trailing odd argument is the otherwise value.
+func NewPiecewise(args []Expression) *Piecewise {
+	v := &Piecewise{}
+	for i := 0; i+1 < len(args); i += 2 {
+		v.Conditions = append(v.Conditions, args[i])
+		v.Values = append(v.Values, args[i+1])
+	}
+	if len(args)%2 == 1 {
+		v.Otherwise = args[len(args)-1]
+	}
+	return v
+}
+
+func (v Piecewise) Evaluate(state State) float64 {
+	for i, c := range v.Conditions {
+		if isTrue(c.Evaluate(state)) {
+			return v.Values[i].Evaluate(state)
+		}
+	}
+	if v.Otherwise == nil {
+		return 0
+	}
+	return v.Otherwise.Evaluate(state)
+}
+
+func (v Piecewise) String() string {
+	args := make([]string, 0, len(v.Conditions)*2+1)
+	for i, c := range v.Conditions {
+		args = append(args, c.String(), v.Values[i].String())
+	}
+	if v.Otherwise != nil {
+		args = append(args, v.Otherwise.String())
+	}
+	return fmt.Sprintf("piecewise(%s)", strings.Join(args, ", "))
+}
+
+func (v Piecewise) Simplify() Expression {
+	conditions, values := make([]Expression, 0, len(v.Conditions)), make([]Expression, 0, len(v.Values))
+	for i, c := range v.Conditions {
+		c = removeBrackets(c.Simplify())
+		value := removeBrackets(v.Values[i].Simplify())
+		if cc, ok := c.(*Const); ok {
+			if !isTrue(cc.Value) {
+				continue
+			}
+			// Always true, nothing after it can be reached.
+			v.Conditions, v.Values, v.Otherwise = conditions, values, value
+			if len(conditions) == 0 {
+				return bracket(value, 8)
+			}
+			return &v
+		}
+		conditions = append(conditions, c)
+		values = append(values, value)
+	}
+	v.Conditions, v.Values = conditions, values
+	if v.Otherwise != nil {
+		v.Otherwise = removeBrackets(v.Otherwise.Simplify())
+	}
+	if len(v.Conditions) == 0 {
+		if v.Otherwise == nil {
+			return &Const{Value: 0}
+		}
+		return bracket(v.Otherwise, 8)
+	}
+	return &v
+}
+
+func (v Piecewise) Depth() int {
+	es := append(append([]Expression{}, v.Conditions...), v.Values...)
+	if v.Otherwise != nil {
+		es = append(es, v.Otherwise)
+	}
+	return maxDepth(es...)
+}
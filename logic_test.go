@@ -0,0 +1,172 @@
+package heatPlot
+
+import (
+	"fmt"
+	"image"
+	"testing"
+)
+
+func TestLogicEvaluate(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula  string
+		X, Y     float64
+		T        float64
+		Expected float64
+	}{
+		{Formula: "0 = x < y", X: 1, Y: 2, Expected: 1},
+		{Formula: "0 = x < y", X: 2, Y: 2, Expected: 0},
+		{Formula: "0 = x <= y", X: 2, Y: 2, Expected: 1},
+		{Formula: "0 = x > y", X: 3, Y: 2, Expected: 1},
+		{Formula: "0 = x >= y", X: 1, Y: 2, Expected: 0},
+		{Formula: "0 = x == y", X: 2, Y: 2, Expected: 1},
+		{Formula: "0 = x != y", X: 2, Y: 2, Expected: 0},
+		{Formula: "0 = x ^ 2 + y ^ 2 < 100 && t > 10", X: 3, Y: 4, T: 11, Expected: 1},
+		{Formula: "0 = x ^ 2 + y ^ 2 < 100 && t > 10", X: 3, Y: 4, T: 10, Expected: 0},
+		{Formula: "0 = x ^ 2 + y ^ 2 < 100 && t > 10", X: 30, Y: 4, T: 11, Expected: 0},
+		{Formula: "0 = x < 0 || y < 0", X: 1, Y: -1, Expected: 1},
+		{Formula: "0 = x < 0 || y < 0", X: 1, Y: 1, Expected: 0},
+		{Formula: "0 = x < 0 || y < 0 && t > 0", X: -1, Y: 1, Expected: 1},
+		{Formula: "0 = !x", X: 0, Expected: 1},
+		{Formula: "0 = !x", X: 5, Expected: 0},
+		{Formula: "0 = (x > 0) * 5", X: 1, Expected: 5},
+		{Formula: "0 = 2 + (x > 0)", X: -1, Expected: 2},
+		{Formula: "0 = if(x > 0, x, 10)", X: 3, Expected: 3},
+		{Formula: "0 = if(x > 0, x, 10)", X: -3, Expected: 10},
+		{Formula: "0 = piecewise(x < 0, 1, x < 5, 2, 3)", X: -1, Expected: 1},
+		{Formula: "0 = piecewise(x < 0, 1, x < 5, 2, 3)", X: 4, Expected: 2},
+		{Formula: "0 = piecewise(x < 0, 1, x < 5, 2, 3)", X: 6, Expected: 3},
+		{Formula: "0 = piecewise(x < 0, 1)", X: 6, Expected: 0},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.String() != each.Formula {
+				t.Errorf("Failed to match %v with %v", f.String(), each.Formula)
+			}
+			if w, _, _ := f.Evaluate(each.X, each.Y, each.T); w != each.Expected {
+				t.Errorf("Got %v expected %v", w, each.Expected)
+			}
+		})
+	}
+}
+
+func TestLogicSimplify(t *testing.T) {
+	for _, eachTest := range []struct {
+		InputFormula    string
+		ExpectedFormula string
+		ExpectedDepth   int
+	}{
+		{
+			InputFormula:    "y = !!!(x > 1)",
+			ExpectedFormula: "y = !(x > 1)",
+			ExpectedDepth:   7,
+		},
+		{
+			InputFormula:    "y = if(1, (x), y)",
+			ExpectedFormula: "y = x",
+			ExpectedDepth:   4,
+		},
+		{
+			InputFormula:    "y = piecewise(0, 1, x < 1, (2), 1, 3, 4)",
+			ExpectedFormula: "y = piecewise(x < 1, 2, 3)",
+			ExpectedDepth:   4,
+		},
+		{
+			InputFormula:    "y = piecewise(0, 1, (x))",
+			ExpectedFormula: "y = x",
+			ExpectedDepth:   4,
+		},
+		{
+			InputFormula:    "y = 2 * if(1, x + 1, 0)",
+			ExpectedFormula: "y = 2 * (x + 1)",
+			ExpectedDepth:   5,
+		},
+		{
+			InputFormula:    "y = 2 * piecewise(x > 1, 1, 1, -x)",
+			ExpectedFormula: "y = 2 * piecewise(x > 1, 1, -x)",
+			ExpectedDepth:   5,
+		},
+		{
+			InputFormula:    "y = 2 * piecewise(0, 1, 1, -x)",
+			ExpectedFormula: "y = 2 * (-x)",
+			ExpectedDepth:   5,
+		},
+		{
+			InputFormula:    "y = piecewise(0, 5)",
+			ExpectedFormula: "y = 0",
+			ExpectedDepth:   3,
+		},
+	} {
+		f := ParseFunction(eachTest.InputFormula)
+		if f.String() != eachTest.InputFormula {
+			t.Errorf("Control error %#v doesn't match %#v", f.String(), eachTest.InputFormula)
+		}
+		if d := f.Depth(); d != eachTest.ExpectedDepth {
+			t.Errorf("Depth of %#v was %d expected %d", eachTest.InputFormula, d, eachTest.ExpectedDepth)
+		}
+		if outputFormula := f.Simplify().String(); outputFormula != eachTest.ExpectedFormula {
+			t.Errorf("Formula %#v became %#v expected %#v", eachTest.InputFormula, outputFormula, eachTest.ExpectedFormula)
+		}
+	}
+}
+
+// TestLogicSimplifyReparses checks a simplified if or piecewise prints as a formula which parses back to the same
+// values.
+func TestLogicSimplifyReparses(t *testing.T) {
+	for eachI, each := range []string{
+		"y = 2 * if(1, x + 1, 0)",
+		"y = 2 ^ if(0, 1, x * 2)",
+		"y = -if(1, x - 3, 0) ^ 2",
+		"y = x - piecewise(0, 1, 1, x + y)",
+		"y = 3 / piecewise(0, 1, x + 1)",
+		"y = x + piecewise(0, 5)",
+		"y = 2 * piecewise(1, x < 2, 0)",
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each), func(t *testing.T) {
+			f, err := ParseFunctionE(each)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			simplified := f.Simplify()
+			reparsed, err := ParseFunctionE(simplified.String())
+			if err != nil {
+				t.Fatalf("Reparse of %#v failed: %v", simplified.String(), err)
+			}
+			for _, p := range [][3]float64{{3, 5, 7}, {-1.5, 2, 1}, {0.25, -4, 12}} {
+				expected, _, _ := f.Evaluate(p[0], p[1], p[2])
+				got, _, _ := simplified.Evaluate(p[0], p[1], p[2])
+				again, _, _ := reparsed.Evaluate(p[0], p[1], p[2])
+				if got != expected || again != expected {
+					t.Errorf("At %v got %v simplified and %v from %#v expected %v", p, got, again, simplified.String(), expected)
+				}
+			}
+		})
+	}
+}
+
+func TestLogicShortCircuitAnimates(t *testing.T) {
+	size := image.Rect(-2, -2, 2, 2)
+	for _, formula := range []string{
+		"y = x^2 + y^2 < 100 && t > 10",
+		"y = t > 10 && x^2 + y^2 < 100",
+		"y = if(x < 0, t, 0)",
+		"y = piecewise(x < 0, t, 0)",
+		"y = x > 0 || t > 10",
+	} {
+		if tUsed, plots := ParseFunction(formula).Plot(0, 20, 1, size, 1); !tUsed || len(plots) != 20 {
+			t.Errorf("%#v got %d plots T used %v expected 20", formula, len(plots), tUsed)
+		}
+	}
+	if tUsed, plots := ParseFunction("rgb(if(x < 0, t / 20, 0), 0, 0)").PlotColour(0, 20, 1, size, 1); !tUsed || len(plots) != 20 {
+		t.Errorf("Colour got %d plots T used %v expected 20", len(plots), tUsed)
+	}
+	f, err := ParseComplexFunctionE("0 = z + if(x < 0, t, 0)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if tUsed, plots := f.PlotComplex(0, 20, 1, size, 1); !tUsed || len(plots) != 20 {
+		t.Errorf("Complex got %d plots T used %v expected 20", len(plots), tUsed)
+	}
+}
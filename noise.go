@@ -0,0 +1,145 @@
+package heatPlot
+
+import "math"
+
+// NoiseFunctions are seeded like RandomFunctions but take exactly Args arguments, the point to sample the noise at.
+// Unlike rand they vary smoothly from point to point, the features are about 1 apart.
+var NoiseFunctions map[string]NoiseFunction
+
+type NoiseFunction struct {
+	Args  int
+	Noise RandomFunctionDef
+}
+
+// fbmMaxOctaves caps the octaves fbm adds together, past it they are finer than any plot shows.
+const fbmMaxOctaves = 16
+
+// simplexF2 and simplexG2 skew the plane onto the simplex grid and back.
+var (
+	simplexF2 = (math.Sqrt(3) - 1) / 2
+	simplexG2 = (3 - math.Sqrt(3)) / 6
+)
+
+// gradients3 are the edge directions of a cube perlin3 picks its gradients from.
+var gradients3 = [12][3]float64{
+	{1, 1, 0}, {-1, 1, 0}, {1, -1, 0}, {-1, -1, 0},
+	{1, 0, 1}, {-1, 0, 1}, {1, 0, -1}, {-1, 0, -1},
+	{0, 1, 1}, {0, -1, 1}, {0, 1, -1}, {0, -1, -1},
+}
+
+// perlin is perlin(x, y), 2D gradient noise from -1 to 1 which is 0 at every integer point.
+func perlin(seed int64, args ...float64) float64 {
+	return perlin2(seed, args[0], args[1])
+}
+
+func perlin2(seed int64, x, y float64) float64 {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	dx, dy := x-x0, y-y0
+	u, v := fade(dx), fade(dy)
+	n00 := gradient2(seed, x0, y0, dx, dy)
+	n10 := gradient2(seed, x0+1, y0, dx-1, dy)
+	n01 := gradient2(seed, x0, y0+1, dx, dy-1)
+	n11 := gradient2(seed, x0+1, y0+1, dx-1, dy-1)
+	return math.Sqrt2 * lerp(v, lerp(u, n00, n10), lerp(u, n01, n11))
+}
+
+// gradient2 is the dot product of dx, dy with the unit gradient the hash gives the lattice point ix, iy.
+func gradient2(seed int64, ix, iy, dx, dy float64) float64 {
+	a := 2 * math.Pi * unitHash(hashValues(uint64(seed), ix, iy))
+	return math.Cos(a)*dx + math.Sin(a)*dy
+}
+
+// perlin3 is perlin3(x, y, t), 3D gradient noise, so a 2D slice of it changes smoothly with t.
+func perlin3(seed int64, args ...float64) float64 {
+	x, y, z := args[0], args[1], args[2]
+	x0, y0, z0 := math.Floor(x), math.Floor(y), math.Floor(z)
+	dx, dy, dz := x-x0, y-y0, z-z0
+	u, v, w := fade(dx), fade(dy), fade(dz)
+	corner := func(i, j, k float64) float64 {
+		g := gradients3[hashValues(uint64(seed), x0+i, y0+j, z0+k)%uint64(len(gradients3))]
+		return g[0]*(dx-i) + g[1]*(dy-j) + g[2]*(dz-k)
+	}
+	return lerp(w,
+		lerp(v, lerp(u, corner(0, 0, 0), corner(1, 0, 0)), lerp(u, corner(0, 1, 0), corner(1, 1, 0))),
+		lerp(v, lerp(u, corner(0, 0, 1), corner(1, 0, 1)), lerp(u, corner(0, 1, 1), corner(1, 1, 1))),
+	)
+}
+
+// simplex is simplex(x, y), 2D simplex noise from about -1 to 1. It has fewer grid-aligned artifacts than perlin.
+func simplex(seed int64, args ...float64) float64 {
+	x, y := args[0], args[1]
+	s := (x + y) * simplexF2
+	i, j := math.Floor(x+s), math.Floor(y+s)
+	t := (i + j) * simplexG2
+	x0, y0 := x-(i-t), y-(j-t)
+	i1, j1 := 0.0, 1.0
+	if x0 > y0 {
+		i1, j1 = 1, 0
+	}
+	corner := func(ci, cj, dx, dy float64) float64 {
+		t := 0.5 - dx*dx - dy*dy
+		if t < 0 {
+			return 0
+		}
+		t *= t
+		return t * t * gradient2(seed, ci, cj, dx, dy)
+	}
+	n := corner(i, j, x0, y0) +
+		corner(i+i1, j+j1, x0-i1+simplexG2, y0-j1+simplexG2) +
+		corner(i+1, j+1, x0-1+2*simplexG2, y0-1+2*simplexG2)
+	return 99.2 * n
+}
+
+// valueNoise is valuenoise(x, y), random values from -1 to 1 at the integer points smoothly interpolated between.
+func valueNoise(seed int64, args ...float64) float64 {
+	x, y := args[0], args[1]
+	x0, y0 := math.Floor(x), math.Floor(y)
+	u, v := fade(x-x0), fade(y-y0)
+	corner := func(ix, iy float64) float64 {
+		return 2*unitHash(hashValues(uint64(seed), ix, iy)) - 1
+	}
+	return lerp(v, lerp(u, corner(x0, y0), corner(x0+1, y0)), lerp(u, corner(x0, y0+1), corner(x0+1, y0+1)))
+}
+
+// worley is worley(x, y), the distance to the nearest of a set of points scattered one to each unit square, 0 at the
+// points themselves and rarely more than 1.
+func worley(seed int64, args ...float64) float64 {
+	x, y := args[0], args[1]
+	x0, y0 := math.Floor(x), math.Floor(y)
+	nearest := math.Inf(1)
+	// A point two squares away can still be nearer than the one in x, y's own square, but not three.
+	for i := -2.0; i <= 2; i++ {
+		for j := -2.0; j <= 2; j++ {
+			h := hashValues(uint64(seed), x0+i, y0+j)
+			px, py := x0+i+unitHash(h), y0+j+unitHash(splitMix(h))
+			nearest = math.Min(nearest, math.Hypot(px-x, py-y))
+		}
+	}
+	return nearest
+}
+
+// fbm is fbm(x, y, octaves), fractional Brownian motion: octaves layers of perlin, each at twice the frequency and
+// half the amplitude of the one before, scaled back to -1 to 1. Octaves is rounded down and kept from 1 to 16.
+func fbm(seed int64, args ...float64) float64 {
+	x, y, octaves := args[0], args[1], math.Floor(args[2])
+	if !(octaves >= 1) {
+		octaves = 1
+	}
+	octaves = math.Min(octaves, fbmMaxOctaves)
+	sum, total, amplitude := 0.0, 0.0, 1.0
+	for i := 0; i < int(octaves); i++ {
+		sum += amplitude * perlin2(seed+int64(i), x, y)
+		total += amplitude
+		x, y, amplitude = x*2, y*2, amplitude/2
+	}
+	return sum / total
+}
+
+// fade is Perlin's quintic smoothstep, its first and second derivatives are 0 at 0 and 1 so the noise has no creases.
+func fade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func lerp(t, a, b float64) float64 {
+	return a + t*(b-a)
+}
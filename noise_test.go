@@ -0,0 +1,107 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// TestNoiseReferenceValues pins the noise functions down so plots drawn with them don't change between releases.
+func TestNoiseReferenceValues(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula  string
+		Seed     int64
+		Expected float64
+	}{
+		{Formula: "0 = perlin(0.5, 0.5)", Seed: 0, Expected: -0.099239267375690124},
+		{Formula: "0 = perlin(1.25, -3.7)", Seed: 0, Expected: 0.46638739983198702},
+		{Formula: "0 = perlin(1.25, -3.7)", Seed: 42, Expected: -0.28149104040726486},
+		{Formula: "0 = perlin(2, 5)", Seed: 0, Expected: 0},
+		{Formula: "0 = perlin3(0.5, 0.5, 0.5)", Seed: 0, Expected: 0.125},
+		{Formula: "0 = perlin3(-1.3, 2.9, 10)", Seed: 7, Expected: -0.21223849151999993},
+		{Formula: "0 = simplex(0.3, 0.7)", Seed: 0, Expected: -0.71927046653547666},
+		{Formula: "0 = simplex(-4.2, 1.1)", Seed: 9, Expected: 0.55572155897999231},
+		{Formula: "0 = valuenoise(0.5, 0.5)", Seed: 0, Expected: 0.060739828429017317},
+		{Formula: "0 = valuenoise(3, 4)", Seed: 0, Expected: -0.76636316704390994},
+		{Formula: "0 = valuenoise(-2.6, 0.1)", Seed: 3, Expected: 0.22914156803833124},
+		{Formula: "0 = worley(0.5, 0.5)", Seed: 0, Expected: 0.51739081781758534},
+		{Formula: "0 = worley(-7.25, 3.5)", Seed: 5, Expected: 0.43738695647726133},
+		{Formula: "0 = fbm(0.3, 0.7, 1)", Seed: 0, Expected: -0.29961094578486219},
+		{Formula: "0 = fbm(0.3, 0.7, 4)", Seed: 0, Expected: 0.015957628879626946},
+		{Formula: "0 = fbm(-5.5, 2.25, 6)", Seed: 2, Expected: 0.3608113623102468},
+	} {
+		t.Run(fmt.Sprintf("%d: %s seed %d", eachI, each.Formula, each.Seed), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			f.Seed = each.Seed
+			v, _, err := f.Evaluate(0, 0, 0)
+			if err != nil {
+				t.Fatalf("Evaluate failed: %v", err)
+			}
+			if math.Abs(v-each.Expected) > 1e-12 {
+				t.Errorf("Got %.17g expected %.17g", v, each.Expected)
+			}
+		})
+	}
+}
+
+func TestNoiseProperties(t *testing.T) {
+	for _, name := range []string{"PERLIN", "PERLIN3", "SIMPLEX", "VALUENOISE", "WORLEY", "FBM"} {
+		f := NoiseFunctions[name]
+		args := func(x, y float64) []float64 {
+			return []float64{x, y, 3}[:f.Args]
+		}
+		for i := 0; i < 1000; i++ {
+			x, y := float64(i%37)*0.173-3, float64(i/37)*0.291-4
+			v := f.Noise(1, args(x, y)...)
+			if math.IsNaN(v) || v < -1 || v > 1.5 {
+				t.Fatalf("%s(%v, %v) = %v is out of range", name, x, y, v)
+			}
+			if d := math.Abs(f.Noise(1, args(x+1e-6, y)...) - v); d > 1e-4 {
+				t.Fatalf("%s jumps by %v between %v and %v", name, d, x, x+1e-6)
+			}
+		}
+	}
+	if a, b := fbm(4, 1.3, 2.7, 1), perlin(4, 1.3, 2.7); a != b {
+		t.Errorf("fbm with 1 octave gave %v but perlin gave %v", a, b)
+	}
+	if a, b := fbm(4, 1.3, 2.7, 100), fbm(4, 1.3, 2.7, fbmMaxOctaves); a != b {
+		t.Errorf("fbm with 100 octaves gave %v but %d gave %v", a, fbmMaxOctaves, b)
+	}
+	if a, b := perlin(1, 1.3, 2.7), perlin(2, 1.3, 2.7); a == b {
+		t.Errorf("Seeds 1 and 2 both gave %v", a)
+	}
+}
+
+func TestNoiseErrors(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula string
+		Column  int
+		Reason  string
+	}{
+		{
+			Formula: "y = perlin(x)",
+			Column:  5,
+			Reason:  "perlin takes 2 arguments but was given 1",
+		},
+		{
+			Formula: "y = fbm(x, y)",
+			Column:  5,
+			Reason:  "fbm takes 3 arguments but was given 2",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			_, err := ParseFunctionE(each.Formula)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a *ParseError got %#v", err)
+			}
+			if pe.Column != each.Column || pe.Reason != each.Reason {
+				t.Errorf("Got column %d %#v expected column %d %#v", pe.Column, pe.Reason, each.Column, each.Reason)
+			}
+		})
+	}
+}
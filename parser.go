@@ -0,0 +1,207 @@
+package heatPlot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Parser turns formula text into a Function. Unlike the package level yyParse it keeps all of its state on the
+// instance, so each goroutine can use its own Parser without coordinating with others.
+type Parser struct {
+	parser yyParser
+	// ImageDir is the directory img reads its files from, their names being relative to it. Names leading outside it,
+	// including through a symbolic link, are errors, and img can't be used at all when it is empty, so a formula from
+	// anyone can only read the images it was meant to.
+	ImageDir string
+}
+
+// ParseError describes why a formula could not be parsed. Offset is in bytes, Line and Column are 1 based and Column
+// counts runes.
+type ParseError struct {
+	Input    string
+	Offset   int
+	Line     int
+	Column   int
+	Token    string
+	Expected []string
+	Message  string
+	Reason   string
+	Hint     string
+}
+
+func (e *ParseError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("%s at line %d, column %d: %s", e.Message, e.Line, e.Column, e.Reason)
+	}
+	token := e.Token
+	if token == "" {
+		token = "end of formula"
+	} else {
+		token = fmt.Sprintf("%q", token)
+	}
+	msg := fmt.Sprintf("%s at offset %d near %s", e.Message, e.Offset, token)
+	if len(e.Expected) > 0 {
+		msg += ", expecting " + strings.Join(e.Expected, " or ")
+	}
+	return msg
+}
+
+// Diagnostic renders the error for people: the message, the offending line of the formula with a caret under the
+// problem and a hint on how to fix it when there is one.
+func (e *ParseError) Diagnostic() string {
+	b := &strings.Builder{}
+	b.WriteString(e.Error())
+	b.WriteString("\n")
+	lines := strings.Split(e.Input, "\n")
+	if e.Line >= 1 && e.Line <= len(lines) {
+		line := lines[e.Line-1]
+		b.WriteString("    ")
+		b.WriteString(line)
+		b.WriteString("\n    ")
+		for i, r := range []rune(line) {
+			if i >= e.Column-1 {
+				break
+			}
+			if r == '\t' {
+				b.WriteRune('\t')
+			} else {
+				b.WriteRune(' ')
+			}
+		}
+		b.WriteString("^\n")
+	}
+	if e.Hint != "" {
+		b.WriteString("hint: ")
+		b.WriteString(e.Hint)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func NewParser() *Parser {
+	return &Parser{
+		parser: yyNewParser(),
+	}
+}
+
+func (p *Parser) Parse(formula string) (*Function, error) {
+	return p.parse(NewCalcLexer(formula).(*CalcLexer))
+}
+
+// ParseComplex parses a formula to be evaluated with EvaluateComplex, where z is x + iy and i is the imaginary unit.
+// It can end by declaring the function to plot, as in "f(z) = (z^2 - 1) / (z^2 + 1)". Parts of the formula which
+// have no complex meaning, such as % or floor, are errors.
+func (p *Parser) ParseComplex(formula string) (*Function, error) {
+	lex := NewCalcLexer(formula).(*CalcLexer)
+	lex.complex = true
+	return p.parse(lex)
+}
+
+func (p *Parser) parse(lex *CalcLexer) (*Function, error) {
+	formula := lex.source
+	lex.imageDir = p.ImageDir
+	r := p.parser.Parse(lex)
+	if lex.err != nil {
+		return nil, lex.err
+	}
+	if r != 0 || lex.result == nil {
+		return nil, &ParseError{
+			Input:   formula,
+			Offset:  lex.pos,
+			Line:    lex.line,
+			Column:  lex.column,
+			Message: "invalid formula",
+		}
+	}
+	return lex.result, nil
+}
+
+// ParseFunctionE parses a formula and returns a *ParseError rather than panicking when it is invalid.
+func ParseFunctionE(formula string) (*Function, error) {
+	return NewParser().Parse(formula)
+}
+
+// ParseComplexFunctionE is ParseFunctionE for formulas evaluated over complex numbers, see Parser.ParseComplex.
+func ParseComplexFunctionE(formula string) (*Function, error) {
+	return NewParser().ParseComplex(formula)
+}
+
+type tokenLexer int
+
+func (t tokenLexer) Lex(lval *yySymType) int {
+	return int(t)
+}
+
+func (t tokenLexer) Error(s string) {}
+
+// expectedTokens replays the lexed characters through the goyacc tables and returns the names of every token which
+// could have been accepted in place of the final one.
+func expectedTokens(chars []int) []string {
+	if len(chars) == 0 {
+		return nil
+	}
+	tokens := make([]int, len(chars))
+	for i, c := range chars {
+		_, tokens[i] = yylex1(tokenLexer(c), &yySymType{})
+	}
+	prefix := tokens[:len(tokens)-1]
+	var result []string
+	for tok := 1; tok-1 < len(yyToknames); tok++ {
+		if tok == yyErrCode || yyTokname(tok) == "$unk" {
+			continue
+		}
+		if tableAccepts(prefix, tok) {
+			result = append(result, yyTokname(tok))
+		}
+	}
+	return result
+}
+
+// tableAccepts reports whether the parser tables would shift (or accept) next after consuming prefix.
+func tableAccepts(prefix []int, next int) bool {
+	stack := []int{0}
+	input := append(append([]int{}, prefix...), next)
+	for i := 0; i < len(input); {
+		state := stack[len(stack)-1]
+		tok := input[i]
+		if n := int(yyPact[state]); n > yyFlag {
+			if n += tok; n >= 0 && n < yyLast {
+				if s := int(yyAct[n]); int(yyChk[s]) == tok {
+					stack = append(stack, s)
+					i++
+					continue
+				}
+			}
+		}
+		n := int(yyDef[state])
+		if n == -2 {
+			xi := 0
+			for int(yyExca[xi]) != -1 || int(yyExca[xi+1]) != state {
+				xi += 2
+			}
+			for xi += 2; ; xi += 2 {
+				if n = int(yyExca[xi]); n < 0 || n == tok {
+					break
+				}
+			}
+			if n = int(yyExca[xi+1]); n < 0 {
+				return i == len(input)-1
+			}
+		}
+		if n == 0 {
+			return false
+		}
+		stack = stack[:len(stack)-int(yyR2[n])]
+		lhs := int(yyR1[n])
+		g := int(yyPgo[lhs])
+		j := g + stack[len(stack)-1] + 1
+		next := int(yyAct[g])
+		if j < yyLast {
+			if s := int(yyAct[j]); int(yyChk[s]) == -lhs {
+				next = s
+			}
+		}
+		stack = append(stack, next)
+	}
+	return true
+}
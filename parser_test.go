@@ -0,0 +1,187 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestParseFunctionE(t *testing.T) {
+	for eachI, each := range []struct {
+		Input    string
+		Offset   int
+		Token    string
+		Expected []string
+	}{
+		{
+			Input:    "y = x +",
+			Offset:   7,
+			Token:    "",
+			Expected: []string{"FLOAT", "VAR", "FUNCNAME", "INFIXNAME", "CONSTNAME", "STRING", "IF", "PIECEWISE", "ROOT", "'+'", "'-'", "'('", "'!'"},
+		},
+		{
+			Input:    "y = (x + 1",
+			Offset:   10,
+			Token:    "",
+			Expected: []string{"FLOAT", "VAR", "FUNCNAME", "INFIXNAME", "CONSTNAME", "STRING", "LE", "GE", "EQ", "NE", "AND", "OR", "IF", "PIECEWISE", "ROOT", "'<'", "'>'", "'+'", "'-'", "'*'", "'/'", "'%'", "'('", "'^'", "')'"},
+		},
+		{
+			Input:    "y = x + )",
+			Offset:   8,
+			Token:    ")",
+			Expected: []string{"FLOAT", "VAR", "FUNCNAME", "INFIXNAME", "CONSTNAME", "STRING", "IF", "PIECEWISE", "ROOT", "'+'", "'-'", "'('", "'!'"},
+		},
+		{
+			Input:    "y x",
+			Offset:   3,
+			Token:    "",
+			Expected: []string{"FLOAT", "VAR", "FUNCNAME", "INFIXNAME", "CONSTNAME", "STRING", "LE", "GE", "EQ", "NE", "AND", "OR", "IF", "PIECEWISE", "ROOT", "'='", "'<'", "'>'", "'+'", "'-'", "'*'", "'/'", "'%'", "'('", "'^'"},
+		},
+		{
+			Input:    "y = x = 2",
+			Offset:   6,
+			Token:    "=",
+			Expected: []string{"$end", "FLOAT", "VAR", "FUNCNAME", "INFIXNAME", "CONSTNAME", "STRING", "LE", "GE", "EQ", "NE", "AND", "OR", "IF", "PIECEWISE", "ROOT", "'<'", "'>'", "'+'", "'-'", "'*'", "'/'", "'%'", "'('", "'^'", "';'"},
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Input), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Input)
+			if f != nil {
+				t.Errorf("Expected no function got %s", f)
+			}
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a *ParseError got %#v", err)
+			}
+			if pe.Offset != each.Offset {
+				t.Errorf("Offset %d expected %d", pe.Offset, each.Offset)
+			}
+			if pe.Token != each.Token {
+				t.Errorf("Token %q expected %q", pe.Token, each.Token)
+			}
+			if !reflect.DeepEqual(pe.Expected, each.Expected) {
+				t.Errorf("Expected tokens %#v expected %#v", pe.Expected, each.Expected)
+			}
+		})
+	}
+}
+
+func TestParserConcurrent(t *testing.T) {
+	formulas := []string{
+		"y / 4 = x + 2",
+		"y = x * sin(t / 10)",
+		"y = sin(x / 10) + cos(y / 10) * sin(t / 10)",
+		"y = mod(x, 3) * 2",
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			parser := NewParser()
+			for j := 0; j < 20; j++ {
+				formula := formulas[(i+j)%len(formulas)]
+				f, err := parser.Parse(formula)
+				if err != nil {
+					t.Errorf("Parse %#v failed: %v", formula, err)
+					return
+				}
+				if f.String() != formula {
+					t.Errorf("Got %#v expected %#v", f.String(), formula)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestParseErrorDiagnostic(t *testing.T) {
+	for eachI, each := range []struct {
+		Input      string
+		Diagnostic string
+	}{
+		{
+			Input: "y = (x + )",
+			Diagnostic: "syntax error at line 1, column 10: unexpected ')' after '+'\n" +
+				"    y = (x + )\n" +
+				"             ^\n" +
+				"hint: expected a number, variable, function call or '(' here\n",
+		},
+		{
+			Input: "y = x + 1)",
+			Diagnostic: "syntax error at line 1, column 10: unexpected ')' after number 1\n" +
+				"    y = x + 1)\n" +
+				"             ^\n" +
+				"hint: this ')' has no matching '('\n",
+		},
+		{
+			Input: "y = sin(x\n + 1",
+			Diagnostic: "syntax error at line 2, column 5: unexpected end of formula after number 1\n" +
+				"     + 1\n" +
+				"        ^\n" +
+				"hint: add a ')' to close the '(' at line 1, column 8\n",
+		},
+		{
+			Input: "y = x $ 2",
+			Diagnostic: "syntax error at line 1, column 7: unexpected character '$'\n" +
+				"    y = x $ 2\n" +
+				"          ^\n" +
+				"hint: remove it or replace it with an operator such as + - * / % ^\n",
+		},
+		{
+			Input: "x * 2",
+			Diagnostic: "syntax error at line 1, column 6: unexpected end of formula after number 2\n" +
+				"    x * 2\n" +
+				"         ^\n" +
+				"hint: a formula needs an '=' between two expressions, for example y = x * 2\n",
+		},
+		{
+			Input: "y = x = 2",
+			Diagnostic: "syntax error at line 1, column 7: unexpected '=' after variable x\n" +
+				"    y = x = 2\n" +
+				"          ^\n" +
+				"hint: this statement already has an '=' at line 1, column 3, use '==' to compare or ';' to start another statement\n",
+		},
+		{
+			Input: "y = sum(k = 1, 3, k) = 2",
+			Diagnostic: "syntax error at line 1, column 22: unexpected '=' after ')'\n" +
+				"    y = sum(k = 1, 3, k) = 2\n" +
+				"                         ^\n" +
+				"hint: this statement already has an '=' at line 1, column 3, use '==' to compare or ';' to start another statement\n",
+		},
+		{
+			Input: "y = (x = 2)",
+			Diagnostic: "syntax error at line 1, column 8: unexpected '=' after variable x\n" +
+				"    y = (x = 2)\n" +
+				"           ^\n" +
+				"hint: this statement already has an '=' at line 1, column 3, use '==' to compare or ';' to start another statement\n",
+		},
+		{
+			Input: "0 < (x = 2)",
+			Diagnostic: "syntax error at line 1, column 8: unexpected '=' after variable x\n" +
+				"    0 < (x = 2)\n" +
+				"           ^\n" +
+				"hint: use '==' to compare\n",
+		},
+		{
+			Input: "y = x, 2",
+			Diagnostic: "syntax error at line 1, column 6: unexpected ',' after variable x\n" +
+				"    y = x, 2\n" +
+				"         ^\n" +
+				"hint: expected an operator such as '+', '*' or '<' here\n",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Input), func(t *testing.T) {
+			_, err := ParseFunctionE(each.Input)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a *ParseError got %#v", err)
+			}
+			if d := pe.Diagnostic(); d != each.Diagnostic {
+				t.Errorf("Got diagnostic:\n%s\nExpected:\n%s", d, each.Diagnostic)
+			}
+		})
+	}
+}
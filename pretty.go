@@ -0,0 +1,78 @@
+package heatPlot
+
+import "strings"
+
+var (
+	// prettySymbols are the tokens Pretty writes as a mathematical symbol.
+	prettySymbols = map[int]string{
+		'*': "×",
+		'/': "÷",
+		'-': "−",
+		LE:  "≤",
+		GE:  "≥",
+		NE:  "≠",
+	}
+	// prettyNames are the constants, variables and functions Pretty writes as a symbol, keyed by upper case name.
+	prettyNames = map[string]string{
+		"PI":    "π",
+		"TAU":   "τ",
+		"THETA": "θ",
+		"SQRT":  "√",
+	}
+	prettySuperscripts = map[string]string{
+		"2": "²",
+		"3": "³",
+	}
+)
+
+// Pretty is String written with mathematical notation, "×" for "*", "√(x)" for "sqrt(x)", "x²" for "x ^ 2" and so on,
+// for display such as the header drawn by AddHeaderAndFooter. It still parses back to the same formula.
+func (v Function) Pretty() string {
+	return prettyFormula(v.String())
+}
+
+// Heading is the formula as it is drawn above each frame, Pretty when PrettyHeading is set and String otherwise.
+func (v Function) Heading() string {
+	if v.PrettyHeading {
+		return v.Pretty()
+	}
+	return v.String()
+}
+
+// prettyFormula rewrites the tokens of formula which have a mathematical symbol, leaving the spacing between them
+// alone. Only squares and cubes are written as superscripts, the other superscript digits are missing from most fonts.
+func prettyFormula(formula string) string {
+	lex := NewCalcLexer(formula).(*CalcLexer)
+	for lex.Lex(&yySymType{}) != 0 {
+	}
+	if lex.err != nil {
+		return formula
+	}
+	tokens := lex.tokens
+	b := &strings.Builder{}
+	written := 0
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		gap, text, end := formula[written:t.offset], t.text, t.offset+len(t.text)
+		switch t.char {
+		case '*', '/', '-', LE, GE, NE:
+			text = prettySymbols[t.char]
+		case CONSTNAME, VAR, FUNCNAME:
+			if symbol, ok := prettyNames[strings.ToUpper(t.text)]; ok && (t.char != FUNCNAME || symbol == "√") {
+				text = symbol
+			}
+		case '^':
+			if i+1 >= len(tokens) || tokens[i+1].char != FLOAT || i+2 < len(tokens) && tokens[i+2].char == '^' {
+				break
+			}
+			if superscript, ok := prettySuperscripts[tokens[i+1].text]; ok {
+				i++
+				gap, text, end = "", superscript, tokens[i].offset+len(tokens[i].text)
+			}
+		}
+		b.WriteString(gap)
+		b.WriteString(text)
+		written = end
+	}
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package heatPlot
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPretty(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula  string
+		Expected string
+	}{
+		{Formula: "y = 2 * x / 3 - 1", Expected: "y = 2 × x ÷ 3 − 1"},
+		{Formula: "y = x ^ 2 + y ^ 3 - t ^ 4", Expected: "y = x² + y³ − t ^ 4"},
+		{Formula: "y = (x + 1) ^ 2 * 2", Expected: "y = (x + 1)² × 2"},
+		{Formula: "y = x ^ 2 ^ 3", Expected: "y = x ^ 2³"},
+		{Formula: "y = x ^ 2.5", Expected: "y = x ^ 2.5"},
+		{Formula: "y = sqrt(x) + Sqrt(2pi)", Expected: "y = √(x) + √(2π)"},
+		{Formula: "y = theta * tau", Expected: "y = θ × τ"},
+		{Formula: "y = x <= 1 && x >= -1 && x != 0", Expected: "y = x ≤ 1 && x ≥ −1 && x ≠ 0"},
+		{Formula: "sq(a) = a ^ 2; k = sq(x); y = k / 2", Expected: "sq(a) = a²; k = sq(x); y = k ÷ 2"},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.Pretty() != each.Expected {
+				t.Errorf("Failed to match %v with %v", f.Pretty(), each.Expected)
+			}
+			reparsed, err := ParseFunctionE(f.Pretty())
+			if err != nil {
+				t.Fatalf("Reparse failed: %v", err)
+			}
+			if reparsed.Pretty() != f.Pretty() {
+				t.Errorf("Pretty form reparsed as %v expected %v", reparsed.Pretty(), f.Pretty())
+			}
+		})
+	}
+}
+
+func TestPrettySymbolsInFont(t *testing.T) {
+	var symbols []string
+	for _, s := range prettySymbols {
+		symbols = append(symbols, s)
+	}
+	for _, s := range prettyNames {
+		symbols = append(symbols, s)
+	}
+	for _, s := range prettySuperscripts {
+		symbols = append(symbols, s)
+	}
+	for _, s := range symbols {
+		for _, r := range s {
+			if goregularfnt.Index(r) == 0 {
+				t.Errorf("The header font has no glyph for %q", r)
+			}
+		}
+	}
+}
+
+func TestHeading(t *testing.T) {
+	f, err := ParseFunctionE("y = x ^ 2 * 2")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if h := f.Heading(); h != "y = x ^ 2 * 2" {
+		t.Errorf("Got %#v expected the plain formula", h)
+	}
+	f.PrettyHeading = true
+	if h := f.Heading(); h != "y = x² × 2" {
+		t.Errorf("Got %#v expected the pretty formula", h)
+	}
+	if r := (&FormulaRule{Function: f}).String(); r != "y = x² × 2" {
+		t.Errorf("Got rule %#v expected the pretty formula", r)
+	}
+}
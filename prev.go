@@ -0,0 +1,189 @@
+package heatPlot
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+)
+
+// Boundary is what prev reads beyond the edges of the previous frame.
+type Boundary int
+
+const (
+	// BoundaryClamp reads the nearest pixel on the edge.
+	BoundaryClamp Boundary = iota
+	// BoundaryWrap reads from the opposite edge, as if the plot were tiled.
+	BoundaryWrap
+	// BoundaryZero reads 0.
+	BoundaryZero
+)
+
+var boundaryNames = []string{"clamp", "wrap", "zero"}
+
+func (b Boundary) String() string {
+	if b < 0 || int(b) >= len(boundaryNames) {
+		return fmt.Sprintf("Boundary(%d)", int(b))
+	}
+	return boundaryNames[b]
+}
+
+// ParseBoundary returns the Boundary named clamp, wrap or zero.
+func ParseBoundary(name string) (Boundary, error) {
+	for i, n := range boundaryNames {
+		if strings.EqualFold(name, n) {
+			return Boundary(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown boundary %q, use one of %s", name, strings.Join(boundaryNames, ", "))
+}
+
+// At is Get for any pixel, those outside the plot are read as boundary says.
+func (plot *Plot) At(x, y int, boundary Boundary) float64 {
+	p, ok := boundary.point(image.Pt(x, y), plot.Size)
+	if !ok {
+		return 0
+	}
+	return plot.Get(p.X, p.Y)
+}
+
+// point is the pixel inside size read in place of p, which is false when it reads 0.
+func (b Boundary) point(p image.Point, size image.Rectangle) (image.Point, bool) {
+	if size.Empty() {
+		return p, false
+	}
+	if p.In(size) {
+		return p, true
+	}
+	switch b {
+	case BoundaryZero:
+		return p, false
+	case BoundaryWrap:
+		return image.Pt(size.Min.X+wrap(p.X-size.Min.X, size.Dx()), size.Min.Y+wrap(p.Y-size.Min.Y, size.Dy())), true
+	}
+	return image.Pt(clamp(p.X, size.Min.X, size.Max.X-1), clamp(p.Y, size.Min.Y, size.Max.Y-1)), true
+}
+
+// wrap is i modulo n, from 0 up to n even when i is negative.
+func wrap(i, n int) int {
+	if i %= n; i < 0 {
+		i += n
+	}
+	return i
+}
+
+func clamp(i, min, max int) int {
+	if i < min {
+		return min
+	}
+	if i > max {
+		return max
+	}
+	return i
+}
+
+// Prev is prev(dx, dy), the weight of the previous frame dx pixels to the right and dy pixels above the one being
+// worked out, or prev() for the same pixel. It lets a formula be a simulation, as in the heat diffusion
+// "prev = exp(-(x^2 + y^2)); 0 = (prev(1, 0) + prev(-1, 0) + prev(0, 1) + prev(0, -1)) / 4". prev on its own is a
+// Var, the same as prev(). The offsets are rounded to whole pixels.
+type Prev struct {
+	// Args are empty or dx and dy.
+	Args []Expression
+}
+
+func (v Prev) Evaluate(state State) float64 {
+	if len(v.Args) != 2 {
+		return state.Prev(0, 0)
+	}
+	dx, dy := math.Round(v.Args[0].Evaluate(state)), math.Round(v.Args[1].Evaluate(state))
+	if math.IsNaN(dx) || math.IsNaN(dy) || math.Abs(dx) > math.MaxInt32 || math.Abs(dy) > math.MaxInt32 {
+		return math.NaN()
+	}
+	return state.Prev(int(dx), int(dy))
+}
+
+func (v Prev) String() string {
+	args := make([]string, len(v.Args))
+	for i, arg := range v.Args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("prev(%s)", strings.Join(args, ", "))
+}
+
+func (v Prev) Simplify() Expression {
+	args := make([]Expression, len(v.Args))
+	for i, arg := range v.Args {
+		args[i] = removeBrackets(arg.Simplify())
+	}
+	v.Args = args
+	return &v
+}
+
+func (v Prev) Depth() int {
+	return maxDepth(v.Args...)
+}
+
+// isPrevVar reports whether name is prev, which reads the previous frame when used as a variable.
+func isPrevVar(name string) bool {
+	return strings.EqualFold(name, "prev")
+}
+
+// usesPrev reports whether e reads the previous frame, directly or through a function it calls.
+func usesPrev(e Expression) bool {
+	switch e := e.(type) {
+	case *Prev, *Neighbourhood:
+		return true
+	case *Var:
+		return isPrevVar(e.Var)
+	case *UserFunctionCall:
+		if usesPrev(e.Function.Body) {
+			return true
+		}
+	}
+	for _, child := range children(e) {
+		if usesPrev(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// bindingsUsePrev reports whether any of the Bindings read the previous frame.
+func (function *Function) bindingsUsePrev() bool {
+	for _, b := range function.Bindings {
+		if usesPrev(b.Expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// initialPlot is what prev reads in the first frame, the initial condition given by "prev = ..." plotted at t, or nil
+// when there isn't one and prev reads 0.
+func (function *Function) initialPlot(size image.Rectangle, t, pointSize float64) *Plot {
+	if function.Initial == nil {
+		return nil
+	}
+	plot := &Plot{
+		Size:   size,
+		Values: make([]float64, size.Dy()*size.Dx()),
+		T:      t,
+	}
+	// The initial condition comes before the animation, so it is the only frame an accumulate in it sees.
+	fields := newFieldPlotter(function, size, nil, t, pointSize, timeline{start: t, step: 1})
+	bindings := function.Bindings[:function.initialAfter]
+	for i, b := range bindings {
+		fields.plotFields(b.Expr, bindings[:i])
+	}
+	fields.plotFields(function.Initial.Expr, bindings)
+	for x := size.Min.X; x < size.Max.X; x++ {
+		for y := size.Min.Y; y < size.Max.Y; y++ {
+			state := fields.state(x, y)
+			for _, b := range bindings {
+				b.Evaluate(state)
+			}
+			plot.Set(x, y, function.Initial.Expr.Evaluate(state))
+		}
+	}
+	return plot
+}
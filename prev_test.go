@@ -0,0 +1,226 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"testing"
+)
+
+func TestPlotAt(t *testing.T) {
+	plot := &Plot{
+		Size:   image.Rect(-1, -1, 2, 1),
+		Values: []float64{1, 2, 3, 4, 5, 6},
+	}
+	for eachI, each := range []struct {
+		X, Y     int
+		Boundary Boundary
+		Expected float64
+	}{
+		{X: 0, Y: 0, Boundary: BoundaryZero, Expected: 5},
+		{X: 2, Y: 0, Boundary: BoundaryClamp, Expected: 6},
+		{X: 2, Y: 0, Boundary: BoundaryWrap, Expected: 4},
+		{X: 2, Y: 0, Boundary: BoundaryZero, Expected: 0},
+		{X: -5, Y: -3, Boundary: BoundaryClamp, Expected: 1},
+		{X: -5, Y: -3, Boundary: BoundaryWrap, Expected: 3},
+		{X: 0, Y: 7, Boundary: BoundaryWrap, Expected: 2},
+	} {
+		t.Run(fmt.Sprintf("%d: %d, %d %s", eachI, each.X, each.Y, each.Boundary), func(t *testing.T) {
+			if got := plot.At(each.X, each.Y, each.Boundary); got != each.Expected {
+				t.Errorf("Got %v expected %v", got, each.Expected)
+			}
+		})
+	}
+}
+
+func TestParseBoundary(t *testing.T) {
+	for _, each := range []Boundary{BoundaryClamp, BoundaryWrap, BoundaryZero} {
+		if got, err := ParseBoundary(each.String()); err != nil || got != each {
+			t.Errorf("Got %v %v expected %v", got, err, each)
+		}
+	}
+	if _, err := ParseBoundary("mirror"); err == nil {
+		t.Errorf("Expected mirror to be refused")
+	}
+}
+
+func TestPrev(t *testing.T) {
+	size := image.Rect(-2, -2, 2, 2)
+	for eachI, each := range []struct {
+		Formula  string
+		String   string
+		Boundary Boundary
+		Expected func(x, y, frame int) float64
+	}{
+		{
+			Formula:  "prev = x; 0 = prev(1, 0)",
+			String:   "prev = x; 0 = prev(1, 0)",
+			Expected: func(x, y, frame int) float64 { return math.Min(float64(x+frame+1), 1) },
+		},
+		{
+			Formula:  "prev = x; 0 = prev(1, 0)",
+			String:   "prev = x; 0 = prev(1, 0)",
+			Boundary: BoundaryWrap,
+			Expected: func(x, y, frame int) float64 { return float64((x+frame+1+6)%4 - 2) },
+		},
+		{
+			Formula:  "prev = y + 10; 0 = prev(0, -1)",
+			String:   "prev = y + 10; 0 = prev(0, -1)",
+			Boundary: BoundaryZero,
+			Expected: func(x, y, frame int) float64 {
+				if y-frame-1 < -2 {
+					return 0
+				}
+				return float64(y - frame - 1 + 10)
+			},
+		},
+		{
+			Formula:  "0 = prev + 1",
+			String:   "0 = prev + 1",
+			Expected: func(x, y, frame int) float64 { return float64(frame + 1) },
+		},
+		{
+			Formula:  "a = 2; prev = x * a; f(b) = b + prev(); 0 = f(a)",
+			String:   "a = 2; prev = x * a; f(b) = b + prev(); 0 = f(a)",
+			Expected: func(x, y, frame int) float64 { return float64(2*x + 2*(frame+1)) },
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.String() != each.String {
+				t.Errorf("Got %#v expected %#v", f.String(), each.String)
+			}
+			if _, err := ParseFunctionE(f.Simplify().String()); err != nil {
+				t.Errorf("Reparse failed: %v", err)
+			}
+			f.Boundary = each.Boundary
+			tUsed, plots := f.Plot(0, 4, 1, size, 1)
+			if !tUsed || len(plots) != 4 {
+				t.Fatalf("Got %d plots T used %v", len(plots), tUsed)
+			}
+			for frame, plot := range plots {
+				for x := size.Min.X; x < size.Max.X; x++ {
+					for y := size.Min.Y; y < size.Max.Y; y++ {
+						if got, expected := plot.Get(x, y), each.Expected(x, y, frame); got != expected {
+							t.Errorf("Frame %d at %d, %d got %v expected %v", frame, x, y, got, expected)
+						}
+					}
+				}
+			}
+			if first, _, _ := f.PlotForT(size, 0, 1); !first.Equals(plots[0]) {
+				t.Errorf("PlotForT differs from the first frame of Plot")
+			}
+		})
+	}
+}
+
+func TestPrevErrors(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula string
+		Complex bool
+		Column  int
+		Reason  string
+	}{
+		{
+			Formula: "prev = prev(1, 0); 0 = prev",
+			Column:  8,
+			Reason:  "prev can't be used in its own initial condition",
+		},
+		{
+			Formula: "prev = 1; prev = 2; 0 = prev",
+			Column:  11,
+			Reason:  "prev is given its initial condition more than once",
+		},
+		{
+			Formula: "0 = accumulate(prev(1, 0))",
+			Column:  5,
+			Reason:  "prev, disc and ring can't be used inside accumulate",
+		},
+		{
+			Formula: "a = prev(0, 1); b = a * 2; 0 = x + accumulate(b + t)",
+			Column:  36,
+			Reason:  "prev, disc and ring can't be used inside accumulate",
+		},
+		{
+			Formula: "f(a) = a + prev; 0 = accumulate(f(x))",
+			Column:  22,
+			Reason:  "prev, disc and ring can't be used inside accumulate",
+		},
+		{
+			Formula: "a = disc(2); b = a * 2; 0 = x + accumulate(b + t)",
+			Column:  33,
+			Reason:  "prev, disc and ring can't be used inside accumulate",
+		},
+		{
+			Formula: "f(a) = a + ring(1, 2); 0 = accumulate(f(x))",
+			Column:  28,
+			Reason:  "prev, disc and ring can't be used inside accumulate",
+		},
+		{
+			Formula: "f(a) = accumulate(a * prev); 0 = f(x)",
+			Column:  8,
+			Reason:  "prev, disc and ring can't be used inside accumulate",
+		},
+		{
+			Formula: "0 = prev(1)",
+			Column:  5,
+			Reason:  "prev takes no arguments or an offset dx, dy but was given 1",
+		},
+		{
+			Formula: "a = prev; rgb(a, 0, 0)",
+			Column:  11,
+			Reason:  "prev can only be used in a formula ending with an equation",
+		},
+		{
+			Formula: "y = d(prev * x, x)",
+			Column:  5,
+			Reason:  "prev has no derivative",
+		},
+		{
+			Formula: "0 = iterate(w, 0, w + prev, abs(w) > 2, 10)",
+			Column:  23,
+			Reason:  "prev isn't defined for complex numbers",
+		},
+		{
+			Formula: "0 = z + prev",
+			Complex: true,
+			Column:  9,
+			Reason:  "prev isn't defined for complex numbers",
+		},
+		{
+			Formula: "prev = 1; 0 = z",
+			Complex: true,
+			Column:  1,
+			Reason:  "prev isn't defined for complex numbers",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			parse := ParseFunctionE
+			if each.Complex {
+				parse = ParseComplexFunctionE
+			}
+			_, err := parse(each.Formula)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a *ParseError got %#v", err)
+			}
+			if pe.Column != each.Column || pe.Reason != each.Reason {
+				t.Errorf("Got column %d %#v expected column %d %#v", pe.Column, pe.Reason, each.Column, each.Reason)
+			}
+		})
+	}
+}
+
+func TestPrevAccumulateUnrelated(t *testing.T) {
+	f, err := ParseFunctionE("a = prev; b = x; 0 = a + accumulate(b)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got, _, err := f.Evaluate(2, 0, 3); err != nil || got != 8 {
+		t.Errorf("Got %v %v expected 8", got, err)
+	}
+}
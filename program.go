@@ -0,0 +1,541 @@
+package heatPlot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Binding gives the value of Expr the name Name for the statements which follow it, as in "r = sqrt(x^2 + y^2);".
+type Binding struct {
+	Name string
+	Expr Expression
+}
+
+func (v Binding) Evaluate(state State) float64 {
+	value := v.Expr.Evaluate(state)
+	state.Bind(v.Name, value)
+	return value
+}
+
+func (v Binding) String() string {
+	return fmt.Sprintf("%s = %s", v.Name, v.Expr.String())
+}
+
+func (v Binding) Simplify() Expression {
+	v.Expr = removeBrackets(v.Expr.Simplify())
+	return &v
+}
+
+func (v Binding) Depth() int {
+	return v.Expr.Depth() + 1
+}
+
+// isBuiltinVar reports whether name is one of the variables State provides rather than one a formula binds.
+func isBuiltinVar(name string) bool {
+	switch strings.ToUpper(name) {
+	case "X", "Y", "T", "R", "THETA", "Θ", "PREV":
+		return true
+	}
+	return false
+}
+
+// builtinVar is isBuiltinVar plus z and i when parsing a complex formula.
+func (lex *CalcLexer) builtinVar(name string) bool {
+	return isBuiltinVar(name) || lex.complex && isComplexVar(name)
+}
+
+// assignable reports whether a binding can use name, the polar variables can be shadowed but x, y and t can't, nor
+// can z and i in a complex formula.
+func (lex *CalcLexer) assignable(name string) bool {
+	switch strings.ToUpper(name) {
+	case "X", "Y", "T":
+		return false
+	}
+	return !lex.complex || !isComplexVar(name)
+}
+
+// knownFunction is isFunctionName plus the functions which only exist for complex numbers when parsing a complex
+// formula.
+func (lex *CalcLexer) knownFunction(name string) bool {
+	return isFunctionName(name) || lex.complex && isComplexFunctionName(name)
+}
+
+// infixFunction reports whether name is a built in function which can be written between 2 arguments, as in
+// "x max y".
+func (lex *CalcLexer) infixFunction(name string) bool {
+	return lex.knownFunction(name) && lex.arity(name).accepts(2)
+}
+
+// arity returns how many arguments the built in function name takes, using the complex versions of the functions
+// when parsing a complex formula.
+func (lex *CalcLexer) arity(name string) arity {
+	if lex.complex && isComplexFunctionName(name) {
+		return complexFunctionArity(name)
+	}
+	return functionArity(name)
+}
+
+func isFunctionName(name string) bool {
+	name = strings.ToUpper(name)
+	if _, ok := NullaryFunctions[name]; ok {
+		return true
+	}
+	if _, ok := SingleFunctions[name]; ok {
+		return true
+	}
+	if _, ok := DoubleFunctions[name]; ok {
+		return true
+	}
+	if _, ok := VariadicFunctions[name]; ok {
+		return true
+	}
+	if _, ok := RandomFunctions[name]; ok {
+		return true
+	}
+	if _, ok := NoiseFunctions[name]; ok {
+		return true
+	}
+	return false
+}
+
+// isSpecialName reports whether name is one of the calls given a node of their own by resolveCalls, such as sum, d
+// and img, rather than being one of the functions isFunctionName knows.
+func isSpecialName(name string) bool {
+	if isSummationName(name) || isIterateName(name) || isImageName(name) || isPrevVar(name) ||
+		neighbourhoodArity(name) != 0 || convolutionArity(name) != 0 {
+		return true
+	}
+	switch strings.ToUpper(name) {
+	case "INTEGRATE", "ACCUMULATE", "D":
+		return true
+	}
+	return false
+}
+
+// program turns the statements of a formula into a Function. Every statement but the last must either bind a
+// variable or declare a function, and both must be declared before they are used. The last is an equation or a
+// Colour. Errors are recorded against the offending token and nil returned.
+func (lex *CalcLexer) program(statements []Expression) *Function {
+	f := &Function{}
+	defined := map[string]bool{}
+	functions := map[string]*UserFunction{}
+	var bound *derivativeScope
+	for i, s := range statements {
+		last := i == len(statements)-1
+		tokens := lex.statementTokens(i)
+		if colour, ok := s.(*Colour); ok {
+			if !last {
+				lex.fail(tokens[0], fmt.Sprintf("%s can only be the final statement", colour.Name), "assign the channels to variables first, for example red = x / 10; rgb(red, 0, 0)")
+				return nil
+			}
+			if want := colour.channelCount(); len(colour.Channels) != want {
+				lex.fail(tokens[0], fmt.Sprintf("%s takes %d arguments but was given %d", colour.Name, want, len(colour.Channels)), "rgb takes red, green and blue, rgba also takes alpha, each from 0 to 1")
+				return nil
+			}
+		}
+		statement, _ := s.(*Equals)
+		if !last {
+			if name, params, ok := definitionHead(statement.LHS); ok {
+				uf := lex.declare(name, params, statement.RHS, functions, tokens)
+				if uf == nil {
+					return nil
+				}
+				functions[strings.ToUpper(name)] = uf
+				f.Definitions = append(f.Definitions, uf)
+				after := len(f.Bindings)
+				if f.Initial != nil {
+					after++
+				}
+				f.definitionsAfter = append(f.definitionsAfter, after)
+				continue
+			}
+			v, ok := statement.LHS.(*Var)
+			if !ok {
+				lex.fail(tokens[0], "only a variable or a function can be assigned before the final formula", "use a name such as r = sqrt(x^2 + y^2); or a function such as f(a) = a^2; then use it in the formula")
+				return nil
+			}
+			if isPrevVar(v.Var) && (lex.complex || f.Initial != nil) {
+				reason := "prev isn't defined for complex numbers"
+				if f.Initial != nil {
+					reason = "prev is given its initial condition more than once"
+				}
+				lex.fail(tokens[0], reason, "prev = ...; gives what prev reads in the first frame of a heat plot")
+				return nil
+			}
+			if !lex.assignable(v.Var) {
+				lex.fail(tokens[0], fmt.Sprintf("%s can't be assigned", v.Var), "x, y and t are provided for every point, pick another name")
+				return nil
+			}
+		}
+		if last && lex.complex && statement != nil {
+			// A complex formula can end by declaring the function to plot, as in "f(z) = (z^2 - 1) / (z^2 + 1)".
+			if name, params, ok := definitionHead(statement.LHS); ok && len(params) == 1 && !lex.knownFunction(name) {
+				uf := lex.declare(name, params, statement.RHS, functions, tokens)
+				if uf == nil {
+					return nil
+				}
+				f.plot(uf)
+				break
+			}
+		}
+		// The final statement is used whole, the others only for the value on their right.
+		used := s
+		if !last {
+			used = statement.RHS
+		}
+		used = lex.resolveCalls(used, functions, "", tokens)
+		if !last {
+			statement.RHS = used
+		}
+		if lex.err != nil || !lex.checkComplex(used, tokens) {
+			return nil
+		}
+		undefined := ""
+		visitVars(used, func(v *Var) {
+			if undefined == "" && !lex.builtinVar(v.Var) && !defined[strings.ToUpper(v.Var)] {
+				undefined = v.Var
+			}
+		})
+		if undefined != "" {
+			lex.fail(findVarToken(tokens, undefined), fmt.Sprintf("variable %s is used before it is defined", undefined), fmt.Sprintf("define it in an earlier statement, for example %s = x * y; ...", undefined))
+			return nil
+		}
+		accumulateBindings(used, f.Bindings)
+		if !lex.checkConvolutions(used, nil, tokens) {
+			return nil
+		}
+		if !lex.differentiate(used, bound, tokens) {
+			return nil
+		}
+		if last {
+			switch used := used.(type) {
+			case *Equals:
+				f.Equals = used
+			case *Colour:
+				if usesPrev(used) || f.Initial != nil || f.bindingsUsePrev() {
+					lex.fail(tokens[0], "prev can only be used in a formula ending with an equation", "rgb and rgba formulas have no weight for prev to read")
+					return nil
+				}
+				f.Colour = used
+			}
+			break
+		}
+		name := statement.LHS.(*Var).Var
+		if isPrevVar(name) {
+			if usesPrev(statement.RHS) {
+				lex.fail(findToken(tokens[1:], name), "prev can't be used in its own initial condition", "the initial condition is what prev reads in the first frame, write it using x and y")
+				return nil
+			}
+			f.Initial = &Binding{
+				Name: name,
+				Expr: statement.RHS,
+			}
+			f.initialAfter = len(f.Bindings)
+			continue
+		}
+		defined[strings.ToUpper(name)] = true
+		bound = bound.bind(name, statement.RHS)
+		f.Bindings = append(f.Bindings, &Binding{
+			Name: name,
+			Expr: statement.RHS,
+		})
+	}
+	return f
+}
+
+// declare checks the body of a function declared in the formula, it can only use its own parameters, the built in
+// variables and the functions declared before it.
+func (lex *CalcLexer) declare(name string, params []string, body Expression, functions map[string]*UserFunction, tokens []lexedToken) *UserFunction {
+	seen := map[string]bool{}
+	for _, p := range params {
+		if seen[strings.ToUpper(p)] {
+			lex.fail(findVarToken(tokens, p), fmt.Sprintf("%s is a parameter of %s more than once", p, name), "give each parameter a different name")
+			return nil
+		}
+		seen[strings.ToUpper(p)] = true
+	}
+	// Errors in the body are reported against its tokens rather than the declaration's head.
+	for i, t := range tokens {
+		if t.char == '=' {
+			tokens = tokens[i+1:]
+			break
+		}
+	}
+	body = lex.resolveCalls(body, functions, name, tokens)
+	if lex.err != nil || !lex.checkComplex(body, tokens) {
+		return nil
+	}
+	undefined := ""
+	visitVars(body, func(v *Var) {
+		if undefined == "" && !lex.builtinVar(v.Var) && !seen[strings.ToUpper(v.Var)] {
+			undefined = v.Var
+		}
+	})
+	if undefined != "" {
+		lex.fail(findVarToken(tokens, undefined), fmt.Sprintf("variable %s isn't a parameter of %s", undefined, name), fmt.Sprintf("add it to the parameters, for example %s(%s, %s)", name, strings.Join(params, ", "), undefined))
+		return nil
+	}
+	if !lex.checkConvolutions(body, params, tokens) {
+		return nil
+	}
+	var scope *derivativeScope
+	for _, p := range params {
+		scope = scope.independent(p, false)
+	}
+	if !lex.differentiate(body, scope, tokens) {
+		return nil
+	}
+	return &UserFunction{
+		Name:   name,
+		Params: params,
+		Body:   body,
+	}
+}
+
+// findVarToken returns the first variable token written as name, or the first token if there is none. The index of a
+// sum, prod, integral or iteration is skipped, as are the arguments the index is bound in.
+func findVarToken(tokens []lexedToken, name string) lexedToken {
+	bodyStart, bodyEnd := 0, 0
+	for i, t := range tokens {
+		if i >= bodyStart && i < bodyEnd || t.char != VAR || !strings.EqualFold(t.text, name) {
+			continue
+		}
+		if isBoundIndex(tokens, i) {
+			bodyStart, bodyEnd = summationBody(tokens, i)
+			continue
+		}
+		return t
+	}
+	if len(tokens) == 0 {
+		return lexedToken{}
+	}
+	return tokens[0]
+}
+
+// boundArguments is how many arguments, after the first, the calls which bind their first argument have before the
+// ones it is bound in.
+var boundArguments = map[string]int{
+	"SUM":       2,
+	"PROD":      2,
+	"INTEGRATE": 3,
+	"ITERATE":   2,
+	"ESCAPE":    2,
+}
+
+// isBoundIndex reports whether the i-th token is the first argument of a call to integrate, iterate or escape, or the
+// index of a sum or prod, which is followed by '='.
+func isBoundIndex(tokens []lexedToken, i int) bool {
+	if i < 2 || tokens[i-1].char != '(' || tokens[i-2].char != FUNCNAME && tokens[i-2].char != INFIXNAME {
+		return false
+	}
+	if isSummationName(tokens[i-2].text) {
+		return i+1 < len(tokens) && tokens[i+1].char == '='
+	}
+	_, ok := boundArguments[strings.ToUpper(tokens[i-2].text)]
+	return ok
+}
+
+// summationBody returns the positions of the first token of the arguments the i-th token is bound in, see
+// isBoundIndex, and of the bracket closing the call.
+func summationBody(tokens []lexedToken, i int) (start, end int) {
+	depth, commas, first := 1, 0, boundArguments[strings.ToUpper(tokens[i-2].text)]
+	start = len(tokens)
+	for end = i + 1; end < len(tokens); end++ {
+		switch tokens[end].char {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return start, end
+			}
+		case ',':
+			if depth != 1 {
+				break
+			}
+			if commas++; commas == first {
+				start = end + 1
+			}
+		}
+	}
+	return start, end
+}
+
+// statementTokens returns the tokens making up the i-th statement, statements being separated by ';'.
+func (lex *CalcLexer) statementTokens(i int) []lexedToken {
+	start := 0
+	for j, t := range lex.tokens {
+		if t.char != ';' {
+			continue
+		}
+		if i == 0 {
+			return lex.tokens[start:j]
+		}
+		i--
+		start = j + 1
+	}
+	return lex.tokens[start:]
+}
+
+// children returns the expressions directly beneath e.
+func children(e Expression) []Expression {
+	refs := childRefs(e)
+	result := make([]Expression, len(refs))
+	for i, ref := range refs {
+		result[i] = *ref
+	}
+	return result
+}
+
+// childRefs returns references to the fields holding the expressions directly beneath e, so they can be replaced.
+func childRefs(e Expression) []*Expression {
+	switch e := e.(type) {
+	case *Equals:
+		return []*Expression{&e.LHS, &e.RHS}
+	case *Binding:
+		return []*Expression{&e.Expr}
+	case *Colour:
+		result := make([]*Expression, len(e.Channels))
+		for i := range e.Channels {
+			result[i] = &e.Channels[i]
+		}
+		return result
+	case *Plus:
+		return []*Expression{&e.LHS, &e.RHS}
+	case *Subtract:
+		return []*Expression{&e.LHS, &e.RHS}
+	case *Multiply:
+		return []*Expression{&e.LHS, &e.RHS}
+	case *Divide:
+		return []*Expression{&e.LHS, &e.RHS}
+	case *Power:
+		return []*Expression{&e.LHS, &e.RHS}
+	case *Modulus:
+		return []*Expression{&e.LHS, &e.RHS}
+	case *Negate:
+		return []*Expression{&e.Expr}
+	case *Brackets:
+		return []*Expression{&e.Expr}
+	case *NFunction:
+		result := make([]*Expression, len(e.Args))
+		for i := range e.Args {
+			result[i] = &e.Args[i]
+		}
+		return result
+	case *LessThan:
+		return []*Expression{&e.LHS, &e.RHS}
+	case *LessOrEqual:
+		return []*Expression{&e.LHS, &e.RHS}
+	case *GreaterThan:
+		return []*Expression{&e.LHS, &e.RHS}
+	case *GreaterOrEqual:
+		return []*Expression{&e.LHS, &e.RHS}
+	case *EqualTo:
+		return []*Expression{&e.LHS, &e.RHS}
+	case *NotEqualTo:
+		return []*Expression{&e.LHS, &e.RHS}
+	case *And:
+		return []*Expression{&e.LHS, &e.RHS}
+	case *Or:
+		return []*Expression{&e.LHS, &e.RHS}
+	case *Not:
+		return []*Expression{&e.Expr}
+	case *If:
+		return []*Expression{&e.Condition, &e.Then, &e.Else}
+	case *Summation:
+		return []*Expression{&e.From, &e.To, &e.Body}
+	case *Derivative:
+		return []*Expression{&e.Expr}
+	case *Integral:
+		return []*Expression{&e.From, &e.To, &e.Body}
+	case *Accumulate:
+		return []*Expression{&e.Expr}
+	case *Iterate:
+		return []*Expression{&e.Start, &e.Update, &e.Bailout, &e.Max}
+	case *Prev:
+		result := make([]*Expression, len(e.Args))
+		for i := range e.Args {
+			result[i] = &e.Args[i]
+		}
+		return result
+	case *Neighbourhood:
+		result := make([]*Expression, len(e.Args))
+		for i := range e.Args {
+			result[i] = &e.Args[i]
+		}
+		return result
+	case *Convolution:
+		result := []*Expression{&e.Expr}
+		for i := range e.Args {
+			result = append(result, &e.Args[i])
+		}
+		return result
+	case *ImageSample:
+		return []*Expression{&e.X, &e.Y}
+	case *UserFunctionCall:
+		result := make([]*Expression, len(e.Args))
+		for i := range e.Args {
+			result[i] = &e.Args[i]
+		}
+		return result
+	case *Piecewise:
+		result := []*Expression{}
+		for i := range e.Conditions {
+			result = append(result, &e.Conditions[i], &e.Values[i])
+		}
+		if e.Otherwise != nil {
+			result = append(result, &e.Otherwise)
+		}
+		return result
+	}
+	return nil
+}
+
+// binder is implemented by the nodes which bind a variable of their own for some of their children, such as the
+// index of a sum.
+type binder interface {
+	binds() (index string, bodies []Expression)
+}
+
+// boundIn returns the variable e binds for its child, if it binds one.
+func boundIn(e, child Expression) (string, bool) {
+	b, ok := e.(binder)
+	if !ok {
+		return "", false
+	}
+	index, bodies := b.binds()
+	for _, body := range bodies {
+		if body == child {
+			return index, true
+		}
+	}
+	return "", false
+}
+
+// visitVars calls visit for every variable in e, in the order they are written. The index of a binder is left out of
+// the bodies it is bound in, and z and i out of an iterate, which always has them.
+func visitVars(e Expression, visit func(*Var)) {
+	if v, ok := e.(*Var); ok {
+		visit(v)
+		return
+	}
+	if _, ok := e.(*Iterate); ok {
+		outer := visit
+		visit = func(v *Var) {
+			if !isComplexVar(v.Var) {
+				outer(v)
+			}
+		}
+	}
+	for _, child := range children(e) {
+		index, ok := boundIn(e, child)
+		if !ok {
+			visitVars(child, visit)
+			continue
+		}
+		visitVars(child, func(v *Var) {
+			if !strings.EqualFold(v.Var, index) {
+				visit(v)
+			}
+		})
+	}
+}
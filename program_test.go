@@ -0,0 +1,102 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestProgram(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula  string
+		Expected string
+		Explicit string
+	}{
+		{
+			Formula:  "r = sqrt(x^2+y^2); a = atan2(y, x); 0 = sin(r - t/5) * cos(3a)",
+			Expected: "r = sqrt(x ^ 2 + y ^ 2); a = atan2(y, x); 0 = sin(r - t / 5) * cos(3a)",
+			Explicit: "0 = sin(sqrt(x ^ 2 + y ^ 2) - t / 5) * cos(3 * atan2(y, x))",
+		},
+		{
+			Formula:  "a = x * 2; b = a + y; y = a b",
+			Expected: "a = x * 2; b = a + y; y = a b",
+			Explicit: "y = (x * 2) * (x * 2 + y)",
+		},
+		{
+			Formula:  "a = x; a = a * 3; y = a;",
+			Expected: "a = x; a = a * 3; y = a",
+			Explicit: "y = x * 3",
+		},
+		{
+			Formula:  "Size = 3; y = size * x",
+			Expected: "Size = 3; y = size * x",
+			Explicit: "y = 3 * x",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.String() != each.Expected {
+				t.Errorf("Failed to match %v with %v", f.String(), each.Expected)
+			}
+			explicit := ParseFunction(each.Explicit)
+			for _, p := range [][3]float64{{3, 5, 7}, {-1.5, 2, 1}, {0.25, -4, 12}} {
+				got, tUsed, _ := f.Evaluate(p[0], p[1], p[2])
+				expected, expectedTUsed, _ := explicit.Evaluate(p[0], p[1], p[2])
+				if got != expected {
+					t.Errorf("At %v got %v expected %v", p, got, expected)
+				}
+				if tUsed != expectedTUsed {
+					t.Errorf("At %v T used %v expected %v", p, tUsed, expectedTUsed)
+				}
+			}
+		})
+	}
+}
+
+func TestProgramErrors(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula string
+		Column  int
+		Reason  string
+	}{
+		{
+			Formula: "y = r * 2; r = x",
+			Column:  1,
+			Reason:  "y can't be assigned",
+		},
+		{
+			Formula: "a = b; b = x; y = a",
+			Column:  5,
+			Reason:  "variable b is used before it is defined",
+		},
+		{
+			Formula: "y = x + q",
+			Column:  9,
+			Reason:  "variable q is used before it is defined",
+		},
+		{
+			Formula: "a = 1; a + 1 = 2; y = a",
+			Column:  8,
+			Reason:  "only a variable or a function can be assigned before the final formula",
+		},
+		{
+			Formula: "x = 1; y = x",
+			Column:  1,
+			Reason:  "x can't be assigned",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			_, err := ParseFunctionE(each.Formula)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a *ParseError got %#v", err)
+			}
+			if pe.Column != each.Column || pe.Reason != each.Reason {
+				t.Errorf("Got column %d %#v expected column %d %#v", pe.Column, pe.Reason, each.Column, each.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package heatPlot
+
+import "math"
+
+// RandomFunctions are like VariadicFunctions but are also given the seed from State.CurSeed. Rather than keeping any
+// state they hash the seed and their arguments, so the same seed and arguments always give the same value and a plot
+// can be drawn again exactly. Called with no arguments they are given x and y, a different value for every point.
+var RandomFunctions map[string]RandomFunctionDef
+
+type RandomFunctionDef func(seed int64, args ...float64) float64
+
+// hashRand is rand, uniformly distributed from 0 up to but not including 1.
+func hashRand(seed int64, args ...float64) float64 {
+	return unitHash(hashValues(uint64(seed), args...))
+}
+
+// hashGauss is gauss, normally distributed with a mean of 0 and a standard deviation of 1 using the Box-Muller
+// transform of two uniform values drawn from the hash.
+func hashGauss(seed int64, args ...float64) float64 {
+	h := hashValues(uint64(seed), args...)
+	u1 := 1 - unitHash(h)
+	u2 := unitHash(splitMix(h))
+	return math.Sqrt(-2*math.Log(u1)) * math.Cos(2*math.Pi*u2)
+}
+
+// hashValues mixes each value into h in turn, -0 hashes the same as 0.
+func hashValues(h uint64, values ...float64) uint64 {
+	h = splitMix(h)
+	for _, v := range values {
+		if v == 0 {
+			v = 0
+		}
+		h = splitMix(h ^ math.Float64bits(v))
+	}
+	return h
+}
+
+// splitMix is the SplitMix64 finaliser, every bit of h affects every bit of the result.
+func splitMix(h uint64) uint64 {
+	h += 0x9E3779B97F4A7C15
+	h = (h ^ h>>30) * 0xBF58476D1CE4E5B9
+	h = (h ^ h>>27) * 0x94D049BB133111EB
+	return h ^ h>>31
+}
+
+// unitHash maps h to [0, 1) using its top 53 bits.
+func unitHash(h uint64) float64 {
+	return float64(h>>11) / (1 << 53)
+}
@@ -0,0 +1,148 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestRandom(t *testing.T) {
+	evaluate := func(t *testing.T, formula string, seed int64, x, y, ti float64) float64 {
+		f, err := ParseFunctionE(formula)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		f.Seed = seed
+		v, _, err := f.Evaluate(x, y, ti)
+		if err != nil {
+			t.Fatalf("Evaluate failed: %v", err)
+		}
+		return v
+	}
+	for eachI, each := range []string{"0 = rand()", "0 = rand(x, y)", "0 = rand(x, y, t)", "0 = gauss(x, y, t)", "0 = gauss()"} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each), func(t *testing.T) {
+			a := evaluate(t, each, 7, 1.5, -2, 3)
+			if b := evaluate(t, each, 7, 1.5, -2, 3); a != b {
+				t.Errorf("Same seed gave %v then %v", a, b)
+			}
+			if b := evaluate(t, each, 8, 1.5, -2, 3); a == b {
+				t.Errorf("Seeds 7 and 8 both gave %v", a)
+			}
+			if b := evaluate(t, each, 7, 1.6, -2, 3); a == b {
+				t.Errorf("Points 1.5 and 1.6 both gave %v", a)
+			}
+		})
+	}
+	if a, b := evaluate(t, "0 = rand()", 3, 2, 5, 0), evaluate(t, "0 = rand(x, y)", 3, 2, 5, 0); a != b {
+		t.Errorf("rand() gave %v but rand(x, y) gave %v", a, b)
+	}
+	if a, b := evaluate(t, "0 = rand(0)", 3, 0, 0, 0), evaluate(t, "0 = rand(-0)", 3, 0, 0, 0); a != b {
+		t.Errorf("rand(0) gave %v but rand(-0) gave %v", a, b)
+	}
+	f, err := ParseFunctionE("0 = rand(x, y)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	g, err := ParseFunctionE("0 = gauss(x, y)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	n, randSum, gaussSum, gaussSquares := 0, 0.0, 0.0, 0.0
+	for x := -50; x < 50; x++ {
+		for y := -50; y < 50; y++ {
+			r, _, _ := f.Evaluate(float64(x), float64(y), 0)
+			if r < 0 || r >= 1 {
+				t.Fatalf("rand(%d, %d) = %v isn't in [0, 1)", x, y, r)
+			}
+			v, _, _ := g.Evaluate(float64(x), float64(y), 0)
+			n, randSum, gaussSum, gaussSquares = n+1, randSum+r, gaussSum+v, gaussSquares+v*v
+		}
+	}
+	if mean := randSum / float64(n); math.Abs(mean-0.5) > 0.01 {
+		t.Errorf("rand has a mean of %v", mean)
+	}
+	if mean := gaussSum / float64(n); math.Abs(mean) > 0.03 {
+		t.Errorf("gauss has a mean of %v", mean)
+	}
+	if variance := gaussSquares / float64(n); math.Abs(variance-1) > 0.05 {
+		t.Errorf("gauss has a variance of %v", variance)
+	}
+}
+
+func TestNullaryFunctions(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula  string
+		Expected float64
+		String   string
+	}{
+		{Formula: "0 = inf()", Expected: math.Inf(1), String: "0 = inf()"},
+		{Formula: "0 = inf(-1)", Expected: math.Inf(-1), String: "0 = inf(-1)"},
+		{Formula: "0 = -1 / inf() + x", Expected: 3, String: "0 = -1 / inf() + x"},
+		{Formula: "f() = 5; 0 = f() * x", Expected: 15, String: "f() = 5; 0 = f() * x"},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.String() != each.String {
+				t.Errorf("Got %#v expected %#v", f.String(), each.String)
+			}
+			v, _, err := f.Evaluate(3, 2, 0)
+			if err != nil {
+				t.Fatalf("Evaluate failed: %v", err)
+			}
+			if v != each.Expected {
+				t.Errorf("Got %v expected %v", v, each.Expected)
+			}
+		})
+	}
+	f, err := ParseFunctionE("0 = nan()")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if v, _, _ := f.Evaluate(0, 0, 0); !math.IsNaN(v) {
+		t.Errorf("nan() gave %v", v)
+	}
+}
+
+func TestNullaryFunctionErrors(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula string
+		Column  int
+		Reason  string
+	}{
+		{
+			Formula: "y = sin()",
+			Column:  5,
+			Reason:  "sin takes 1 argument but was given 0",
+		},
+		{
+			Formula: "y = nan(x)",
+			Column:  5,
+			Reason:  "nan takes no arguments but was given 1",
+		},
+		{
+			Formula: "y = max()",
+			Column:  5,
+			Reason:  "max takes 1 or more arguments but was given 0",
+		},
+		{
+			Formula: "f() = 2; y = f(x)",
+			Column:  14,
+			Reason:  "f takes 0 arguments but was given 1",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			_, err := ParseFunctionE(each.Formula)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a *ParseError got %#v", err)
+			}
+			if pe.Column != each.Column || pe.Reason != each.Reason {
+				t.Errorf("Got column %d %#v expected column %d %#v", pe.Column, pe.Reason, each.Column, each.Reason)
+			}
+		})
+	}
+}
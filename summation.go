@@ -0,0 +1,133 @@
+package heatPlot
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// maxSummationTerms stops a sum or prod with enormous bounds from hanging the plot. One with more terms is an error
+// when its bounds are constant and NaN otherwise.
+const maxSummationTerms = 10000
+
+// Summation is sum(k = from, to, body) or prod(k = from, to, body). Body is evaluated with the index Index bound to
+// From, From + 1 and so on up to To, in a scope of its own, and the results added up or multiplied together. An empty
+// sum is 0 and an empty prod is 1. As in "y = sum(k = 1, 20, sin(k * x) / k)".
+type Summation struct {
+	// Name is sum or prod as it was written.
+	Name  string
+	Index string
+	From  Expression
+	To    Expression
+	Body  Expression
+}
+
+// isProduct reports whether the terms are multiplied rather than added.
+func (v Summation) isProduct() bool {
+	return strings.EqualFold(v.Name, "prod")
+}
+
+func (v Summation) Evaluate(state State) float64 {
+	from, to := v.From.Evaluate(state), v.To.Evaluate(state)
+	if !summationBounded(from, to) {
+		return math.NaN()
+	}
+	result := 0.0
+	if v.isProduct() {
+		result = 1
+	}
+	scope := state.Scope()
+	for k := from; k <= to; k++ {
+		scope.Bind(v.Index, k)
+		if v.isProduct() {
+			result *= v.Body.Evaluate(scope)
+		} else {
+			result += v.Body.Evaluate(scope)
+		}
+	}
+	return result
+}
+
+func (v Summation) binds() (string, []Expression) {
+	return v.Index, []Expression{v.Body}
+}
+
+func (v Summation) String() string {
+	return fmt.Sprintf("%s(%s = %s, %s, %s)", v.Name, v.Index, v.From.String(), v.To.String(), v.Body.String())
+}
+
+func (v Summation) Simplify() Expression {
+	v.From = removeBrackets(v.From.Simplify())
+	v.To = removeBrackets(v.To.Simplify())
+	v.Body = removeBrackets(v.Body.Simplify())
+	return &v
+}
+
+func (v Summation) Depth() int {
+	return maxDepth(v.From, v.To, v.Body)
+}
+
+// summationBounded reports whether a sum from from to to has a number of terms, at most maxSummationTerms of them.
+func summationBounded(from, to float64) bool {
+	return !math.IsNaN(from) && !math.IsNaN(to) && !(to-from >= maxSummationTerms)
+}
+
+// isSummationName reports whether name is sum or prod, which take an index.
+func isSummationName(name string) bool {
+	return strings.EqualFold(name, "sum") || strings.EqualFold(name, "prod")
+}
+
+// summation recognises sum(k = from, to, body) and prod(k = from, to, body), whose first argument names the index and
+// gives its first value. It returns nil for every other call, such as the sum of values sum(x, y, 2). An index which
+// is a built in variable, the wrong number of arguments, or constant bounds with more than maxSummationTerms terms
+// between them, are recorded as errors against the tokens and nil returned.
+func (lex *CalcLexer) summation(name string, args []Expression, tokens []lexedToken) *Summation {
+	if !isSummationName(name) || len(args) == 0 {
+		return nil
+	}
+	first, ok := args[0].(*Equals)
+	if !ok {
+		return nil
+	}
+	index := first.LHS.(*Var)
+	hint := fmt.Sprintf("for example %s(k = 1, 10, k * x)", strings.ToLower(name))
+	if len(args) != 3 {
+		lex.fail(findToken(tokens, name), fmt.Sprintf("%s takes its index and first value, the last value and the terms", strings.ToLower(name)), hint)
+		return nil
+	}
+	if lex.builtinVar(index.Var) {
+		lex.fail(findToken(tokens, index.Var), fmt.Sprintf("%s is a built-in variable and can't be a %s's index", index.Var, strings.ToLower(name)), "use another name such as k, "+hint)
+		return nil
+	}
+	v := &Summation{
+		Name:  name,
+		Index: index.Var,
+		From:  first.RHS,
+		To:    args[1],
+		Body:  args[2],
+	}
+	if isConstant(v.From) && isConstant(v.To) {
+		if from, to := v.From.Evaluate(&RealState{}), v.To.Evaluate(&RealState{}); to-from >= maxSummationTerms {
+			lex.fail(findToken(tokens, name), fmt.Sprintf("%s has %.0f terms, more than the %d allowed", name, math.Floor(to-from)+1, maxSummationTerms), "split it into smaller sums or take bigger steps, as in sum(k = 1, 1000, f(k * 100))")
+			return nil
+		}
+	}
+	return v
+}
+
+// isConstant reports whether e is made only of numbers, named constants and arithmetic, so has the same value
+// everywhere.
+func isConstant(e Expression) bool {
+	switch e.(type) {
+	case *Const, *NamedConstant:
+		return true
+	case *Plus, *Subtract, *Multiply, *Divide, *Power, *Modulus, *Negate, *Brackets:
+		for _, child := range children(e) {
+			if !isConstant(child) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
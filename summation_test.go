@@ -0,0 +1,210 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+func TestSummation(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula  string
+		String   string
+		Expected func(x, y, t float64) float64
+		TUsed    bool
+	}{
+		{
+			Formula: "0 = sum(k = 1, 20, sin(k*x)/k)",
+			String:  "0 = sum(k = 1, 20, sin(k * x) / k)",
+			Expected: func(x, y, t float64) float64 {
+				r := 0.0
+				for k := 1.0; k <= 20; k++ {
+					r += math.Sin(k*x) / k
+				}
+				return r
+			},
+		},
+		{
+			Formula:  "0 = prod(k = 1, 5, k)",
+			String:   "0 = prod(k = 1, 5, k)",
+			Expected: func(x, y, t float64) float64 { return 120 },
+		},
+		{
+			Formula:  "0 = sum(n = 1, t, n * y)",
+			String:   "0 = sum(n = 1, t, n * y)",
+			Expected: func(x, y, t float64) float64 { return float64(t*(t+1)/2) * y },
+			TUsed:    true,
+		},
+		{
+			Formula:  "0 = sum(i = 1, 3, sum(j = 1, i, i * j))",
+			String:   "0 = sum(i = 1, 3, sum(j = 1, i, i * j))",
+			Expected: func(x, y, t float64) float64 { return 1 + 2 + 4 + 3 + 6 + 9 },
+		},
+		{
+			Formula:  "0 = sum(k = 5, 1, k) + prod(k = 5, 1, k)",
+			String:   "0 = sum(k = 5, 1, k) + prod(k = 5, 1, k)",
+			Expected: func(x, y, t float64) float64 { return 1 },
+		},
+		{
+			Formula:  "k = 10; 0 = sum(k = 1, 3, k) + k",
+			String:   "k = 10; 0 = sum(k = 1, 3, k) + k",
+			Expected: func(x, y, t float64) float64 { return 16 },
+		},
+		{
+			Formula:  "f(a) = prod(k = 1, a, x / k); 0 = f(3)",
+			String:   "f(a) = prod(k = 1, a, x / k); 0 = f(3)",
+			Expected: func(x, y, t float64) float64 { return x * x * x / 6 },
+		},
+		{
+			Formula:  "0 = sum(x, y, 1, 2)",
+			String:   "0 = sum(x, y, 1, 2)",
+			Expected: func(x, y, t float64) float64 { return x + y + 3 },
+		},
+		{
+			Formula:  "a = 5; 0 = sum(a, 1, 2, 3)",
+			String:   "a = 5; 0 = sum(a, 1, 2, 3)",
+			Expected: func(x, y, t float64) float64 { return 11 },
+		},
+		{
+			Formula:  "0 = sum(x, 1, 2, 3) + prod(k = y, y + 1, k)",
+			String:   "0 = sum(x, 1, 2, 3) + prod(k = y, y + 1, k)",
+			Expected: func(x, y, t float64) float64 { return x + 6 + y*(y+1) },
+		},
+		{
+			Formula:  "0 = sum(k = 1, 10000, 1)",
+			String:   "0 = sum(k = 1, 10000, 1)",
+			Expected: func(x, y, t float64) float64 { return maxSummationTerms },
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.String() != each.String {
+				t.Errorf("Got %#v expected %#v", f.String(), each.String)
+			}
+			if _, err := ParseFunctionE(f.Simplify().String()); err != nil {
+				t.Errorf("Reparse failed: %v", err)
+			}
+			for _, p := range [][3]float64{{3, 5, 7}, {-1.5, 2, 1}, {0.25, -4, 12}} {
+				got, tUsed, err := f.Evaluate(p[0], p[1], p[2])
+				if err != nil {
+					t.Fatalf("Evaluate failed: %v", err)
+				}
+				if expected := each.Expected(p[0], p[1], p[2]); math.Abs(got-expected) > 1e-9 {
+					t.Errorf("At %v got %v expected %v", p, got, expected)
+				}
+				if tUsed != each.TUsed {
+					t.Errorf("At %v T used %v expected %v", p, tUsed, each.TUsed)
+				}
+			}
+		})
+	}
+}
+
+func TestSummationErrors(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula string
+		Column  int
+		Reason  string
+	}{
+		{
+			Formula: "y = prod(x, 2)",
+			Column:  5,
+			Reason:  "prod takes its index and first value, the last value and the terms",
+		},
+		{
+			Formula: "y = sum(k = 1, 10, k) + k",
+			Column:  25,
+			Reason:  "variable k is used before it is defined",
+		},
+		{
+			Formula: "y = sum(k = 1, max(1, 2, 3), k) + k",
+			Column:  35,
+			Reason:  "variable k is used before it is defined",
+		},
+		{
+			Formula: "y = prod(k, 1, 3, k)",
+			Column:  5,
+			Reason:  "prod takes its index and first value, the last value and the terms",
+		},
+		{
+			Formula: "y = sum(k = 1, 3)",
+			Column:  5,
+			Reason:  "sum takes its index and first value, the last value and the terms",
+		},
+		{
+			Formula: "y = max(k = 1, 3)",
+			Column:  9,
+			Reason:  "max can't be given k = 1",
+		},
+		{
+			Formula: "y = sum(1, k = 2, 3)",
+			Column:  14,
+			Reason:  "unexpected '=' after variable k",
+		},
+		{
+			Formula: "f(a, b) = a * b; y = f(k = 1, 3)",
+			Column:  24,
+			Reason:  "f can't be given k = 1",
+		},
+		{
+			Formula: "y = sum(t = 1, 3, t)",
+			Column:  9,
+			Reason:  "t is a built-in variable and can't be a sum's index",
+		},
+		{
+			Formula: "y = prod(x = 1, 2, y)",
+			Column:  10,
+			Reason:  "x is a built-in variable and can't be a prod's index",
+		},
+		{
+			Formula: "y = sum(k = 1, 1e9, k)",
+			Column:  5,
+			Reason:  "sum has 1000000000 terms, more than the 10000 allowed",
+		},
+		{
+			Formula: "y = prod(k = -2^20, 2 * pi, 1)",
+			Column:  5,
+			Reason:  "prod has 1048583 terms, more than the 10000 allowed",
+		},
+		{
+			Formula: "y = sum(k = 1, k, 2)",
+			Column:  16,
+			Reason:  "variable k is used before it is defined",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			_, err := ParseFunctionE(each.Formula)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a *ParseError got %#v", err)
+			}
+			if pe.Column != each.Column || pe.Reason != each.Reason {
+				t.Errorf("Got column %d %#v expected column %d %#v", pe.Column, pe.Reason, each.Column, each.Reason)
+			}
+		})
+	}
+}
+
+func TestSummationTooManyTerms(t *testing.T) {
+	for _, formula := range []string{"0 = sum(k = 1, 1e9 * x, k)", "0 = prod(k = x, 1 / 0, 1)"} {
+		f, err := ParseFunctionE(formula)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		if got, _, err := f.Evaluate(1, 0, 0); err != nil || !math.IsNaN(got) {
+			t.Errorf("%s got %v %v expected NaN", formula, got, err)
+		}
+	}
+	f, err := ParseComplexFunctionE("0 = sum(k = 1, 1e9 * t, k z)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got, _, err := f.EvaluateComplex(1, 1); err != nil || !cmplx.IsNaN(got) {
+		t.Errorf("Got %v %v expected NaN", got, err)
+	}
+}
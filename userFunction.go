@@ -0,0 +1,326 @@
+package heatPlot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UserFunction is a function declared in the formula itself, as in "ring(r, w) = exp(-((r-10)/w)^2);". The Body can
+// only use its Params, the built in variables and functions declared before it.
+type UserFunction struct {
+	Name   string
+	Params []string
+	Body   Expression
+}
+
+func (v UserFunction) String() string {
+	return fmt.Sprintf("%s(%s) = %s", v.Name, strings.Join(v.Params, ", "), v.Body.String())
+}
+
+// UserFunctionCall calls a UserFunction, the arguments are evaluated first and then bound to the parameters in a
+// fresh scope while the body is evaluated. The scope has only the parameters, so the body can't see the variables
+// bound where it is called.
+type UserFunctionCall struct {
+	Name     string
+	Function *UserFunction
+	Args     []Expression
+}
+
+func (v UserFunctionCall) Evaluate(state State) float64 {
+	scope := newCallState(state)
+	for i, arg := range v.Args {
+		scope.Bind(v.Function.Params[i], arg.Evaluate(state))
+	}
+	return v.Function.Body.Evaluate(scope)
+}
+
+func (v UserFunctionCall) String() string {
+	args := make([]string, len(v.Args))
+	for i, arg := range v.Args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s(%s)", v.Name, strings.Join(args, ", "))
+}
+
+func (v UserFunctionCall) Simplify() Expression {
+	args := make([]Expression, len(v.Args))
+	for i, arg := range v.Args {
+		args[i] = removeBrackets(arg.Simplify())
+	}
+	v.Args = args
+	return &v
+}
+
+func (v UserFunctionCall) Depth() int {
+	return maxDepth(v.Args...)
+}
+
+// newCall builds the node for name(args...), calls to functions declared in the formula are swapped for a
+// UserFunctionCall by resolveCalls once all the statements have been read.
+func newCall(name string, args []Expression) Expression {
+	return &NFunction{Name: name, Args: args}
+}
+
+// callParts breaks a function call node into its name and arguments.
+func callParts(e Expression) (name string, args []Expression, ok bool) {
+	switch e := e.(type) {
+	case *NFunction:
+		return e.Name, e.Args, true
+	case *UserFunctionCall:
+		return e.Name, e.Args, true
+	}
+	return "", nil, false
+}
+
+// definitionHead recognises the left hand side of a function declaration, a call where every argument is a variable.
+func definitionHead(e Expression) (name string, params []string, ok bool) {
+	if f, isBuiltin := e.(*NFunction); isBuiltin && f.Infix {
+		return "", nil, false
+	}
+	name, args, ok := callParts(e)
+	if !ok {
+		return "", nil, false
+	}
+	for _, arg := range args {
+		v, isVar := arg.(*Var)
+		if !isVar {
+			return "", nil, false
+		}
+		params = append(params, v.Var)
+	}
+	return name, params, true
+}
+
+// resolveCalls replaces calls to the user declared functions with a UserFunctionCall and checks every other call is to
+// a known function. defining is the name of the function whose body e is, if any, so recursion can be rejected.
+func (lex *CalcLexer) resolveCalls(e Expression, functions map[string]*UserFunction, defining string, tokens []lexedToken) Expression {
+	if name, _, ok := callParts(e); ok && isIterateName(name) && !lex.complex {
+		// An iterate is evaluated over complex numbers, so its arguments are checked as if the formula were complex.
+		lex.complex = true
+		defer func() {
+			lex.complex = false
+		}()
+	}
+	if s, ok := e.(*StringLiteral); ok {
+		lex.fail(findToken(tokens, s.Text), "a string can only be a file name or option given to img", imageHint)
+		return e
+	}
+	name, _, _ := callParts(e)
+	_, declared := functions[strings.ToUpper(name)]
+	sampling := isImageName(name) && !declared
+	for _, ref := range childRefs(e) {
+		if _, isString := (*ref).(*StringLiteral); isString && sampling {
+			// The file name and options of an img are checked when the call is.
+			continue
+		}
+		*ref = lex.resolveCalls(*ref, functions, defining, tokens)
+		if lex.err != nil {
+			return e
+		}
+	}
+	name, args, ok := callParts(e)
+	if !ok {
+		return e
+	}
+	at := findToken(tokens, name)
+	// The grammar only allows an index, such as the k = 1 of sum(k = 1, 10, k), as the first argument.
+	if len(args) > 0 {
+		if index, ok := args[0].(*Equals); ok && (declared || !isSummationName(name)) {
+			lex.fail(findToken(tokens, index.LHS.String()), fmt.Sprintf("%s can't be given %s", name, index.String()), "only sum and prod take an index and its first value, as in sum(k = 1, 10, k * x), compare with ==")
+			return e
+		}
+	}
+	if defining != "" && strings.EqualFold(name, defining) {
+		lex.fail(at, fmt.Sprintf("%s calls itself", name), "recursive functions aren't supported, write the repetition out or use an earlier function")
+		return e
+	}
+	if uf, ok := functions[strings.ToUpper(name)]; ok {
+		if len(args) != len(uf.Params) {
+			lex.fail(at, fmt.Sprintf("%s takes %d arguments but was given %d", name, len(uf.Params), len(args)), fmt.Sprintf("it was declared as %s(%s)", uf.Name, strings.Join(uf.Params, ", ")))
+			return e
+		}
+		return &UserFunctionCall{
+			Name:     name,
+			Function: uf,
+			Args:     args,
+		}
+	}
+	if s := lex.summation(name, args, tokens); s != nil {
+		return s
+	} else if lex.err != nil {
+		return e
+	}
+	if sampling {
+		if v := lex.image(name, args, tokens); v != nil {
+			return v
+		}
+		return e
+	}
+	if strings.EqualFold(name, "integrate") {
+		if i := lex.integral(name, args); i != nil {
+			return i
+		}
+		lex.fail(at, "integrate takes a variable, its first and last values and the integrand", "for example integrate(s, 0, t, sin(s))")
+		return e
+	}
+	if isIterateName(name) {
+		it := lex.iterate(name, args)
+		if it == nil {
+			lex.fail(at, fmt.Sprintf("%s takes a variable, its first value, the next value, when to stop and the most steps", strings.ToLower(name)), "for example iterate(w, 0, w^2 + z, abs(w) > 2, 100) for the Mandelbrot set")
+			return e
+		}
+		if isConstant(it.Max) && it.Max.Evaluate(&RealState{}) > maxIterations {
+			lex.fail(at, fmt.Sprintf("%s takes at most %d steps", strings.ToLower(name), maxIterations), "use fewer steps, the detail they add is usually smaller than a pixel")
+			return e
+		}
+		if !lex.checkComplex(it, tokens) {
+			return e
+		}
+		return it
+	}
+	if isPrevVar(name) {
+		if len(args) == 0 || len(args) == 2 {
+			return &Prev{Args: args}
+		}
+		lex.fail(at, fmt.Sprintf("prev takes no arguments or an offset dx, dy but was given %d", len(args)), "for example prev(1, 0) for the pixel to the right in the previous frame")
+		return e
+	}
+	if want := neighbourhoodArity(name); want != 0 {
+		if len(args) == want {
+			return &Neighbourhood{Name: name, Args: args}
+		}
+		lex.fail(at, fmt.Sprintf("%s takes %s but was given %d", name, arity{counts: []int{want}}, len(args)), "for example disc(3) or ring(3, 9), the mean of the previous frame within 3 pixels or from 3 to 9 pixels away")
+		return e
+	}
+	if want := convolutionArity(name); want != 0 {
+		if len(args) == want {
+			return &Convolution{Name: name, Expr: args[0], Args: args[1:]}
+		}
+		lex.fail(at, fmt.Sprintf("%s takes %s but was given %d", name, arity{counts: []int{want}}, len(args)), "for example laplace(sin(x y)), blur(sin(x y), 3) or at(sin(x y), 1, 0)")
+		return e
+	}
+	if strings.EqualFold(name, "accumulate") {
+		if len(args) == 1 {
+			return &Accumulate{Expr: args[0]}
+		}
+		lex.fail(at, fmt.Sprintf("accumulate takes 1 argument but was given %d", len(args)), "for example accumulate(sin(x + t))")
+		return e
+	}
+	if d, err := lex.derivativeCall(name, args); err != nil {
+		lex.fail(at, err.Error(), "for example d(x^2 * y, x) is 2x * y")
+		return e
+	} else if d != nil {
+		return d
+	}
+	if strings.EqualFold(name, "prod") {
+		lex.fail(at, "prod takes its index and first value, the last value and the terms", "for example prod(k = 1, 10, 1 + x / k)")
+		return e
+	}
+	if !lex.knownFunction(name) {
+		lex.fail(at, fmt.Sprintf("unknown function %s", name), "declare it in an earlier statement, for example f(a, b) = a * b; or see whatFunctions for the built in ones")
+		return e
+	}
+	if arity := lex.arity(name); !arity.accepts(len(args)) {
+		lex.fail(at, fmt.Sprintf("%s takes %s but was given %d", name, arity, len(args)), "see whatFunctions for how many arguments each function takes")
+		return e
+	}
+	return e
+}
+
+// findToken returns the first token written as name, or the first token if there is none.
+func findToken(tokens []lexedToken, name string) lexedToken {
+	for _, t := range tokens {
+		if strings.EqualFold(t.text, name) {
+			return t
+		}
+	}
+	if len(tokens) == 0 {
+		return lexedToken{}
+	}
+	return tokens[0]
+}
+
+// scopedState layers variables over another State, such as the index of a sum while its body is evaluated.
+// Everything it doesn't define itself comes from the parent, but for the parent's variables when it is isolated.
+type scopedState struct {
+	parent   State
+	vars     map[string]float64
+	isolated bool
+}
+
+func (s *scopedState) CurX() float64 {
+	return s.parent.CurX()
+}
+
+func (s *scopedState) CurY() float64 {
+	return s.parent.CurY()
+}
+
+func (s *scopedState) CurT() float64 {
+	return s.parent.CurT()
+}
+
+func (s *scopedState) CurR() float64 {
+	return s.parent.CurR()
+}
+
+func (s *scopedState) CurTheta() float64 {
+	return s.parent.CurTheta()
+}
+
+func (s *scopedState) CurSeed() int64 {
+	return s.parent.CurSeed()
+}
+
+func (s *scopedState) Prev(dx, dy int) float64 {
+	return s.parent.Prev(dx, dy)
+}
+
+func (s *scopedState) Frames() (start, step float64) {
+	return s.parent.Frames()
+}
+
+func (s *scopedState) Total(e Expression, t float64) (float64, bool) {
+	return s.parent.Total(e, t)
+}
+
+func (s *scopedState) KeepTotal(e Expression, total float64) {
+	s.parent.KeepTotal(e, total)
+}
+
+func (s *scopedState) Field(e Expression, dx, dy int) float64 {
+	return s.parent.Field(e, dx, dy)
+}
+
+func (s *scopedState) Lookup(name string) (float64, bool) {
+	if v, ok := s.vars[strings.ToUpper(name)]; ok {
+		return v, true
+	}
+	if s.isolated {
+		return 0, false
+	}
+	return s.parent.Lookup(name)
+}
+
+func (s *scopedState) Bind(name string, value float64) {
+	s.vars[strings.ToUpper(name)] = value
+}
+
+func (s *scopedState) Scope() State {
+	return newScopedState(s)
+}
+
+func newScopedState(parent State) *scopedState {
+	return &scopedState{
+		parent: parent,
+		vars:   map[string]float64{},
+	}
+}
+
+// newCallState is the scope of a UserFunction's parameters while its body is evaluated, which sees x, y, t and the
+// rest of parent but none of its variables.
+func newCallState(parent State) *scopedState {
+	s := newScopedState(parent)
+	s.isolated = true
+	return s
+}
@@ -0,0 +1,140 @@
+package heatPlot
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestUserFunction(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula  string
+		Expected string
+		Explicit string
+	}{
+		{
+			Formula:  "ring(r, w) = exp(-((r-10)/w)^2); y = ring(hypot(x,y), 2) + ring(hypot(x-5,y), 1)",
+			Expected: "ring(r, w) = exp(-((r - 10) / w) ^ 2); y = ring(hypot(x, y), 2) + ring(hypot(x - 5, y), 1)",
+			Explicit: "y = exp(-((hypot(x, y) - 10) / 2) ^ 2) + exp(-((hypot(x - 5, y) - 10) / 1) ^ 2)",
+		},
+		{
+			Formula:  "sq(x) = x * x; y = sq(y) + sq(t)",
+			Expected: "sq(x) = x * x; y = sq(y) + sq(t)",
+			Explicit: "y = y * y + t * t",
+		},
+		{
+			Formula:  "sq(a) = a * a; quad(a) = sq(sq(a)); k = quad(x); y = k + 1",
+			Expected: "sq(a) = a * a; quad(a) = sq(sq(a)); k = quad(x); y = k + 1",
+			Explicit: "y = x * x * x * x + 1",
+		},
+		{
+			Formula:  "mix(a, b, c) = a * c + b * (1 - c); y = mix(x, y, 0.25)",
+			Expected: "mix(a, b, c) = a * c + b * (1 - c); y = mix(x, y, 0.25)",
+			Explicit: "y = x * 0.25 + y * (1 - 0.25)",
+		},
+		{
+			Formula:  "sin(a) = a; y = sin(x)",
+			Expected: "sin(a) = a; y = sin(x)",
+			Explicit: "y = x",
+		},
+		{
+			Formula:  "r = 3; f(a) = a * r; y = f(1) + r",
+			Expected: "r = 3; f(a) = a * r; y = f(1) + r",
+			Explicit: "y = hypot(x, y) + 3",
+		},
+		{
+			Formula:  "g(b) = b + r; f(r) = g(1) * r; y = f(2)",
+			Expected: "g(b) = b + r; f(r) = g(1) * r; y = f(2)",
+			Explicit: "y = (1 + hypot(x, y)) * 2",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			f, err := ParseFunctionE(each.Formula)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if f.String() != each.Expected {
+				t.Errorf("Failed to match %v with %v", f.String(), each.Expected)
+			}
+			if _, err := ParseFunctionE(f.String()); err != nil {
+				t.Errorf("Reparse failed: %v", err)
+			}
+			explicit := ParseFunction(each.Explicit)
+			for _, p := range [][3]float64{{3, 5, 7}, {-1.5, 2, 1}, {0.25, -4, 12}} {
+				got, tUsed, _ := f.Evaluate(p[0], p[1], p[2])
+				expected, expectedTUsed, _ := explicit.Evaluate(p[0], p[1], p[2])
+				if got != expected {
+					t.Errorf("At %v got %v expected %v", p, got, expected)
+				}
+				if tUsed != expectedTUsed {
+					t.Errorf("At %v T used %v expected %v", p, tUsed, expectedTUsed)
+				}
+			}
+		})
+	}
+}
+
+func TestUserFunctionErrors(t *testing.T) {
+	for eachI, each := range []struct {
+		Formula string
+		Column  int
+		Reason  string
+	}{
+		{
+			Formula: "f(a) = f(a - 1); y = f(x)",
+			Column:  8,
+			Reason:  "f calls itself",
+		},
+		{
+			Formula: "f(a, b) = a * b; y = f(x)",
+			Column:  22,
+			Reason:  "f takes 2 arguments but was given 1",
+		},
+		{
+			Formula: "f(a) = g(a); g(a) = a; y = f(x)",
+			Column:  8,
+			Reason:  "unknown function g",
+		},
+		{
+			Formula: "k = 2; f(a) = a * k; y = f(x)",
+			Column:  19,
+			Reason:  "variable k isn't a parameter of f",
+		},
+		{
+			Formula: "f(a, a) = a; y = f(x, y)",
+			Column:  3,
+			Reason:  "a is a parameter of f more than once",
+		},
+		{
+			Formula: "y = nosuch(x)",
+			Column:  5,
+			Reason:  "unknown function nosuch",
+		},
+		{
+			Formula: "y = sin(x, y, t)",
+			Column:  5,
+			Reason:  "sin takes 1 argument but was given 3",
+		},
+		{
+			Formula: "y = pow(x)",
+			Column:  5,
+			Reason:  "pow takes 2 arguments but was given 1",
+		},
+		{
+			Formula: "y = x expm1 2",
+			Column:  7,
+			Reason:  "expm1 takes 1 argument but was given 2",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d: %s", eachI, each.Formula), func(t *testing.T) {
+			_, err := ParseFunctionE(each.Formula)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a *ParseError got %#v", err)
+			}
+			if pe.Column != each.Column || pe.Reason != each.Reason {
+				t.Errorf("Got column %d %#v expected column %d %#v", pe.Column, pe.Reason, each.Column, each.Reason)
+			}
+		})
+	}
+}